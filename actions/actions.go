@@ -0,0 +1,307 @@
+// Package actions creates signed one-time links that act on a todo, e.g. to mark it done from a reminder mail.
+package actions
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/modify"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/notify"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// The actions of the links.
+const (
+	Done     = "done"
+	Snooze   = "snooze"
+	NextWeek = "next_week"
+)
+
+// DefaultExpiry is how long action links are valid by default.
+const DefaultExpiry = 7 * 24 * time.Hour
+
+var kinds = []string{Done, Snooze, NextWeek}
+
+var labels = map[string]string{Done: "Done", Snooze: "Snooze 1 day", NextWeek: "Next week"}
+
+var (
+	// ErrInvalidToken is returned for tokens that were not signed with the key.
+	ErrInvalidToken = errors.New("invalid action link")
+	// ErrExpired is returned for tokens older than the expiry.
+	ErrExpired = errors.New("action link expired")
+	// ErrUsed is returned for tokens that were already used.
+	ErrUsed = errors.New("action link was already used")
+	// ErrMomentNotFound is returned if the todo was changed or removed since the link was created.
+	ErrMomentNotFound = errors.New("todo not found, it was changed or removed")
+	// ErrAlreadyDone is returned if the todo was marked done since the link was created.
+	ErrAlreadyDone = errors.New("todo is already done")
+)
+
+var getNow = func() time.Time {
+	return time.Now()
+}
+
+// usedMu guards the file of used tokens.
+var usedMu sync.Mutex
+
+// Claims are the signed content of an action link.
+type Claims struct {
+	Action string `json:"a"`
+	// ID is the moment ID, if it has one. Otherwise the moment is found by name and due day.
+	ID   string `json:"i,omitempty"`
+	Name string `json:"n"`
+	// Due is the day (2006-01-02) the moment was due when the link was created.
+	Due     string `json:"d"`
+	Expires int64  `json:"e"`
+	// Nonce makes every link unique, so it can only be used once.
+	Nonce string `json:"x"`
+}
+
+// Describe returns what the action does, e.g. "Mark foo as done".
+func (c *Claims) Describe() string {
+	switch c.Action {
+	case Done:
+		return fmt.Sprintf("Mark %s as done", c.Name)
+	case Snooze:
+		return fmt.Sprintf("Snooze %s by a day", c.Name)
+	}
+	return fmt.Sprintf("Move %s to next week", c.Name)
+}
+
+// Signer creates and verifies action links.
+type Signer struct {
+	Key []byte
+	// BaseURL is the URL of the REST server the links point to, e.g. http://localhost:8082.
+	BaseURL string
+	Expiry  time.Duration
+}
+
+// Links returns the action links for the moment. Only single moments with a due date have actions, since
+// the occurrences of recurring moments cannot be changed on their own.
+func (s *Signer) Links(m moment.Moment) []notify.Action {
+	single, ok := m.(*moment.SingleMoment)
+	if !ok || single.End == nil || m.IsDone() {
+		return nil
+	}
+	var links []notify.Action
+	for _, kind := range kinds {
+		c := &Claims{
+			Action:  kind,
+			Name:    strings.TrimSpace(m.GetName()),
+			Due:     single.End.Time.Format("2006-01-02"),
+			Expires: getNow().Add(s.Expiry).Unix(),
+			Nonce:   newNonce(),
+		}
+		if m.GetID() != nil {
+			c.ID = m.GetID().Value
+		}
+		token, err := s.sign(c)
+		if err != nil {
+			log.Errorf("Could not create action link: %s\n", err)
+			return nil
+		}
+		links = append(links, notify.Action{Label: labels[kind], URL: strings.TrimRight(s.BaseURL, "/") + "/actions/" + token})
+	}
+	return links
+}
+
+// sign returns the token for the claims: the base64 encoded claims and their HMAC, separated by a dot.
+func (s *Signer) sign(c *Claims) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload)), nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Verify checks the signature and expiry of the token and returns its claims. It does not check if the token
+// was already used, see Apply.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, s.mac(parts[0])) {
+		return nil, ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c Claims
+	err = json.Unmarshal(data, &c)
+	if err != nil || labels[c.Action] == "" {
+		return nil, ErrInvalidToken
+	}
+	if getNow().Unix() > c.Expires {
+		return nil, ErrExpired
+	}
+	return &c, nil
+}
+
+// Apply applies the action of the token to the todo file, after a backup, and returns what was done.
+// Every token can only be used once: it is recorded as used before the todo file is changed, and released
+// again if the change fails.
+func Apply(files *util.FileConfig, s *Signer, token string) (string, error) {
+	c, err := s.Verify(token)
+	if err != nil {
+		return "", err
+	}
+	usedMu.Lock()
+	defer usedMu.Unlock()
+	used, err := loadUsed(files.ActionsFile)
+	if err != nil {
+		return "", err
+	}
+	if _, found := used[c.Nonce]; found {
+		return "", ErrUsed
+	}
+	now := getNow().Unix()
+	for nonce, expires := range used {
+		if expires < now {
+			delete(used, nonce)
+		}
+	}
+	used[c.Nonce] = c.Expires
+	err = saveUsed(files.ActionsFile, used)
+	if err != nil {
+		return "", fmt.Errorf("could not record used action link: %s", err)
+	}
+
+	result, err := applyToFile(files, c)
+	if err != nil {
+		delete(used, c.Nonce)
+		if saveErr := saveUsed(files.ActionsFile, used); saveErr != nil {
+			log.Errorf("Could not release action link: %s\n", saveErr)
+		}
+		return "", err
+	}
+	log.Infof("%s\n", result)
+	return result, nil
+}
+
+func applyToFile(files *util.FileConfig, c *Claims) (string, error) {
+	_, err := backup.Save(files, "Backup before reminder action")
+	if err != nil {
+		return "", err
+	}
+	var result string
+	err = modify.InFile(files.TodoFile, func(content string) (string, error) {
+		todos, err := parse.String(content)
+		if err != nil {
+			return "", err
+		}
+		m := findMoment(todos.Moments, c)
+		if m == nil {
+			return "", ErrMomentNotFound
+		}
+		if m.IsDone() {
+			return "", ErrAlreadyDone
+		}
+		var modified string
+		modified, result, err = applyAction(content, m, c.Action)
+		return modified, err
+	})
+	return result, err
+}
+
+func applyAction(content string, m *moment.SingleMoment, action string) (string, string, error) {
+	name := strings.TrimSpace(m.GetName())
+	if action == Done {
+		modified, err := modify.MarkDone(content, m)
+		return modified, fmt.Sprintf("Marked %s as done", name), err
+	}
+	days := 1
+	verb := "Snoozed"
+	if action == NextWeek {
+		days = 7
+		verb = "Moved"
+	}
+	// Overdue moments are moved relative to today, otherwise they would still be overdue.
+	due := util.SetToStartOfDay(m.End.Time)
+	from := due
+	if today := util.SetToStartOfDay(getNow()); from.Before(today) {
+		from = today
+	}
+	to := from.AddDate(0, 0, days)
+	modified, err := modify.ShiftDates(content, m, int(to.Sub(due).Hours()/24+0.5))
+	return modified, fmt.Sprintf("%s %s to %s", verb, name, to.Format("Monday, 2 Jan 2006")), err
+}
+
+// findMoment finds the moment of the claims by its ID, or by its name and due day.
+func findMoment(moms []moment.Moment, c *Claims) *moment.SingleMoment {
+	for _, m := range moms {
+		single, ok := m.(*moment.SingleMoment)
+		if ok && single.End != nil {
+			if c.ID != "" && m.GetID() != nil && m.GetID().Value == c.ID {
+				return single
+			}
+			if c.ID == "" && strings.TrimSpace(m.GetName()) == c.Name && single.End.Time.Format("2006-01-02") == c.Due {
+				return single
+			}
+		}
+		if sub := findMoment(m.GetSubMoments(), c); sub != nil {
+			return sub
+		}
+	}
+	return nil
+}
+
+func newNonce() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loadUsed returns the nonces of the used tokens with their expiry.
+func loadUsed(path string) (map[string]int64, error) {
+	used := make(map[string]int64)
+	content, err := util.ReadFile(path)
+	if os.IsNotExist(err) {
+		return used, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(content), &used)
+	if err != nil {
+		return nil, fmt.Errorf("could not read used action links %s: %s", path, err)
+	}
+	return used, nil
+}
+
+func saveUsed(path string, used map[string]int64) error {
+	content, err := json.MarshalIndent(used, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Replace atomically, so a crash cannot lose the used tokens.
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
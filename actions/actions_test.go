@@ -0,0 +1,169 @@
+package actions
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSigner = &Signer{Key: []byte("0123456789abcdef"), BaseURL: "http://localhost:8082/", Expiry: DefaultExpiry}
+
+func setupTodoFile(content string) (*util.FileConfig, func()) {
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 08:00") }
+	dir := tu.MakeTempDir("sibyl_actions_test")
+	todoFile := filepath.Join(dir, "todo.txt")
+	util.WriteFile(todoFile, content)
+	return util.NewFileConfigFromTodoFile(todoFile), func() {
+		tu.DeleteTempDir(dir)
+		getNow = time.Now
+	}
+}
+
+func links(t *testing.T, files *util.FileConfig, index int) map[string]string {
+	todos, err := parse.File(files.TodoFile)
+	assert.NoError(t, err)
+	res := make(map[string]string)
+	for _, l := range testSigner.Links(todos.Moments[index]) {
+		res[l.Label] = l.URL
+	}
+	return res
+}
+
+func token(url string) string {
+	return url[strings.LastIndex(url, "/")+1:]
+}
+
+func TestLinks(t *testing.T) {
+	files, cleanup := setupTodoFile(`[] foo (5.1.19)
+[] weekly (every monday)
+[x] done (5.1.19)
+[] no date
+`)
+	defer cleanup()
+
+	foo := links(t, files, 0)
+
+	assert.Equal(t, 3, len(foo))
+	tu.AssertContains(t, "http://localhost:8082/actions/", foo["Done"])
+	c, err := testSigner.Verify(token(foo["Snooze 1 day"]))
+	assert.NoError(t, err)
+	assert.Equal(t, Snooze, c.Action)
+	assert.Equal(t, "foo", c.Name)
+	assert.Equal(t, "2019-01-05", c.Due)
+	assert.Equal(t, "Snooze foo by a day", c.Describe())
+	assert.Equal(t, 0, len(links(t, files, 1)), "recurring")
+	assert.Equal(t, 0, len(links(t, files, 2)), "done")
+	assert.Equal(t, 0, len(links(t, files, 3)), "no date")
+}
+
+func TestVerify_Invalid(t *testing.T) {
+	files, cleanup := setupTodoFile("[] foo (5.1.19)\n")
+	defer cleanup()
+	tok := token(links(t, files, 0)["Done"])
+
+	_, err := (&Signer{Key: []byte("another key"), Expiry: DefaultExpiry}).Verify(tok)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = testSigner.Verify(tok[:10] + tok[11:])
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = testSigner.Verify("nope")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	getNow = func() time.Time { return tu.Dtt("12.01.2019 08:01") }
+	_, err = testSigner.Verify(tok)
+	assert.Equal(t, ErrExpired, err)
+}
+
+func TestApply_Done(t *testing.T) {
+	files, cleanup := setupTodoFile(`[] foo (5.1.19 13:00)
+	[] sub (5.1.19)
+`)
+	defer cleanup()
+	tok := token(links(t, files, 0)["Done"])
+
+	res, err := Apply(files, testSigner, tok)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Marked foo as done", res)
+	content, _ := util.ReadFile(files.TodoFile)
+	assert.Equal(t, "[x] foo (5.1.19 13:00)\n\t[] sub (5.1.19)\n", content)
+	backups, _ := backup.ListBackups(files)
+	assert.Equal(t, "Backup before reminder action", backups[0].Message)
+
+	_, err = Apply(files, testSigner, tok)
+	assert.Equal(t, ErrUsed, err)
+}
+
+func TestApply_Snooze(t *testing.T) {
+	files, cleanup := setupTodoFile(`[] late (-2.1.19)
+[] soon (5.1.19-07.01.2019) #s1
+`)
+	defer cleanup()
+	late := token(links(t, files, 0)["Snooze 1 day"])
+	soon := token(links(t, files, 1)["Next week"])
+
+	res, err := Apply(files, testSigner, late)
+	assert.NoError(t, err)
+	assert.Equal(t, "Snoozed late to Sunday, 6 Jan 2019", res)
+	res, err = Apply(files, testSigner, soon)
+	assert.NoError(t, err)
+	assert.Equal(t, "Moved soon to Monday, 14 Jan 2019", res)
+
+	content, _ := util.ReadFile(files.TodoFile)
+	assert.Equal(t, "[] late (-6.1.19)\n[] soon (12.1.19-14.01.2019) #s1\n", content)
+}
+
+func TestApply_MomentChanged(t *testing.T) {
+	files, cleanup := setupTodoFile("[] foo (5.1.19)\n")
+	defer cleanup()
+	tok := token(links(t, files, 0)["Done"])
+	util.WriteFile(files.TodoFile, "[] foo (6.1.19)\n")
+
+	_, err := Apply(files, testSigner, tok)
+
+	assert.Equal(t, ErrMomentNotFound, err)
+	util.WriteFile(files.TodoFile, "[] foo (5.1.19)\n")
+	_, err = Apply(files, testSigner, tok)
+	assert.NoError(t, err, "not used up by the failed attempt")
+}
+
+func TestApply_AlreadyDone(t *testing.T) {
+	files, cleanup := setupTodoFile("[] foo (5.1.19)\n")
+	defer cleanup()
+	tok := token(links(t, files, 0)["Snooze 1 day"])
+	util.WriteFile(files.TodoFile, "[x] foo (5.1.19)\n")
+
+	_, err := Apply(files, testSigner, tok)
+
+	assert.Equal(t, ErrAlreadyDone, err)
+	content, _ := util.ReadFile(files.TodoFile)
+	assert.Equal(t, "[x] foo (5.1.19)\n", content)
+}
+
+func TestApply_CannotRecordUsed(t *testing.T) {
+	files, cleanup := setupTodoFile("[] foo (5.1.19)\n")
+	defer cleanup()
+	tok := token(links(t, files, 0)["Done"])
+	files.ActionsFile = filepath.Join(files.TodoDir, "missing", "actions.json")
+
+	_, err := Apply(files, testSigner, tok)
+
+	tu.AssertContains(t, "could not record used action link", err.Error())
+	content, _ := util.ReadFile(files.TodoFile)
+	assert.Equal(t, "[] foo (5.1.19)\n", content)
+}
+
+func TestFindMoment_ByID(t *testing.T) {
+	todos, _ := parse.String("[] foo (5.1.19)\n[] bar (5.1.19)\n\t[] foo (8.1.19) #f\n")
+
+	m := findMoment(todos.Moments, &Claims{ID: "f", Name: "foo", Due: "2019-01-05"})
+
+	assert.Equal(t, todos.Moments[1].GetSubMoments()[0], moment.Moment(m))
+}
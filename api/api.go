@@ -0,0 +1,12 @@
+// Package api contains the OpenAPI specification of the sibylgo REST server.
+package api
+
+import (
+	// Needed for go:embed
+	_ "embed"
+)
+
+// OpenAPISpec is the OpenAPI 3 document describing all REST endpoints.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
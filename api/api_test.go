@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecIsValidJSON(t *testing.T) {
+	var spec map[string]interface{}
+	err := json.Unmarshal(OpenAPISpec, &spec)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "3.0.3", spec["openapi"])
+}
+
+func TestSpecReferencesExist(t *testing.T) {
+	var spec map[string]interface{}
+	json.Unmarshal(OpenAPISpec, &spec)
+
+	for _, ref := range collectRefs(spec) {
+		assert.NotNil(t, resolve(spec, ref), "unresolved reference %s", ref)
+	}
+}
+
+func collectRefs(node interface{}) []string {
+	var refs []string
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if s, ok := child.(string); ok && k == "$ref" {
+				refs = append(refs, s)
+			} else {
+				refs = append(refs, collectRefs(child)...)
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			refs = append(refs, collectRefs(child)...)
+		}
+	}
+	return refs
+}
+
+func resolve(spec map[string]interface{}, ref string) interface{} {
+	var cur interface{} = spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
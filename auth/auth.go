@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader is the header carrying the HMAC signature of a request.
+const SignatureHeader = "X-Sibyl-Signature"
+
+// MaxClockSkew is how far the timestamp of a signed request may deviate from the server time.
+const MaxClockSkew = 5 * time.Minute
+
+var getNow = time.Now
+
+// accepted remembers the signatures of accepted requests while their timestamp is valid, so captured requests
+// cannot be replayed. It is shared by all middlewares, so it survives restarts of the server.
+var accepted = &acceptedSignatures{expires: make(map[string]time.Time)}
+
+type acceptedSignatures struct {
+	mutex   sync.Mutex
+	expires map[string]time.Time
+}
+
+// add returns false if the signature was already accepted.
+func (a *acceptedSignatures) add(signature string, timestamp time.Time) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	now := getNow()
+	for sig, exp := range a.expires {
+		if exp.Before(now) {
+			delete(a.expires, sig)
+		}
+	}
+	if _, found := a.expires[signature]; found {
+		return false
+	}
+	a.expires[signature] = timestamp.Add(MaxClockSkew)
+	return true
+}
+
+// Options configures which authentication methods are accepted. If neither a token
+// nor an HMAC secret is set, all requests are allowed.
+type Options struct {
+	Token      string
+	HMACSecret string
+	// PublicPaths are not authenticated, e.g. health checks. Paths ending with a slash also match the paths below.
+	PublicPaths []string
+	// OnUnauthorized writes the response for rejected requests. Defaults to a plain text 401.
+	OnUnauthorized func(w http.ResponseWriter, r *http.Request, message string)
+}
+
+// Enabled returns true if at least one authentication method is configured.
+func (o Options) Enabled() bool {
+	return o.Token != "" || o.HMACSecret != ""
+}
+
+// Middleware rejects requests that are neither authenticated with the bearer token
+// nor carry a valid HMAC signature.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !opts.Enabled() || r.Method == http.MethodOptions || opts.isPublic(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if opts.Token != "" && hasValidToken(r, opts.Token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if opts.HMACSecret != "" && r.Header.Get(SignatureHeader) != "" {
+				err := verifySignature(r, opts.HMACSecret)
+				if err == nil {
+					next.ServeHTTP(w, r)
+					return
+				}
+				opts.reject(w, r, err.Error())
+				return
+			}
+			opts.reject(w, r, "missing or invalid credentials")
+		})
+	}
+}
+
+func (o Options) isPublic(path string) bool {
+	for _, p := range o.PublicPaths {
+		if p == path || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasValidToken(r *http.Request, token string) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	given := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+func verifySignature(r *http.Request, secret string) error {
+	parts := strings.SplitN(r.Header.Get(SignatureHeader), ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("malformed %s header, expected <timestamp>:<signature>", SignatureHeader)
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed timestamp in %s header", SignatureHeader)
+	}
+	skew := getNow().Sub(time.Unix(ts, 0))
+	if skew > MaxClockSkew || skew < -MaxClockSkew {
+		return fmt.Errorf("request timestamp is too far from server time")
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	// Restore the body for the actual handler.
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := Sign(secret, ts, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(parts[1]), []byte(expected)) {
+		return fmt.Errorf("invalid signature")
+	}
+	if !accepted.add(expected, time.Unix(ts, 0)) {
+		return fmt.Errorf("signature was already used")
+	}
+	return nil
+}
+
+// Sign computes the hex-encoded HMAC-SHA256 signature of a request. The signed message is
+// the unix timestamp, method, request URI (path and query) and body, separated by newlines.
+func Sign(secret string, timestamp int64, method string, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s\n", timestamp, method, requestURI)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeaderValue returns the value of the SignatureHeader for a request sent now.
+func SignatureHeaderValue(secret string, method string, requestURI string, body []byte) string {
+	ts := getNow().Unix()
+	return fmt.Sprintf("%d:%s", ts, Sign(secret, ts, method, requestURI, body))
+}
+
+func (o Options) reject(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="sibylgo"`)
+	if o.OnUnauthorized != nil {
+		o.OnUnauthorized(w, r, msg)
+		return
+	}
+	http.Error(w, msg, http.StatusUnauthorized)
+}
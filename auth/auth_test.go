@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoAuthConfigured(t *testing.T) {
+	rec := serve(Options{}, httptest.NewRequest("POST", "/trash", nil))
+
+	assert.Equal(t, 200, rec.Code)
+}
+
+func TestBearerToken(t *testing.T) {
+	opts := Options{Token: "s3cret"}
+
+	req := httptest.NewRequest("POST", "/trash", nil)
+	assert.Equal(t, 401, serve(opts, req).Code)
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	assert.Equal(t, 401, serve(opts, req).Code)
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	assert.Equal(t, 200, serve(opts, req).Code)
+}
+
+func TestPublicPathsAndPreflight(t *testing.T) {
+	opts := Options{Token: "s3cret", PublicPaths: []string{"/health", "/actions/"}}
+
+	assert.Equal(t, 200, serve(opts, httptest.NewRequest("GET", "/health", nil)).Code)
+	assert.Equal(t, 200, serve(opts, httptest.NewRequest("POST", "/actions/abc", nil)).Code)
+	assert.Equal(t, 401, serve(opts, httptest.NewRequest("GET", "/actionsx", nil)).Code)
+	assert.Equal(t, 200, serve(opts, httptest.NewRequest("OPTIONS", "/trash", nil)).Code)
+	assert.Equal(t, 401, serve(opts, httptest.NewRequest("GET", "/healthz", nil)).Code)
+}
+
+func TestHMACSignature(t *testing.T) {
+	getNow = func() time.Time { return tu.Dtt("04.01.2019 13:00") }
+	defer func() { getNow = time.Now }()
+	opts := Options{HMACSecret: "s3cret"}
+
+	req := httptest.NewRequest("POST", "/moments?name=foo", strings.NewReader("body"))
+	req.Header.Set(SignatureHeader, SignatureHeaderValue("s3cret", "POST", "/moments?name=foo", []byte("body")))
+	rec := serve(opts, req)
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "body", rec.Body.String())
+}
+
+func TestHMACSignature_Invalid(t *testing.T) {
+	getNow = func() time.Time { return tu.Dtt("04.01.2019 13:00") }
+	defer func() { getNow = time.Now }()
+	opts := Options{HMACSecret: "s3cret"}
+	ts := getNow().Unix()
+
+	cases := map[string]string{
+		"wrong secret":  SignatureHeaderValue("other", "POST", "/trash", nil),
+		"wrong path":    SignatureHeaderValue("s3cret", "POST", "/clean", nil),
+		"expired":       fmt.Sprintf("%d:%s", ts-600, Sign("s3cret", ts-600, "POST", "/trash", nil)),
+		"no timestamp":  Sign("s3cret", ts, "POST", "/trash", nil),
+		"bad timestamp": "abc:" + Sign("s3cret", ts, "POST", "/trash", nil),
+	}
+	for name, header := range cases {
+		req := httptest.NewRequest("POST", "/trash", nil)
+		req.Header.Set(SignatureHeader, header)
+		assert.Equal(t, 401, serve(opts, req).Code, name)
+	}
+}
+
+func TestHMACSignature_Replay(t *testing.T) {
+	getNow = func() time.Time { return tu.Dtt("04.01.2019 13:00") }
+	defer func() { getNow = time.Now }()
+	opts := Options{HMACSecret: "s3cret"}
+	header := SignatureHeaderValue("s3cret", "POST", "/trash?replay", nil)
+
+	req := httptest.NewRequest("POST", "/trash?replay", nil)
+	req.Header.Set(SignatureHeader, header)
+	assert.Equal(t, 200, serve(opts, req).Code)
+
+	req = httptest.NewRequest("POST", "/trash?replay", nil)
+	req.Header.Set(SignatureHeader, header)
+	rec := serve(opts, req)
+	assert.Equal(t, 401, rec.Code)
+	assert.Equal(t, "signature was already used\n", rec.Body.String())
+
+	getNow = func() time.Time { return tu.Dtt("04.01.2019 13:06") }
+	req = httptest.NewRequest("POST", "/trash?replay", nil)
+	req.Header.Set(SignatureHeader, header)
+	assert.Equal(t, 401, serve(opts, req).Code, "expired")
+	req = httptest.NewRequest("POST", "/trash?replay", nil)
+	req.Header.Set(SignatureHeader, SignatureHeaderValue("s3cret", "POST", "/trash?replay", nil))
+	assert.Equal(t, 200, serve(opts, req).Code)
+	assert.NotContains(t, accepted.expires, header[strings.Index(header, ":")+1:], "forgotten after expiry")
+}
+
+func TestTokenOrHMAC(t *testing.T) {
+	opts := Options{Token: "tok", HMACSecret: "s3cret"}
+
+	req := httptest.NewRequest("GET", "/moments", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	assert.Equal(t, 200, serve(opts, req).Code)
+
+	req = httptest.NewRequest("GET", "/moments", nil)
+	req.Header.Set(SignatureHeader, SignatureHeaderValue("s3cret", "GET", "/moments", nil))
+	assert.Equal(t, 200, serve(opts, req).Code)
+}
+
+func TestOnUnauthorized(t *testing.T) {
+	opts := Options{Token: "s3cret", OnUnauthorized: func(w http.ResponseWriter, r *http.Request, msg string) {
+		w.WriteHeader(401)
+		fmt.Fprintf(w, `{"error": "%s"}`, msg)
+	}}
+
+	rec := serve(opts, httptest.NewRequest("GET", "/moments", nil))
+
+	assert.Equal(t, 401, rec.Code)
+	assert.Equal(t, `{"error": "missing or invalid credentials"}`, rec.Body.String())
+	assert.Equal(t, `Bearer realm="sibylgo"`, rec.Header().Get("WWW-Authenticate"))
+}
+
+func serve(opts Options, req *http.Request) *httptest.ResponseRecorder {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	rec := httptest.NewRecorder()
+	Middleware(opts)(echo).ServeHTTP(rec, req)
+	return rec
+}
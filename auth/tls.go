@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/sandro-h/sibylgo/util"
+)
+
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// GenerateSelfSigned creates a self-signed certificate valid for the given hosts (names or IPs)
+// and returns the PEM-encoded certificate and private key.
+func GenerateSelfSigned(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := getNow()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"sibylgo"}, CommonName: "sibylgo"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+// LoadOrGenerateCertificate loads the certificate from certFile and keyFile. If selfSigned is set
+// and the files do not exist yet, a self-signed certificate for hosts is generated first and
+// written to them. If no files are passed, the generated certificate is only kept in memory.
+func LoadOrGenerateCertificate(certFile string, keyFile string, selfSigned bool, hosts []string) (tls.Certificate, error) {
+	if selfSigned && (certFile == "" || !util.Exists(certFile)) {
+		certPEM, keyPEM, err := GenerateSelfSigned(hosts)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		if certFile == "" {
+			return tls.X509KeyPair(certPEM, keyPEM)
+		}
+		err = os.WriteFile(certFile, certPEM, 0644)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		err = os.WriteFile(keyFile, keyPEM, 0600)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate's leaf, so clients can pin it.
+func Fingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
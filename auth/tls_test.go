@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	cert, err := LoadOrGenerateCertificate("", "", true, []string{"localhost", "127.0.0.1"})
+	assert.Nil(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"localhost"}, leaf.DNSNames)
+	assert.Equal(t, "127.0.0.1", leaf.IPAddresses[0].String())
+	assert.Len(t, Fingerprint(cert), 64)
+}
+
+func TestSelfSignedIsPersisted(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	first, err := LoadOrGenerateCertificate(certFile, keyFile, true, []string{"localhost"})
+	assert.Nil(t, err)
+	second, err := LoadOrGenerateCertificate(certFile, keyFile, true, []string{"localhost"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, Fingerprint(first), Fingerprint(second))
+}
+
+func TestMissingCertificateFiles(t *testing.T) {
+	_, err := LoadOrGenerateCertificate("/does/not/exist.pem", "/does/not/exist.key", false, nil)
+
+	assert.NotNil(t, err)
+}
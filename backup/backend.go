@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// Backends that can be set with backend in the backup config.
+const (
+	BackendGit      = "git"
+	BackendSnapshot = "snapshot"
+	BackendArchive  = "archive"
+)
+
+// Backend stores the backups of the todo and trash file.
+type Backend interface {
+	// Save creates a new backup of the todo and trash file.
+	Save(files *util.FileConfig, message string) (*Backup, error)
+	// List returns all backups, ordered from newest to oldest.
+	List(files *util.FileConfig) ([]*Backup, error)
+	// Get returns the backup with the identifier, which can also be abbreviated, or ErrBackupNotFound.
+	Get(files *util.FileConfig, id string) (*Backup, error)
+	// ReadFile returns the decrypted content of the file (the todo or trash file) in the backup,
+	// or false if the backup doesn't contain it.
+	ReadFile(files *util.FileConfig, b *Backup, file string) (string, bool, error)
+	// ReadStoredFile returns the content of the file in the backup as it is stored, i.e. encrypted if encryption
+	// was enabled, or false if the backup doesn't contain it.
+	ReadStoredFile(files *util.FileConfig, b *Backup, file string) (string, bool, error)
+	// Diff returns the unified diff of the todo file from the backup to against, or to the current todo file
+	// if against is nil.
+	Diff(files *util.FileConfig, b *Backup, against *Backup) (string, error)
+	// Remove deletes the backups. Returns the new identifier of kept backups whose identifier changed.
+	Remove(files *util.FileConfig, removed []*Backup) (map[string]string, error)
+	// RotateKey re-encrypts all backups, see RotateKey.
+	RotateKey(files *util.FileConfig, oldCryptor Cryptor, newCryptor Cryptor) (int, error)
+}
+
+var backendMutex sync.Mutex
+var backend Backend = &gitBackend{}
+
+// Configure sets the backend used by the package functions from the backup config. The default is git.
+func Configure(backupCfg *util.Config) error {
+	b, err := NewBackend(backupCfg)
+	if err != nil {
+		return err
+	}
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	backend = b
+	return nil
+}
+
+func currentBackend() Backend {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+	return backend
+}
+
+// NewBackend creates the backend configured in the backup config.
+func NewBackend(backupCfg *util.Config) (Backend, error) {
+	name := backupCfg.GetString("backend", BackendGit)
+	if name == BackendGit {
+		return &gitBackend{}, nil
+	}
+	if name != BackendSnapshot && name != BackendArchive {
+		return nil, fmt.Errorf("unknown backend %s, must be one of %s, %s, %s", name, BackendGit, BackendSnapshot, BackendArchive)
+	}
+	if HasRemotes(backupCfg) {
+		return nil, fmt.Errorf("remotes are only supported by the %s backend", BackendGit)
+	}
+
+	var cryptor Cryptor
+	if EncryptionEnabled(backupCfg) {
+		var err error
+		cryptor, err = NewCryptor(backupCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if name == BackendSnapshot {
+		return &snapshotBackend{cryptor: cryptor, newStore: func(todoDir string) snapshotStore {
+			return &dirStore{dir: resolvePath(todoDir, backupCfg.GetString("path", "backups"))}
+		}}, nil
+	}
+	return &snapshotBackend{cryptor: cryptor, newStore: func(todoDir string) snapshotStore {
+		return &archiveStore{file: resolvePath(todoDir, backupCfg.GetString("path", "backups.tar.zst"))}
+	}}, nil
+}
+
+// resolvePath resolves the path relative to the todo directory.
+func resolvePath(todoDir string, path string) string {
+	path = util.ExpandHome(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(todoDir, path)
+}
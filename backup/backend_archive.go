@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveStore stores all snapshots in a single tar archive, with a directory per snapshot. The archive is
+// compressed with zstd or gzip if the file ends with .tar.zst or .tar.gz. Each change rewrites the archive.
+type archiveStore struct {
+	file string
+	// The archive is read for each backup when loading the history, so it is cached until the file changes.
+	mu         sync.Mutex
+	cached     []*snapshot
+	cachedMod  time.Time
+	cachedSize int64
+}
+
+func (a *archiveStore) load() ([]*snapshot, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.doLoad()
+}
+
+func (a *archiveStore) doLoad() ([]*snapshot, error) {
+	info, err := os.Stat(a.file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if a.cached != nil && info.ModTime().Equal(a.cachedMod) && info.Size() == a.cachedSize {
+		return copySnapshots(a.cached), nil
+	}
+
+	f, err := os.Open(a.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := a.decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	byID := make(map[string]*snapshot)
+	var snaps []*snapshot
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid archive %s: %s", a.file, err)
+		}
+		id, name := path.Split(h.Name)
+		id = strings.TrimSuffix(id, "/")
+		if h.Typeflag != tar.TypeReg || id == "" {
+			continue
+		}
+		snap, found := byID[id]
+		if !found {
+			snap = &snapshot{files: make(map[string]string)}
+			byID[id] = snap
+			snaps = append(snaps, snap)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if name == snapshotMetaFile {
+			err = json.Unmarshal(data, &snap.Backup)
+			if err != nil {
+				return nil, fmt.Errorf("invalid snapshot %s in %s: %s", id, a.file, err)
+			}
+			snap.Timestamp = snap.Timestamp.Local()
+		} else {
+			snap.files[name] = string(data)
+		}
+	}
+
+	a.cached = snaps
+	a.cachedMod = info.ModTime()
+	a.cachedSize = info.Size()
+	return copySnapshots(snaps), nil
+}
+
+// copySnapshots copies the snapshots, so callers can change them without changing the cache.
+func copySnapshots(snaps []*snapshot) []*snapshot {
+	res := make([]*snapshot, len(snaps))
+	for i, s := range snaps {
+		c := &snapshot{Backup: s.Backup, files: make(map[string]string)}
+		for k, v := range s.files {
+			c.files[k] = v
+		}
+		res[i] = c
+	}
+	return res
+}
+
+func (a *archiveStore) save(changed []*snapshot, removed []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	snaps, err := a.doLoad()
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*snapshot)
+	for _, s := range snaps {
+		byID[s.Identifier] = s
+	}
+	for _, s := range changed {
+		byID[s.Identifier] = s
+	}
+	for _, id := range removed {
+		delete(byID, id)
+	}
+	snaps = make([]*snapshot, 0, len(byID))
+	for _, s := range byID {
+		snaps = append(snaps, s)
+	}
+	// Oldest first, so appending a snapshot only changes the end of the archive
+	sortSnapshots(snaps)
+	for i, j := 0, len(snaps)-1; i < j; i, j = i+1, j-1 {
+		snaps[i], snaps[j] = snaps[j], snaps[i]
+	}
+
+	a.cached = nil
+	return a.write(snaps)
+}
+
+// write writes the archive to a temporary file first, so the archive is never partially written.
+func (a *archiveStore) write(snaps []*snapshot) error {
+	err := os.MkdirAll(filepath.Dir(a.file), 0700)
+	if err != nil {
+		return err
+	}
+	tmpFile := a.file + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile)
+	defer f.Close()
+
+	w, err := a.compress(f)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for _, s := range snaps {
+		meta, err := json.MarshalIndent(s.Backup, "", "  ")
+		if err != nil {
+			return err
+		}
+		names := []string{snapshotMetaFile}
+		for name := range s.files {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+		for _, name := range names {
+			data := []byte(s.files[name])
+			if name == snapshotMetaFile {
+				data = meta
+			}
+			err = tw.WriteHeader(&tar.Header{Name: s.Identifier + "/" + name, Mode: 0600, Size: int64(len(data)),
+				ModTime: s.Timestamp, Typeflag: tar.TypeReg})
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, a.file)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func (a *archiveStore) compress(w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(a.file, ".zst"):
+		return zstd.NewWriter(w)
+	case strings.HasSuffix(a.file, ".gz"):
+		return gzip.NewWriter(w), nil
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+func (a *archiveStore) decompress(r io.Reader) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(a.file, ".zst"):
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case strings.HasSuffix(a.file, ".gz"):
+		return gzip.NewReader(r)
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/sandro-h/sibylgo/util"
+)
+
+var commitHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// gitBackend commits the backups to a git repository in the todo directory. Encryption is done by git filters,
+// see EnableGitEncryption.
+type gitBackend struct{}
+
+func (g *gitBackend) Save(files *util.FileConfig, message string) (*Backup, error) {
+	todoDir := filepath.Dir(files.TodoFile)
+	if !isRepoInitiated(todoDir) {
+		err := initRepo(todoDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	commit, err := commit(todoDir, message, sibylCommitAuthor, files.TodoFile, files.TrashFile)
+	if err != nil {
+		return nil, err
+	}
+	return toBackup(commit), nil
+}
+
+func (g *gitBackend) List(files *util.FileConfig) ([]*Backup, error) {
+	if !isRepoInitiated(files.TodoDir) {
+		return nil, nil
+	}
+	commits, err := findCommits(files.TodoDir, func(c *commitEntry) bool {
+		return c.AuthorEmail == sibylCommitAuthor
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []*Backup
+	for _, c := range commits {
+		backups = append(backups, toBackup(c))
+	}
+	return backups, nil
+}
+
+func (g *gitBackend) Get(files *util.FileConfig, id string) (*Backup, error) {
+	if !isRepoInitiated(files.TodoDir) || !commitHashPattern.MatchString(id) {
+		return nil, ErrBackupNotFound
+	}
+	c, err := findCommit(files.TodoDir, id)
+	if err != nil {
+		return nil, err
+	}
+	return toBackup(c), nil
+}
+
+// ReadFile uses git textconv, so encrypted backups are decrypted.
+func (g *gitBackend) ReadFile(files *util.FileConfig, b *Backup, file string) (string, bool, error) {
+	return showFile(files.TodoDir, b.Identifier, relPath(files.TodoDir, file))
+}
+
+func (g *gitBackend) ReadStoredFile(files *util.FileConfig, b *Backup, file string) (string, bool, error) {
+	return showStoredFile(files.TodoDir, b.Identifier, relPath(files.TodoDir, file))
+}
+
+func (g *gitBackend) Diff(files *util.FileConfig, b *Backup, against *Backup) (string, error) {
+	revs := []string{b.Identifier}
+	if against != nil {
+		revs = append(revs, against.Identifier)
+	}
+	return diff(files.TodoDir, relPath(files.TodoDir, files.TodoFile), revs...)
+}
+
+// Remove rewrites the history of the repository without the removed backups. Each removed backup is squashed
+// into the next newer kept commit, so the kept backups have the same content as before, but new identifiers.
+func (g *gitBackend) Remove(files *util.FileConfig, removed []*Backup) (map[string]string, error) {
+	removedIDs := make(map[string]bool)
+	for _, b := range removed {
+		removedIDs[b.Identifier] = true
+	}
+	commits, err := listCommits(files.TodoDir)
+	if err != nil {
+		return nil, err
+	}
+	keep := make([]bool, len(commits))
+	for i, c := range commits {
+		keep[i] = !removedIDs[c.Hash]
+	}
+
+	rewritten, err := rewriteHistory(files.TodoDir, commits, keep)
+	if err != nil {
+		return nil, err
+	}
+
+	// Actually free the space of the removed backups
+	_, err = runGitCmd(files.TodoDir, "git", "reflog", "expire", "--expire=now", "--all")
+	if err != nil {
+		return nil, err
+	}
+	_, err = runGitCmd(files.TodoDir, "git", "gc", "--prune=now", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+	return rewritten, nil
+}
+
+func toBackup(c *commitEntry) *Backup {
+	return &Backup{
+		Identifier: c.Hash,
+		Timestamp:  c.Timestamp,
+		Message:    c.Message,
+	}
+}
@@ -0,0 +1,359 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+const snapshotIDFormat = "20060102-150405.000"
+const snapshotMetaFile = "backup.json"
+
+// snapshot is a full copy of the todo and trash file.
+type snapshot struct {
+	Backup
+	// files maps the base name of the todo and trash file to their stored, possibly encrypted, content.
+	files map[string]string
+}
+
+// snapshotStore persists snapshots, e.g. in a directory or an archive.
+type snapshotStore interface {
+	// load returns all snapshots, in any order.
+	load() ([]*snapshot, error)
+	// save adds or replaces the changed snapshots and deletes the removed ones.
+	save(changed []*snapshot, removed []string) error
+}
+
+// snapshotBackend stores a full copy of the files per backup. The files are encrypted by the backend itself.
+type snapshotBackend struct {
+	cryptor  Cryptor
+	newStore func(todoDir string) snapshotStore
+	mu       sync.Mutex
+	stores   map[string]snapshotStore
+}
+
+func (s *snapshotBackend) store(files *util.FileConfig) snapshotStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stores == nil {
+		s.stores = make(map[string]snapshotStore)
+	}
+	st, found := s.stores[files.TodoDir]
+	if !found {
+		st = s.newStore(files.TodoDir)
+		s.stores[files.TodoDir] = st
+	}
+	return st
+}
+
+func (s *snapshotBackend) Save(files *util.FileConfig, message string) (*Backup, error) {
+	st := s.store(files)
+	existing, err := st.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Same location as when loaded from JSON
+	now := getNow().Local()
+	snap := &snapshot{Backup: Backup{Identifier: uniqueSnapshotID(existing, now), Timestamp: now, Message: message},
+		files: make(map[string]string)}
+	for _, f := range []string{files.TodoFile, files.TrashFile} {
+		if !util.Exists(f) {
+			continue
+		}
+		content, err := util.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if s.cryptor != nil {
+			var b bytes.Buffer
+			err = s.cryptor.EncryptContent(strings.NewReader(content), &b)
+			if err != nil {
+				return nil, err
+			}
+			content = b.String()
+		}
+		snap.files[filepath.Base(f)] = content
+	}
+
+	err = st.save([]*snapshot{snap}, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := snap.Backup
+	return &b, nil
+}
+
+func uniqueSnapshotID(existing []*snapshot, t time.Time) string {
+	ids := make(map[string]bool)
+	for _, s := range existing {
+		ids[s.Identifier] = true
+	}
+	id := t.Format(snapshotIDFormat)
+	for i := 1; ids[id]; i++ {
+		id = fmt.Sprintf("%s-%d", t.Format(snapshotIDFormat), i)
+	}
+	return id
+}
+
+func (s *snapshotBackend) List(files *util.FileConfig) ([]*Backup, error) {
+	snaps, err := s.store(files).load()
+	if err != nil {
+		return nil, err
+	}
+	sortSnapshots(snaps)
+	var backups []*Backup
+	for _, snap := range snaps {
+		b := snap.Backup
+		backups = append(backups, &b)
+	}
+	return backups, nil
+}
+
+// sortSnapshots sorts from newest to oldest.
+func sortSnapshots(snaps []*snapshot) {
+	sort.Slice(snaps, func(i, j int) bool {
+		if snaps[i].Timestamp.Equal(snaps[j].Timestamp) {
+			return snaps[i].Identifier > snaps[j].Identifier
+		}
+		return snaps[i].Timestamp.After(snaps[j].Timestamp)
+	})
+}
+
+func (s *snapshotBackend) Get(files *util.FileConfig, id string) (*Backup, error) {
+	snap, err := s.find(files, id)
+	if err != nil {
+		return nil, err
+	}
+	b := snap.Backup
+	return &b, nil
+}
+
+// find returns the snapshot with the id, or the only one whose id starts with it.
+func (s *snapshotBackend) find(files *util.FileConfig, id string) (*snapshot, error) {
+	snaps, err := s.store(files).load()
+	if err != nil {
+		return nil, err
+	}
+	var found *snapshot
+	for _, snap := range snaps {
+		if snap.Identifier == id {
+			return snap, nil
+		}
+		if id != "" && strings.HasPrefix(snap.Identifier, id) {
+			if found != nil {
+				return nil, ErrBackupNotFound
+			}
+			found = snap
+		}
+	}
+	if found == nil {
+		return nil, ErrBackupNotFound
+	}
+	return found, nil
+}
+
+func (s *snapshotBackend) ReadFile(files *util.FileConfig, b *Backup, file string) (string, bool, error) {
+	snap, err := s.find(files, b.Identifier)
+	if err != nil {
+		return "", false, err
+	}
+	content, found := snap.files[filepath.Base(file)]
+	if !found {
+		return "", false, nil
+	}
+	if s.cryptor == nil {
+		if IsEncrypted(content) {
+			return "", false, errors.New("backup is encrypted, but no encryption is configured")
+		}
+		return content, true, nil
+	}
+	var decrypted bytes.Buffer
+	err = s.cryptor.DecryptContent(strings.NewReader(content), &decrypted)
+	if err != nil {
+		return "", false, err
+	}
+	return decrypted.String(), true, nil
+}
+
+func (s *snapshotBackend) ReadStoredFile(files *util.FileConfig, b *Backup, file string) (string, bool, error) {
+	snap, err := s.find(files, b.Identifier)
+	if err != nil {
+		return "", false, err
+	}
+	content, found := snap.files[filepath.Base(file)]
+	return content, found, nil
+}
+
+func (s *snapshotBackend) Diff(files *util.FileConfig, b *Backup, against *Backup) (string, error) {
+	from, _, err := s.ReadFile(files, b, files.TodoFile)
+	if err != nil {
+		return "", err
+	}
+	var to string
+	if against != nil {
+		to, _, err = s.ReadFile(files, against, files.TodoFile)
+	} else if util.Exists(files.TodoFile) {
+		to, err = util.ReadFile(files.TodoFile)
+	}
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(files.TodoFile)
+	return unifiedDiff("a/"+name, "b/"+name, from, to)
+}
+
+func unifiedDiff(fromName string, toName string, from string, to string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+func (s *snapshotBackend) Remove(files *util.FileConfig, removed []*Backup) (map[string]string, error) {
+	var ids []string
+	for _, b := range removed {
+		ids = append(ids, b.Identifier)
+	}
+	return nil, s.store(files).save(nil, ids)
+}
+
+func (s *snapshotBackend) RotateKey(files *util.FileConfig, oldCryptor Cryptor, newCryptor Cryptor) (int, error) {
+	st := s.store(files)
+	snaps, err := st.load()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, snap := range snaps {
+		for name, content := range snap.files {
+			snap.files[name], err = reencrypt(name, content, oldCryptor, newCryptor)
+			if err != nil {
+				return 0, fmt.Errorf("backup %s: %w", snap.Identifier, err)
+			}
+			count++
+		}
+	}
+	return count, st.save(snaps, nil)
+}
+
+// dirStore stores each snapshot in its own subdirectory.
+type dirStore struct {
+	dir string
+}
+
+func (d *dirStore) load() ([]*snapshot, error) {
+	if !util.Exists(d.dir) {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []*snapshot
+	for _, e := range entries {
+		snapDir := filepath.Join(d.dir, e.Name())
+		if !e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") || !util.Exists(filepath.Join(snapDir, snapshotMetaFile)) {
+			// Not a (complete) snapshot
+			continue
+		}
+		snap, err := d.loadSnapshot(snapDir)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+func (d *dirStore) loadSnapshot(snapDir string) (*snapshot, error) {
+	entries, err := os.ReadDir(snapDir)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{files: make(map[string]string)}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		content, err := util.ReadFile(filepath.Join(snapDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if e.Name() == snapshotMetaFile {
+			err = json.Unmarshal([]byte(content), &snap.Backup)
+			if err != nil {
+				return nil, fmt.Errorf("invalid snapshot %s: %s", snapDir, err)
+			}
+			snap.Timestamp = snap.Timestamp.Local()
+		} else {
+			snap.files[e.Name()] = content
+		}
+	}
+	return snap, nil
+}
+
+func (d *dirStore) save(changed []*snapshot, removed []string) error {
+	for _, snap := range changed {
+		err := d.saveSnapshot(snap)
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range removed {
+		err := os.RemoveAll(filepath.Join(d.dir, id))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveSnapshot writes the snapshot to a temporary directory first, so there are no partial snapshots.
+func (d *dirStore) saveSnapshot(snap *snapshot) error {
+	snapDir := filepath.Join(d.dir, snap.Identifier)
+	tmpDir := snapDir + ".tmp"
+	err := os.RemoveAll(tmpDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(tmpDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	for name, content := range snap.files {
+		err = os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600)
+		if err != nil {
+			return err
+		}
+	}
+	meta, err := json.MarshalIndent(snap.Backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(tmpDir, snapshotMetaFile), meta, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(snapDir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, snapDir)
+}
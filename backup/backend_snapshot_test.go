@@ -0,0 +1,179 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var snapshotBackendConfigs = []string{
+	"backend: snapshot",
+	"backend: archive",
+	"backend: archive\npath: archives/backups.tar.gz",
+	"backend: archive\npath: backups.tar",
+}
+
+func TestSnapshotBackends(t *testing.T) {
+	for _, cfg := range snapshotBackendConfigs {
+		t.Run(cfg, func(t *testing.T) {
+			todoDir := tu.MakeTempDir("sibyl_backup_test")
+			defer tu.DeleteTempDir(todoDir)
+			useBackend(t, cfg)
+			defer resetBackend()
+			files := util.NewFileConfigFromTodoFile(filepath.Join(todoDir, "todo.txt"))
+			setFakeTime("13.01.2019 12:00:00")
+			defer resetOriginalTime()
+
+			util.WriteFile(files.TodoFile, "[] line 1\n")
+			backup1, err := Save(files, "save 1")
+			assert.NoError(t, err)
+			util.WriteFile(files.TodoFile, "[] line 1\n[] line 2\n")
+			util.WriteFile(files.TrashFile, "[x] trashed\n")
+			backup2, _ := Save(files, "save 2")
+			util.WriteFile(files.TodoFile, "[] line 2\n")
+
+			// Same time, but unique ids
+			assert.Equal(t, "20190113-120000.000", backup1.Identifier)
+			assert.Equal(t, "20190113-120000.000-1", backup2.Identifier)
+			backups, err := ListBackups(files)
+			assert.NoError(t, err)
+			assert.Equal(t, []*Backup{backup2, backup1}, backups)
+
+			content, err := Content(files, backup1.Identifier)
+			assert.NoError(t, err)
+			assert.Equal(t, "[] line 1\n", content)
+			diff, err := Diff(files, backup1.Identifier, backup2.Identifier)
+			assert.NoError(t, err)
+			tu.AssertContains(t, " [] line 1\n+[] line 2\n", diff)
+			diff, _ = Diff(files, backup2.Identifier, "")
+			tu.AssertContains(t, "-[] line 1\n [] line 2\n", diff)
+
+			_, err = Restore(files, backup1)
+			assert.NoError(t, err)
+			restored, _ := util.ReadFile(files.TodoFile)
+			assert.Equal(t, "[] line 1\n", restored)
+			assert.False(t, util.Exists(files.TrashFile), "trash file did not exist in backup 1")
+			backups, _ = ListBackups(files)
+			assert.Equal(t, 3, len(backups))
+			_, err = GetBackup(files, "20190113")
+			assert.Equal(t, ErrBackupNotFound, err, "ambiguous prefix")
+		})
+	}
+}
+
+func TestSnapshotBackends_Encrypted(t *testing.T) {
+	for _, cfg := range snapshotBackendConfigs {
+		t.Run(cfg, func(t *testing.T) {
+			todoDir := tu.MakeTempDir("sibyl_backup_test")
+			defer tu.DeleteTempDir(todoDir)
+			useBackend(t, cfg+"\nencryption: aes-gcm\nencrypt_password: password123")
+			defer resetBackend()
+			files := util.NewFileConfigFromTodoFile(filepath.Join(todoDir, "todo.txt"))
+			util.WriteFile(files.TodoFile, "[] secret moment\n")
+
+			b, err := Save(files, "save 1")
+
+			assert.NoError(t, err)
+			assertNoPlaintextInBackups(t, todoDir, "secret moment")
+			content, err := Content(files, b.Identifier)
+			assert.NoError(t, err)
+			assert.Equal(t, "[] secret moment\n", content)
+
+			// Rotate the key
+			newCryptor := &AESGCMCryptor{Password: "new password"}
+			count, err := RotateKey(files, &AESGCMCryptor{Password: "password123"}, newCryptor)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, count)
+			useBackend(t, cfg+"\nencryption: aes-gcm\nencrypt_password: new password\nstrict_encryption: true")
+			content, err = Content(files, b.Identifier)
+			assert.NoError(t, err)
+			assert.Equal(t, "[] secret moment\n", content)
+		})
+	}
+}
+
+func TestSnapshotBackends_Prune(t *testing.T) {
+	for _, cfg := range snapshotBackendConfigs {
+		t.Run(cfg, func(t *testing.T) {
+			todoDir := tu.MakeTempDir("sibyl_backup_test")
+			defer tu.DeleteTempDir(todoDir)
+			useBackend(t, cfg)
+			defer resetBackend()
+			files, backups := makeBackupsOnDays(todoDir, 1, 1, 2, 3, 3, 3)
+			setFakeTime("05.01.2019 11:30:00")
+			defer resetOriginalTime()
+			policy := &RetentionPolicy{KeepAll: Age{Days: 2}, KeepDaily: Age{Forever: true}}
+
+			report, err := Prune(files, policy, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"save 5", "save 4", "save 3", "save 2", "save 1"}, messages(report.Kept))
+			assert.Equal(t, []string{"save 0"}, messages(report.Removed))
+			remaining, _ := ListBackups(files)
+			assert.Equal(t, report.Kept, remaining)
+			// Snapshots are independent, so ids don't change
+			assert.Equal(t, backups[1], remaining[4])
+			content, _ := Content(files, remaining[4].Identifier)
+			assert.Equal(t, "content 1\n", content)
+			_, err = GetBackup(files, backups[0].Identifier)
+			assert.Equal(t, ErrBackupNotFound, err)
+		})
+	}
+}
+
+func TestSnapshotBackend_DailyBackup(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	useBackend(t, "backend: snapshot\npath: "+filepath.Join(todoDir, "elsewhere"))
+	defer resetBackend()
+	files := util.NewFileConfigFromTodoFile(filepath.Join(todoDir, "todo.txt"))
+	util.WriteFile(files.TodoFile, "my todo content 1")
+	setFakeTime("13.01.2019 12:02:42")
+	defer resetOriginalTime()
+
+	first, _ := CheckAndMakeDailyBackup(files)
+	setFakeTime("13.01.2019 18:00:00")
+	second, _ := CheckAndMakeDailyBackup(files)
+
+	assert.Equal(t, "Daily backup for 13.01.2019", first.Message)
+	assert.Nil(t, second)
+	assert.True(t, util.Exists(filepath.Join(todoDir, "elsewhere", first.Identifier, "todo.txt")))
+}
+
+func TestNewBackend(t *testing.T) {
+	cfg, _ := util.LoadConfigString("backend: tape")
+	_, err := NewBackend(cfg)
+	assert.EqualError(t, err, "unknown backend tape, must be one of git, snapshot, archive")
+
+	cfg, _ = util.LoadConfigString("backend: snapshot\nremote_url: https://git.example.com/todos")
+	_, err = NewBackend(cfg)
+	assert.EqualError(t, err, "remotes are only supported by the git backend")
+
+	cfg, _ = util.LoadConfigString("")
+	b, err := NewBackend(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, &gitBackend{}, b)
+}
+
+func useBackend(t *testing.T, cfgStr string) {
+	cfg, _ := util.LoadConfigString(cfgStr)
+	assert.NoError(t, Configure(cfg))
+}
+
+func resetBackend() {
+	backend = &gitBackend{}
+}
+
+func assertNoPlaintextInBackups(t *testing.T, todoDir string, plaintext string) {
+	filepath.Walk(todoDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && path != filepath.Join(todoDir, "todo.txt") {
+			content, _ := util.ReadFile(path)
+			assert.NotContains(t, content, plaintext, path)
+		}
+		return nil
+	})
+}
@@ -1,11 +1,16 @@
 package backup
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/sandro-h/sibylgo/metrics"
+	"github.com/sandro-h/sibylgo/status"
 	"github.com/sandro-h/sibylgo/util"
 	log "github.com/sirupsen/logrus"
 )
@@ -13,57 +18,84 @@ import (
 const sibylCommitAuthor = "sibylgo@example.com"
 const dailyBackupPrefix = "Daily backup for "
 
+// ErrBackupNotFound is returned if there is no backup with the requested identifier.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// ErrRemoteChanged is returned if the remote branch was changed by someone else since the last push,
+// so it is not overwritten with the local history.
+var ErrRemoteChanged = errors.New("remote backup branch was changed since the last push")
+
+// repoMutex serializes changes to the backups.
+var repoMutex sync.Mutex
+
 var getNow = func() time.Time {
 	return time.Now()
 }
 
+var backupFailuresTotal = metrics.NewCounterVec("sibylgo_backup_failures_total",
+	"Number of failed backups of the todo file.")
+var remoteSyncFailuresTotal = metrics.NewCounterVec("sibylgo_remote_sync_failures_total",
+	"Number of failed pushes of the backups to the remote.")
+
 // Save creates a new backup of the todo file
 func Save(files *util.FileConfig, message string) (*Backup, error) {
-	todoDir := filepath.Dir(files.TodoFile)
-	if !isRepoInitiated(todoDir) {
-		err := initRepo(todoDir)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	commit, err := commit(todoDir, message, sibylCommitAuthor, files.TodoFile, files.TrashFile)
+	backup, err := save(files, message)
+	status.RecordBackup(message, err)
 	if err != nil {
-		return nil, err
+		backupFailuresTotal.Inc()
 	}
+	return backup, err
+}
 
-	backup := toBackup(commit)
-	return backup, nil
+func save(files *util.FileConfig, message string) (*Backup, error) {
+	repoMutex.Lock()
+	defer repoMutex.Unlock()
+	return currentBackend().Save(files, message)
 }
 
-// Restore restores the todoFile to the passed backup and creates a new backup for this restored state.
+// Restore restores the todoFile and trash file to the passed backup and creates a new backup for this restored state.
 // It does not delete any of the intermediate backups that were reverted, so it's still possible to restore
-// a different state.
+// a different state. Encrypted backups are decrypted.
 func Restore(files *util.FileConfig, restoreTo *Backup) (*Backup, error) {
-	todoDir := filepath.Dir(files.TodoFile)
-	if !isRepoInitiated(todoDir) {
-		return nil, fmt.Errorf("no backups set up for %s", files.TodoDir)
+	repoMutex.Lock()
+	defer repoMutex.Unlock()
+
+	b := currentBackend()
+	for _, f := range []string{files.TodoFile, files.TrashFile} {
+		err := restoreFile(b, files, restoreTo, f)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	restoreMessage := fmt.Sprintf("Restore backup %s '%s'", restoreTo.Identifier, restoreTo.Message)
-	revertCommit, err := revertToCommit(todoDir, restoreTo.Identifier, restoreMessage, sibylCommitAuthor)
+	restoreMessage := fmt.Sprintf("Restore backup %s '%s'", restoreTo.Identifier, restoreTo.Subject())
+	return b.Save(files, restoreMessage)
+}
+
+func restoreFile(b Backend, files *util.FileConfig, restoreTo *Backup, file string) error {
+	content, found, err := b.ReadFile(files, restoreTo, file)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	restoreBackup := toBackup(revertCommit)
-	return restoreBackup, nil
+	if !found {
+		// File didn't exist yet at the time of the backup
+		if util.Exists(file) {
+			return os.Remove(file)
+		}
+		return nil
+	}
+	return os.WriteFile(file, []byte(content), 0644)
 }
 
 // CheckAndMakeDailyBackup creates a daily backup of the todofile if there isn't one already for today.
 func CheckAndMakeDailyBackup(files *util.FileConfig) (*Backup, error) {
-	newestDailyCommitDate, err := findNewestDailyCommitTimestamp(files.TodoDir)
+	newestDailyBackupDate, err := findNewestDailyBackupTimestamp(files)
 	if err != nil {
 		return nil, err
 	}
 
 	today := util.SetToStartOfDay(getNow())
-	if !today.After(newestDailyCommitDate) {
+	if !today.After(newestDailyBackupDate) {
 		// Already have a daily backup for today
 		return nil, nil
 	}
@@ -72,64 +104,79 @@ func CheckAndMakeDailyBackup(files *util.FileConfig) (*Backup, error) {
 	return Save(files, fmt.Sprintf("%s%s", dailyBackupPrefix, today.Format("02.01.2006")))
 }
 
-// SyncToRemote pushes the backup to the remote location defined in the backup configuration.
-func SyncToRemote(backupCfg *util.Config, files *util.FileConfig) error {
-	log.Infof("Pushing backup to remote %s\n", backupCfg.GetStringOrFail("remote_url"))
-
-	return push(files.TodoDir,
-		backupCfg.GetString("remote_url", ""),
-		backupCfg.GetString("remote_user", ""),
-		backupCfg.GetString("remote_password", ""))
-}
-
-// findNewestDailyCommitTimestamp returns the timestamp of the newest daily backup commit,
-// or the base epoch time if there is no daily backup commit yet.
-func findNewestDailyCommitTimestamp(todoDir string) (time.Time, error) {
-	if !isRepoInitiated(todoDir) {
-		return time.Unix(0, 0), nil
-	}
-
-	newestDailyCommit, err := findNewestCommit(todoDir, func(c *commitEntry) bool {
-		return c.AuthorEmail == sibylCommitAuthor &&
-			strings.HasPrefix(c.Message, dailyBackupPrefix)
-	})
+// findNewestDailyBackupTimestamp returns the timestamp of the newest daily backup,
+// or the base epoch time if there is no daily backup yet.
+func findNewestDailyBackupTimestamp(files *util.FileConfig) (time.Time, error) {
+	backups, err := currentBackend().List(files)
 	if err != nil {
 		return time.Unix(0, 0), nil
 	}
-	if newestDailyCommit != nil {
-		return newestDailyCommit.Timestamp, nil
+	for _, b := range backups {
+		if strings.HasPrefix(b.Message, dailyBackupPrefix) {
+			return b.Timestamp, nil
+		}
 	}
 	return time.Unix(0, 0), nil
 }
 
 // ListBackups lists all backups saved for the todoFile. They are ordered from newest to oldest backup.
-func ListBackups(todoDir string) ([]*Backup, error) {
-	commits, err := findCommits(todoDir, func(c *commitEntry) bool {
-		return c.AuthorEmail == sibylCommitAuthor
-	})
+func ListBackups(files *util.FileConfig) ([]*Backup, error) {
+	return currentBackend().List(files)
+}
+
+// GetBackup returns the backup with the identifier, which can also be abbreviated.
+func GetBackup(files *util.FileConfig, id string) (*Backup, error) {
+	return currentBackend().Get(files, id)
+}
+
+// Content returns the content of the todo file in the backup. Encrypted backups are decrypted.
+func Content(files *util.FileConfig, id string) (string, error) {
+	b, err := GetBackup(files, id)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	content, found, err := TodoContent(files, b)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("backup %s does not contain %s", id, filepath.Base(files.TodoFile))
+	}
+	return content, nil
+}
+
+// TodoContent returns the content of the todo file in the backup, or false if the backup doesn't contain it.
+// Encrypted backups are decrypted.
+func TodoContent(files *util.FileConfig, b *Backup) (string, bool, error) {
+	return currentBackend().ReadFile(files, b, files.TodoFile)
+}
 
-	var backups []*Backup
-	for _, c := range commits {
-		backups = append(backups, toBackup(c))
+// Diff returns a unified diff of the todo file from the backup to the backup against, or
+// to the current todo file if against is empty. Encrypted backups are decrypted.
+func Diff(files *util.FileConfig, id string, against string) (string, error) {
+	b, err := GetBackup(files, id)
+	if err != nil {
+		return "", err
 	}
-	return backups, nil
+	var againstBackup *Backup
+	if against != "" {
+		againstBackup, err = GetBackup(files, against)
+		if err != nil {
+			return "", err
+		}
+	}
+	return currentBackend().Diff(files, b, againstBackup)
 }
 
 // Backup denotes a specific backup of the todofile. It doesn't contain the content, but
 // acts as a reference for restoring.
 type Backup struct {
-	Identifier string
-	Timestamp  time.Time
-	Message    string
+	Identifier string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Message    string    `json:"message"`
 }
 
-func toBackup(c *commitEntry) *Backup {
-	return &Backup{
-		Identifier: c.Hash,
-		Timestamp:  c.Timestamp,
-		Message:    c.Message,
-	}
+// Subject returns the first line of the message.
+func (b *Backup) Subject() string {
+	return strings.TrimSpace(strings.SplitN(b.Message, "\n", 2)[0])
 }
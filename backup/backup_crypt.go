@@ -1,22 +1,106 @@
 package backup
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 
+	"github.com/sandro-h/sibylgo/util"
 	vault "github.com/sosedoff/ansible-vault-go"
 )
 
+// ErrNotEncrypted is returned by strict cryptors for content that is not encrypted,
+// and when pushing backups that contain unencrypted content in strict mode.
+var ErrNotEncrypted = errors.New("content is not encrypted")
+
 // Cryptor provides methods to encrypt and decrypt backup content.
 type Cryptor interface {
 	EncryptContent(in io.Reader, out io.Writer) error
+	// DecryptContent decrypts the content. Unless the cryptor is strict, content that
+	// can't be decrypted is passed through.
 	DecryptContent(in io.Reader, out io.Writer) error
+	// DecryptString decrypts content encrypted with EncryptContent. It always fails if the content
+	// cannot be decrypted.
+	DecryptString(content string) (string, error)
+}
+
+// Encryption types that can be set with encryption in the backup config.
+const (
+	EncryptionAnsible = "ansible"
+	EncryptionAge     = "age"
+	EncryptionAESGCM  = "aes-gcm"
+)
+
+const ansibleHeader = "$ANSIBLE_VAULT;"
+
+// IsEncrypted returns true if the content looks like it was encrypted by one of the cryptors.
+func IsEncrypted(content string) bool {
+	for _, h := range []string{ansibleHeader, ageHeader, aesGCMHeader} {
+		if strings.HasPrefix(content, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptionEnabled returns true if the backup config enables encryption.
+func EncryptionEnabled(backupCfg *util.Config) bool {
+	return backupCfg.HasKey("encryption") || backupCfg.HasKey("encrypt_password")
+}
+
+// NewCryptor creates the cryptor configured in the backup config. The encryption defaults to ansible.
+func NewCryptor(backupCfg *util.Config) (Cryptor, error) {
+	strict := backupCfg.GetBool("strict_encryption", false)
+	switch backupCfg.GetString("encryption", EncryptionAnsible) {
+	case EncryptionAnsible:
+		if !backupCfg.HasKey("encrypt_password") {
+			return nil, errors.New("encrypt_password must be set")
+		}
+		return &AnsibleCryptor{Password: backupCfg.GetString("encrypt_password", ""), Strict: strict}, nil
+	case EncryptionAESGCM:
+		if !backupCfg.HasKey("encrypt_password") {
+			return nil, errors.New("encrypt_password must be set")
+		}
+		return &AESGCMCryptor{Password: backupCfg.GetString("encrypt_password", ""), Strict: strict}, nil
+	case EncryptionAge:
+		return newAgeCryptorFromConfig(backupCfg, strict)
+	default:
+		return nil, fmt.Errorf("unknown encryption %s, must be one of %s, %s, %s",
+			backupCfg.GetString("encryption", ""), EncryptionAnsible, EncryptionAge, EncryptionAESGCM)
+	}
+}
+
+// decryptOrPassThrough writes the decrypted content. If it can't be decrypted, it writes the content as is,
+// or fails if strict.
+func decryptOrPassThrough(c Cryptor, strict bool, in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	str, err := c.DecryptString(string(data))
+	if err == nil {
+		_, err = out.Write([]byte(str))
+		return err
+	}
+	if strict {
+		if !IsEncrypted(string(data)) {
+			return ErrNotEncrypted
+		}
+		return err
+	}
+	_, err = out.Write(data)
+	return err
 }
 
 // AnsibleCryptor uses the same mechanism as Ansible Vaults to
 // encrypt backup content using a user-provided password.
 type AnsibleCryptor struct {
 	Password string
+	// Strict makes DecryptContent fail for content that can't be decrypted.
+	Strict bool
 }
 
 // EncryptContent encrypts the backup content using Ansible Vault style encryption
@@ -40,17 +124,10 @@ func (c *AnsibleCryptor) EncryptContent(in io.Reader, out io.Writer) error {
 // DecryptContent decrypts the backup content using Ansible Vault style encryption
 // with the user-provided password.
 func (c *AnsibleCryptor) DecryptContent(in io.Reader, out io.Writer) error {
-	data, err := ioutil.ReadAll(in)
-	if err != nil {
-		return err
-	}
-
-	str, err := vault.Decrypt(string(data), c.Password)
-	if err == nil {
-		out.Write([]byte(str))
-	} else {
-		out.Write(data)
-	}
+	return decryptOrPassThrough(c, c.Strict, in, out)
+}
 
-	return nil
+// DecryptString decrypts content encrypted with EncryptContent.
+func (c *AnsibleCryptor) DecryptString(content string) (string, error) {
+	return vault.Decrypt(content, c.Password)
 }
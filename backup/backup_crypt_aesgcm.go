@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const aesGCMHeader = "$SIBYLGO_AESGCM;"
+
+// Argon2id parameters, recorded in the header so they can be raised later without breaking old backups.
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	aesSaltLen   = 16
+	aesLineLen   = 64
+)
+
+// Bounds of the Argon2id parameters accepted from the header, so tampered content can't make the key
+// derivation panic or exhaust the memory.
+const (
+	maxArgonTime    = 10
+	minArgonMemory  = 8 * 1024
+	maxArgonMemory  = 1024 * 1024
+	maxArgonThreads = 16
+)
+
+// AESGCMCryptor encrypts backup content with AES-256-GCM. The key is derived from the
+// user-provided password with Argon2id and a random salt per encryption.
+type AESGCMCryptor struct {
+	Password string
+	// Strict makes DecryptContent fail for content that can't be decrypted.
+	Strict bool
+}
+
+// EncryptContent encrypts the backup content with AES-256-GCM.
+func (c *AESGCMCryptor) EncryptContent(in io.Reader, out io.Writer) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, aesSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := c.newGCM(salt, argonTime, argonMemory, argonThreads)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = gcm.Seal(sealed, nonce, data, []byte(aesGCMHeader))
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s1;argon2id;t=%d,m=%d,p=%d\n", aesGCMHeader, argonTime, argonMemory, argonThreads)
+	for len(encoded) > aesLineLen {
+		sb.WriteString(encoded[:aesLineLen] + "\n")
+		encoded = encoded[aesLineLen:]
+	}
+	sb.WriteString(encoded + "\n")
+	_, err = out.Write([]byte(sb.String()))
+	return err
+}
+
+// DecryptContent decrypts the backup content with AES-256-GCM.
+func (c *AESGCMCryptor) DecryptContent(in io.Reader, out io.Writer) error {
+	return decryptOrPassThrough(c, c.Strict, in, out)
+}
+
+// DecryptString decrypts content encrypted with EncryptContent.
+func (c *AESGCMCryptor) DecryptString(content string) (string, error) {
+	if !strings.HasPrefix(content, aesGCMHeader) {
+		return "", ErrNotEncrypted
+	}
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+
+	var version int
+	var t, m uint32
+	var p uint8
+	_, err := fmt.Sscanf(strings.TrimPrefix(lines[0], aesGCMHeader), "%d;argon2id;t=%d,m=%d,p=%d", &version, &t, &m, &p)
+	if err != nil || version != 1 {
+		return "", fmt.Errorf("invalid aes-gcm header: %s", lines[0])
+	}
+	if t < 1 || t > maxArgonTime || m < minArgonMemory || m > maxArgonMemory || p < 1 || p > maxArgonThreads {
+		return "", fmt.Errorf("unsupported argon2id parameters t=%d,m=%d,p=%d", t, m, p)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:], ""))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aesSaltLen {
+		return "", errors.New("aes-gcm content too short")
+	}
+	gcm, err := c.newGCM(sealed[:aesSaltLen], t, m, p)
+	if err != nil {
+		return "", err
+	}
+	sealed = sealed[aesSaltLen:]
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("aes-gcm content too short")
+	}
+
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(aesGCMHeader))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *AESGCMCryptor) newGCM(salt []byte, t uint32, m uint32, p uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(c.Password), salt, t, m, p, argonKeyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+const ageHeader = armor.Header
+
+// AgeCryptor encrypts backup content with age (https://age-encryption.org), either to X25519 recipients
+// or with a passphrase. The output is ASCII-armored, so it can be stored and diffed like text.
+type AgeCryptor struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+	// Strict makes DecryptContent fail for content that can't be decrypted.
+	Strict bool
+}
+
+// newAgeCryptorFromConfig creates an age cryptor from the backup config. Either age_identity_file
+// (with optional age_recipients to encrypt to additional keys) or encrypt_password as passphrase must be set.
+func newAgeCryptorFromConfig(backupCfg *util.Config, strict bool) (*AgeCryptor, error) {
+	c := &AgeCryptor{Strict: strict}
+	if backupCfg.HasKey("age_identity_file") {
+		f, err := os.Open(util.ExpandHome(backupCfg.GetString("age_identity_file", "")))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		c.Identities, err = age.ParseIdentities(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range c.Identities {
+			if x, ok := i.(*age.X25519Identity); ok {
+				c.Recipients = append(c.Recipients, x.Recipient())
+			}
+		}
+		for _, s := range backupCfg.GetStringList("age_recipients", nil) {
+			r, err := age.ParseX25519Recipient(s)
+			if err != nil {
+				return nil, err
+			}
+			c.Recipients = append(c.Recipients, r)
+		}
+		return c, nil
+	}
+
+	if backupCfg.HasKey("encrypt_password") {
+		password := backupCfg.GetString("encrypt_password", "")
+		r, err := age.NewScryptRecipient(password)
+		if err != nil {
+			return nil, err
+		}
+		i, err := age.NewScryptIdentity(password)
+		if err != nil {
+			return nil, err
+		}
+		c.Recipients = []age.Recipient{r}
+		c.Identities = []age.Identity{i}
+		return c, nil
+	}
+	return nil, errors.New("age encryption needs age_identity_file or encrypt_password")
+}
+
+// EncryptContent encrypts the backup content with age.
+func (c *AgeCryptor) EncryptContent(in io.Reader, out io.Writer) error {
+	armored := armor.NewWriter(out)
+	w, err := age.Encrypt(armored, c.Recipients...)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, in)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return armored.Close()
+}
+
+// DecryptContent decrypts the backup content with age.
+func (c *AgeCryptor) DecryptContent(in io.Reader, out io.Writer) error {
+	return decryptOrPassThrough(c, c.Strict, in, out)
+}
+
+// DecryptString decrypts content encrypted with EncryptContent.
+func (c *AgeCryptor) DecryptString(content string) (string, error) {
+	if !strings.HasPrefix(content, ageHeader) {
+		return "", ErrNotEncrypted
+	}
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(content)), c.Identities...)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	_, err = io.Copy(&b, r)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAESGCMCryptor(t *testing.T) {
+	cryptor := &AESGCMCryptor{Password: "password123"}
+	content := strings.Repeat("[] some moment\n", 10)
+
+	encrypted := encrypt(t, cryptor, content)
+
+	assert.True(t, strings.HasPrefix(encrypted, "$SIBYLGO_AESGCM;1;argon2id;t=1,m=65536,p=4\n"))
+	assert.NotContains(t, encrypted, "some moment")
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotEqual(t, encrypted, encrypt(t, cryptor, content), "expected random salt and nonce")
+	assert.Equal(t, content, decrypt(t, cryptor, encrypted))
+}
+
+func TestAESGCMCryptor_WrongPassword(t *testing.T) {
+	encrypted := encrypt(t, &AESGCMCryptor{Password: "password123"}, "secret")
+
+	_, err := (&AESGCMCryptor{Password: "other"}).DecryptString(encrypted)
+
+	assert.Error(t, err)
+}
+
+func TestAESGCMCryptor_Tampered(t *testing.T) {
+	cryptor := &AESGCMCryptor{Password: "password123"}
+	encrypted := encrypt(t, cryptor, "secret")
+	lines := strings.Split(encrypted, "\n")
+	lines[1] = "A" + lines[1][1:]
+
+	_, err := cryptor.DecryptString(strings.Join(lines, "\n"))
+
+	assert.Error(t, err)
+}
+
+func TestAESGCMCryptor_TamperedHeader(t *testing.T) {
+	cryptor := &AESGCMCryptor{Password: "password123"}
+	encrypted := encrypt(t, cryptor, "secret")
+
+	for _, params := range []string{"t=1,m=65536,p=0", "t=1,m=4194304,p=4", "t=0,m=65536,p=4", "t=1000,m=65536,p=4"} {
+		tampered := strings.Replace(encrypted, "t=1,m=65536,p=4", params, 1)
+
+		_, err := cryptor.DecryptString(tampered)
+
+		assert.EqualError(t, err, "unsupported argon2id parameters "+params)
+	}
+}
+
+func TestAgeCryptor_X25519(t *testing.T) {
+	dir := tu.MakeTempDir("sibyl_crypt_test")
+	defer tu.DeleteTempDir(dir)
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+	identityFile := filepath.Join(dir, "key.txt")
+	util.WriteFile(identityFile, "# test key\n"+identity.String()+"\n")
+	cfg, _ := util.LoadConfigString(`
+encryption: age
+age_identity_file: ` + identityFile + `
+age_recipients:
+  - ` + other.Recipient().String())
+
+	cryptor, err := NewCryptor(cfg)
+	assert.NoError(t, err)
+	encrypted := encrypt(t, cryptor, "[] secret moment\n")
+
+	assert.True(t, strings.HasPrefix(encrypted, "-----BEGIN AGE ENCRYPTED FILE-----\n"))
+	assert.True(t, IsEncrypted(encrypted))
+	assert.Equal(t, "[] secret moment\n", decrypt(t, cryptor, encrypted))
+	// The additional recipient can decrypt too
+	otherCryptor := &AgeCryptor{Identities: []age.Identity{other}}
+	assert.Equal(t, "[] secret moment\n", decrypt(t, otherCryptor, encrypted))
+}
+
+func TestAgeCryptor_Passphrase(t *testing.T) {
+	cfg, _ := util.LoadConfigString("encryption: age\nencrypt_password: password123")
+	cryptor, err := NewCryptor(cfg)
+	assert.NoError(t, err)
+
+	encrypted := encrypt(t, cryptor, "secret")
+
+	assert.Equal(t, "secret", decrypt(t, cryptor, encrypted))
+	wrongCfg, _ := util.LoadConfigString("encryption: age\nencrypt_password: other")
+	wrong, _ := NewCryptor(wrongCfg)
+	_, err = wrong.DecryptString(encrypted)
+	assert.Error(t, err)
+}
+
+func TestDecryptContent_PassThrough(t *testing.T) {
+	for _, cryptor := range []Cryptor{
+		&AnsibleCryptor{Password: "password123"},
+		&AESGCMCryptor{Password: "password123"},
+	} {
+		var b bytes.Buffer
+		err := cryptor.DecryptContent(strings.NewReader("not encrypted"), &b)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "not encrypted", b.String())
+	}
+}
+
+func TestDecryptContent_Strict(t *testing.T) {
+	cryptor := &AESGCMCryptor{Password: "password123", Strict: true}
+	var b bytes.Buffer
+
+	err := cryptor.DecryptContent(strings.NewReader("not encrypted"), &b)
+
+	assert.True(t, errors.Is(err, ErrNotEncrypted))
+	assert.Empty(t, b.String())
+
+	encrypted := encrypt(t, &AESGCMCryptor{Password: "other"}, "secret")
+	err = cryptor.DecryptContent(strings.NewReader(encrypted), &b)
+	assert.Error(t, err)
+	assert.Empty(t, b.String())
+}
+
+func TestNewCryptor(t *testing.T) {
+	cfg, _ := util.LoadConfigString("encrypt_password: password123")
+	cryptor, err := NewCryptor(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, &AnsibleCryptor{Password: "password123"}, cryptor)
+
+	cfg, _ = util.LoadConfigString("encryption: aes-gcm\nencrypt_password: password123\nstrict_encryption: true")
+	cryptor, err = NewCryptor(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, &AESGCMCryptor{Password: "password123", Strict: true}, cryptor)
+
+	cfg, _ = util.LoadConfigString("encryption: aes-gcm")
+	_, err = NewCryptor(cfg)
+	assert.EqualError(t, err, "encrypt_password must be set")
+
+	cfg, _ = util.LoadConfigString("encryption: rot13")
+	_, err = NewCryptor(cfg)
+	assert.EqualError(t, err, "unknown encryption rot13, must be one of ansible, age, aes-gcm")
+}
+
+func TestIsEncrypted(t *testing.T) {
+	ansible := encrypt(t, &AnsibleCryptor{Password: "password123"}, "secret")
+
+	assert.True(t, IsEncrypted(ansible))
+	assert.False(t, IsEncrypted("[] secret moment"))
+	assert.False(t, IsEncrypted(""))
+}
+
+func encrypt(t *testing.T, c Cryptor, content string) string {
+	var b bytes.Buffer
+	err := c.EncryptContent(strings.NewReader(content), &b)
+	assert.NoError(t, err)
+	return b.String()
+}
+
+func decrypt(t *testing.T, c Cryptor, content string) string {
+	str, err := c.DecryptString(content)
+	assert.NoError(t, err)
+	return str
+}
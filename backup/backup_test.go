@@ -25,7 +25,7 @@ func TestSave(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "save 1", backup.Message)
 	assert.NotNil(t, backup.Identifier)
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(backups))
 	assert.Equal(t, backup, backups[0])
@@ -46,7 +46,7 @@ func TestSave_Multiple(t *testing.T) {
 	assert.Equal(t, "save 1", backup1.Message)
 	assert.Equal(t, "save 2", backup2.Message)
 	assert.NotEqual(t, backup1.Identifier, backup2.Identifier)
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(backups))
 	assert.Equal(t, backup2, backups[0])
@@ -78,7 +78,7 @@ func TestRestore(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, fmt.Sprintf("Restore backup %s 'save 1'", backup1.Identifier), restoreBackup.Message)
 
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 4, len(backups))
 	restoredTodoContent, _ := util.ReadFile(files.TodoFile)
@@ -87,6 +87,83 @@ func TestRestore(t *testing.T) {
 	tu.AssertContains(t, "my trash content 1", restoredTrashContent)
 }
 
+func TestRestore_Encrypted(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	initRepo(todoDir)
+	enableTestEncryption(t, todoDir)
+	todoFile := filepath.Join(todoDir, "todo.txt")
+	files := util.NewFileConfigFromTodoFile(todoFile)
+
+	util.WriteFile(todoFile, "[] line 1\n")
+	backup1, _ := Save(files, "save 1")
+	util.WriteFile(todoFile, "[] line 1\n[] line 2\n")
+	Save(files, "save 2")
+	util.WriteFile(todoFile, "[] line 2\n[] line 3\n")
+	Save(files, "save 3")
+
+	_, err := Restore(files, backup1)
+
+	assert.NoError(t, err)
+	restoredTodoContent, _ := util.ReadFile(files.TodoFile)
+	assert.Equal(t, "[] line 1\n", restoredTodoContent)
+}
+
+func TestGetBackup(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	todoFile := filepath.Join(todoDir, "todo.txt")
+	util.WriteFile(todoFile, "my todo content 1")
+	files := util.NewFileConfigFromTodoFile(todoFile)
+	backup1, _ := Save(files, "save 1")
+
+	byShortID, err := GetBackup(files, backup1.Identifier[:7])
+
+	assert.NoError(t, err)
+	assert.Equal(t, backup1, byShortID)
+	_, err = GetBackup(files, "abcdef1")
+	assert.Equal(t, ErrBackupNotFound, err)
+	_, err = GetBackup(files, "--all")
+	assert.Equal(t, ErrBackupNotFound, err)
+}
+
+func TestContentAndDiff(t *testing.T) {
+	testContentAndDiff(t, false)
+}
+
+func TestContentAndDiff_Encrypted(t *testing.T) {
+	testContentAndDiff(t, true)
+}
+
+func testContentAndDiff(t *testing.T, encrypted bool) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	if encrypted {
+		initRepo(todoDir)
+		enableTestEncryption(t, todoDir)
+	}
+	todoFile := filepath.Join(todoDir, "todo.txt")
+	files := util.NewFileConfigFromTodoFile(todoFile)
+
+	util.WriteFile(todoFile, "[] line 1\n")
+	backup1, _ := Save(files, "save 1")
+	util.WriteFile(todoFile, "[] line 1\n[] line 2\n")
+	backup2, _ := Save(files, "save 2")
+	util.WriteFile(todoFile, "[] line 2\n")
+
+	content, err := Content(files, backup1.Identifier)
+	assert.NoError(t, err)
+	assert.Equal(t, "[] line 1\n", content)
+
+	diffToBackup2, err := Diff(files, backup1.Identifier, backup2.Identifier)
+	assert.NoError(t, err)
+	tu.AssertContains(t, " [] line 1\n+[] line 2\n", diffToBackup2)
+
+	diffToCurrent, err := Diff(files, backup2.Identifier, "")
+	assert.NoError(t, err)
+	tu.AssertContains(t, "-[] line 1\n [] line 2\n", diffToCurrent)
+}
+
 func TestDailyBackup_NoBackupsAtAll(t *testing.T) {
 	// Given
 	todoDir := tu.MakeTempDir("sibyl_backup_test")
@@ -103,7 +180,7 @@ func TestDailyBackup_NoBackupsAtAll(t *testing.T) {
 	// Then
 	assert.NoError(t, err)
 	assert.Equal(t, "Daily backup for 13.01.2019", backup.Message)
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(backups))
 	assert.Equal(t, backup, backups[0])
@@ -126,7 +203,7 @@ func TestDailyBackup_NoDailyBackups(t *testing.T) {
 	// Then
 	assert.NoError(t, err)
 	assert.Equal(t, "Daily backup for 13.01.2019", backup.Message)
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(backups))
 	assert.Equal(t, backup, backups[0])
@@ -151,7 +228,7 @@ func TestDailyBackup_OldDailyBackups(t *testing.T) {
 	// Then
 	assert.NoError(t, err)
 	assert.Equal(t, "Daily backup for 13.01.2019", backup.Message)
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 2, len(backups))
 	assert.Equal(t, backup, backups[0])
@@ -177,7 +254,7 @@ func TestDailyBackup_AlreadyGotDailyBackup(t *testing.T) {
 	// Then
 	assert.NoError(t, err)
 	assert.Nil(t, backup)
-	backups, err := ListBackups(files.TodoDir)
+	backups, err := ListBackups(files)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, len(backups))
 	assert.Equal(t, oldBackup, backups[0])
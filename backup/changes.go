@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const changeBackupPrefix = "Todo file changed"
+
+// ChangeSummary lists the moments that changed between two versions of the todo file.
+type ChangeSummary struct {
+	Added      []string
+	Completed  []string
+	Removed    []string
+	Edited     []string
+	Categories []string
+}
+
+// IsEmpty returns true if no moment changed, e.g. if only whitespace was changed.
+func (c *ChangeSummary) IsEmpty() bool {
+	return len(c.Added)+len(c.Completed)+len(c.Removed)+len(c.Edited) == 0
+}
+
+// Message returns a commit message with the counts in the first line and the moment names in the following lines.
+func (c *ChangeSummary) Message() string {
+	var counts []string
+	var lines []string
+	for _, part := range []struct {
+		verb  string
+		names []string
+	}{{"added", c.Added}, {"completed", c.Completed}, {"removed", c.Removed}, {"edited", c.Edited}} {
+		if len(part.names) == 0 {
+			continue
+		}
+		counts = append(counts, fmt.Sprintf("%d %s", len(part.names), part.verb))
+		for _, n := range part.names {
+			lines = append(lines, fmt.Sprintf("%s%s: %s", strings.ToUpper(part.verb[:1]), part.verb[1:], n))
+		}
+	}
+	if len(c.Categories) > 0 {
+		lines = append(lines, "Categories: "+strings.Join(c.Categories, ", "))
+	}
+
+	msg := changeBackupPrefix
+	if len(counts) > 0 {
+		msg += ": " + strings.Join(counts, ", ")
+	}
+	if len(lines) > 0 {
+		msg += "\n\n" + strings.Join(lines, "\n")
+	}
+	return msg
+}
+
+// changedMoment is a moment in one version of the todo file.
+type changedMoment struct {
+	name     string
+	category string
+	done     bool
+	text     string
+}
+
+// SummarizeChanges compares the moments of two versions of the todo file. Moments are matched by their #id
+// or, if they don't have one, by their name and category.
+func SummarizeChanges(oldContent string, newContent string) (*ChangeSummary, error) {
+	oldMoments, err := momentsByKey(oldContent)
+	if err != nil {
+		return nil, err
+	}
+	newMoments, err := momentsByKey(newContent)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ChangeSummary{}
+	categories := make(map[string]bool)
+	touch := func(m *changedMoment) {
+		if m.category != "" {
+			categories[m.category] = true
+		}
+	}
+	for _, key := range sortedKeys(newMoments) {
+		olds := oldMoments[key]
+		for i, m := range newMoments[key] {
+			// Moments with the same key are matched in order
+			if i >= len(olds) {
+				summary.Added = append(summary.Added, m.name)
+				touch(m)
+			} else if m.done && !olds[i].done {
+				summary.Completed = append(summary.Completed, m.name)
+				touch(m)
+			} else if m.text != olds[i].text {
+				summary.Edited = append(summary.Edited, m.name)
+				touch(m)
+			}
+		}
+	}
+	for _, key := range sortedKeys(oldMoments) {
+		olds := oldMoments[key]
+		for i := len(newMoments[key]); i < len(olds); i++ {
+			summary.Removed = append(summary.Removed, olds[i].name)
+			touch(olds[i])
+		}
+	}
+	for c := range categories {
+		summary.Categories = append(summary.Categories, c)
+	}
+	sort.Strings(summary.Categories)
+	return summary, nil
+}
+
+func momentsByKey(content string) (map[string][]*changedMoment, error) {
+	todos, err := parse.String(content)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(content, "\n")
+	res := make(map[string][]*changedMoment)
+	var add func(mom moment.Moment, category string, parent string)
+	add = func(mom moment.Moment, category string, parent string) {
+		if mom.GetCategory() != nil {
+			category = mom.GetCategory().Name
+		}
+		m := &changedMoment{name: mom.GetName(), category: category, done: mom.IsDone()}
+		// The moment line and its comments, but not its sub moments
+		start := mom.GetDocCoords().LineNumber
+		end := start + len(mom.GetComments())
+		for i := start; i <= end && i < len(lines); i++ {
+			m.text += strings.TrimSpace(lines[i]) + "\n"
+		}
+		key := category + "/" + parent + "/" + strings.ToLower(mom.GetName())
+		if mom.GetID() != nil {
+			key = "#" + mom.GetID().Value
+		}
+		res[key] = append(res[key], m)
+		for _, sub := range mom.GetSubMoments() {
+			add(sub, category, parent+"/"+strings.ToLower(mom.GetName()))
+		}
+	}
+	for _, mom := range todos.Moments {
+		add(mom, "", "")
+	}
+	return res, nil
+}
+
+func sortedKeys(m map[string][]*changedMoment) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SaveChanges creates a backup of the todo file with a summary of the changes since the newest backup.
+// Returns nil if the todo file did not change.
+func SaveChanges(files *util.FileConfig) (*Backup, error) {
+	content, err := util.ReadFile(files.TodoFile)
+	if err != nil {
+		return nil, err
+	}
+	backups, err := ListBackups(files)
+	if err != nil {
+		return nil, err
+	}
+	var lastContent string
+	if len(backups) > 0 {
+		lastContent, _, err = TodoContent(files, backups[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if content == lastContent {
+		return nil, nil
+	}
+
+	summary, err := SummarizeChanges(lastContent, content)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Creating backup after changes to %s\n", files.TodoFile)
+	return Save(files, summary.Message())
+}
+
+// ChangeDebouncer decides when to back up the todo file after it changed: only once it has not changed
+// for the delay, so a backup is not created for every save in the editor.
+type ChangeDebouncer struct {
+	Delay     time.Duration
+	lastMod   time.Time
+	changedAt time.Time
+	pending   bool
+}
+
+// NewChangeDebouncer creates a debouncer that ignores modifications before the passed modification time.
+func NewChangeDebouncer(delay time.Duration, modTime time.Time) *ChangeDebouncer {
+	return &ChangeDebouncer{Delay: delay, lastMod: modTime}
+}
+
+// Check is called periodically with the current modification time of the todo file. Returns true if the
+// file changed and then stayed unchanged for the delay.
+func (d *ChangeDebouncer) Check(modTime time.Time, now time.Time) bool {
+	if !modTime.Equal(d.lastMod) {
+		d.lastMod = modTime
+		d.changedAt = now
+		d.pending = true
+		return false
+	}
+	if d.pending && now.Sub(d.changedAt) >= d.Delay {
+		d.pending = false
+		return true
+	}
+	return false
+}
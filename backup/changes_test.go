@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeChanges(t *testing.T) {
+	oldContent := `------------------
+ Work
+------------------
+[] write report
+[] call bob
+	[] sub task
+[] fix bug #b1
+
+------------------
+ Home
+------------------
+[] buy milk
+[] water plants
+`
+	newContent := `------------------
+ Work
+------------------
+[x] write report
+[] call bob
+	[] sub task
+	[] new sub task
+[] fix bug urgently #b1
+
+------------------
+ Home
+------------------
+[] water plants
+[] pay bills
+`
+
+	summary, err := SummarizeChanges(oldContent, newContent)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pay bills", "new sub task"}, summary.Added)
+	assert.Equal(t, []string{"write report"}, summary.Completed)
+	assert.Equal(t, []string{"buy milk"}, summary.Removed)
+	assert.Equal(t, []string{"fix bug urgently"}, summary.Edited)
+	assert.Equal(t, []string{"Home", "Work"}, summary.Categories)
+	assert.Equal(t, `Todo file changed: 2 added, 1 completed, 1 removed, 1 edited
+
+Added: pay bills
+Added: new sub task
+Completed: write report
+Removed: buy milk
+Edited: fix bug urgently
+Categories: Home, Work`, summary.Message())
+}
+
+func TestSummarizeChanges_OnlyWhitespace(t *testing.T) {
+	summary, err := SummarizeChanges("[] buy milk\n", "\n[] buy milk\n\n")
+
+	assert.NoError(t, err)
+	assert.True(t, summary.IsEmpty())
+	assert.Equal(t, "Todo file changed", summary.Message())
+}
+
+func TestSummarizeChanges_DuplicateNames(t *testing.T) {
+	summary, _ := SummarizeChanges("[] stretch\n", "[] stretch\n[] stretch\n")
+
+	assert.Equal(t, []string{"stretch"}, summary.Added)
+	assert.Empty(t, summary.Edited)
+}
+
+func TestSaveChanges(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	files := util.NewFileConfigFromTodoFile(filepath.Join(todoDir, "todo.txt"))
+	util.WriteFile(files.TodoFile, "[] buy milk\n")
+
+	first, err := SaveChanges(files)
+	assert.NoError(t, err)
+	assert.Equal(t, "Todo file changed: 1 added\n\nAdded: buy milk", first.Message)
+	assert.Equal(t, "Todo file changed: 1 added", first.Subject())
+
+	unchanged, err := SaveChanges(files)
+	assert.NoError(t, err)
+	assert.Nil(t, unchanged)
+
+	util.WriteFile(files.TodoFile, "[x] buy milk\n")
+	second, _ := SaveChanges(files)
+	assert.Equal(t, "Todo file changed: 1 completed\n\nCompleted: buy milk", second.Message)
+	backups, _ := ListBackups(files)
+	assert.Equal(t, 2, len(backups))
+}
+
+func TestChangeDebouncer(t *testing.T) {
+	start := tu.Dtt("13.01.2019 12:00")
+	mod1 := start.Add(time.Minute)
+	mod2 := start.Add(2 * time.Minute)
+	d := NewChangeDebouncer(3*time.Minute, start)
+
+	assert.False(t, d.Check(start, start.Add(10*time.Minute)), "not changed")
+	assert.False(t, d.Check(mod1, start.Add(time.Minute)))
+	assert.False(t, d.Check(mod2, start.Add(2*time.Minute)), "still changing")
+	assert.False(t, d.Check(mod2, start.Add(4*time.Minute)))
+	assert.True(t, d.Check(mod2, start.Add(5*time.Minute)), "unchanged for the delay")
+	assert.False(t, d.Check(mod2, start.Add(6*time.Minute)), "already backed up")
+}
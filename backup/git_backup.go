@@ -13,8 +13,9 @@ import (
 	"github.com/sandro-h/sibylgo/util"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 )
 
 // IsRepoInitiated returns true if the passed folder is a git repository.
@@ -75,6 +76,13 @@ func EnableGitEncryption(repoPath string, executable string) error {
 	return nil
 }
 
+// SetGitFilterRequired sets whether git fails if the encryption filter fails. Otherwise git stores
+// the content unencrypted when the filter fails.
+func SetGitFilterRequired(repoPath string, required bool) error {
+	_, err := runGitCmd(repoPath, "git", "config", "filter.sibylgo_filter.required", fmt.Sprint(required))
+	return err
+}
+
 // Commit stages and commits the passed files in the passed folder.
 // Also commits if none of the passed files changed.
 func commit(repoPath string, message string, authorEmail string, files ...string) (*commitEntry, error) {
@@ -122,77 +130,165 @@ func commit(repoPath string, message string, authorEmail string, files ...string
 	return tocommitEntry(c), nil
 }
 
-// RevertToCommit reverts all changes done since commitHash and creates a single new commit with these reversions.
-func revertToCommit(repoPath string, commitHash string, newCommitMessage string, authorEmail string) (*commitEntry, error) {
-	// Note go-git doesn't support revert, so we have to use the cli tool (and assume it's installed)
-	_, err := runGitCmd(repoPath, "git", "revert", "--no-commit", fmt.Sprintf("%s..HEAD", commitHash))
+// findCommit resolves the (possibly abbreviated) commit hash.
+func findCommit(repoPath string, hash string) (*commitEntry, error) {
+	out, err := runGitCmd(repoPath, "git", "rev-parse", "--verify", "--quiet", hash+"^{commit}")
 	if err != nil {
-		return nil, err
+		return nil, ErrBackupNotFound
 	}
-
-	// The revert command didn't auto-commit but staged all the necessary changes
-	// (would otherwise create one commit for each reverted commit)
 	r, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return nil, err
 	}
-
-	w, err := r.Worktree()
+	c, err := r.CommitObject(plumbing.NewHash(strings.TrimSpace(out)))
 	if err != nil {
 		return nil, err
 	}
+	return tocommitEntry(c), nil
+}
 
-	hash, err := w.Commit(newCommitMessage, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  authorEmail,
-			Email: authorEmail,
-			When:  getNow(),
-		},
-	})
+// showFile returns the content of the file at the commit. Textconv is applied, so encrypted
+// content is decrypted. found is false if the file does not exist in that commit.
+func showFile(repoPath string, commitHash string, file string) (string, bool, error) {
+	_, err := runGitCmd(repoPath, "git", "cat-file", "-e", commitHash+":"+file)
 	if err != nil {
-		return nil, err
+		return "", false, nil
+	}
+	content, err := runGitCmd(repoPath, "git", "show", "--textconv", commitHash+":"+file)
+	if err != nil {
+		return "", false, err
 	}
+	return content, true, nil
+}
 
-	c, err := r.CommitObject(hash)
+// showStoredFile returns the file in the commit as stored in the repository, without decrypting it.
+func showStoredFile(repoPath string, commitHash string, file string) (string, bool, error) {
+	_, err := runGitCmd(repoPath, "git", "cat-file", "-e", commitHash+":"+file)
 	if err != nil {
-		return nil, err
+		return "", false, nil
 	}
-	return tocommitEntry(c), nil
+	content, err := runGitCmd(repoPath, "git", "cat-file", "blob", commitHash+":"+file)
+	if err != nil {
+		return "", false, err
+	}
+	return content, true, nil
+}
+
+// diff returns the unified diff of the file between two commits, or between a commit
+// and the working tree if only one commit is passed. Textconv is applied, so encrypted
+// content is decrypted.
+func diff(repoPath string, file string, commitHashes ...string) (string, error) {
+	args := append([]string{"git", "diff", "--no-color", "--textconv"}, commitHashes...)
+	args = append(args, "--", file)
+	return runGitCmd(repoPath, args...)
+}
+
+func relPath(repoPath string, file string) string {
+	rel, err := filepath.Rel(repoPath, file)
+	if err != nil {
+		return file
+	}
+	return filepath.ToSlash(rel)
 }
 
-func push(repoPath string, remoteURL string, remoteUser string, remotePassword string) error {
+// push pushes the current branch to the remote. It first checks the remote branch: if it is where our last push left it,
+// it force-pushes, since the history may have been rewritten by a prune. If it contains commits we don't have, it fails
+// with ErrRemoteChanged instead of overwriting them. Unlike git's force-with-lease, the check and the push are separate
+// requests (go-git cannot push with a lease), so a change to the remote between the two is overwritten.
+func push(repoPath string, remote *Remote) error {
 	r, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return err
 	}
 
-	err = r.DeleteRemote("origin")
+	err = r.DeleteRemote(remote.Name)
 	if err != nil && !errors.Is(err, git.ErrRemoteNotFound) {
 		return err
 	}
 
-	remote := config.RemoteConfig{
-		Name: "origin",
-		URLs: []string{remoteURL},
+	remoteCfg := config.RemoteConfig{
+		Name: remote.Name,
+		URLs: []string{remote.URL},
+		// So pushes update the remote-tracking refs, which are the lease for force pushes
+		Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", remote.Name))},
 	}
 
-	_, err = r.CreateRemote(&remote)
+	gitRemote, err := r.CreateRemote(&remoteCfg)
 	if err != nil {
 		return err
 	}
 
-	var auth *http.BasicAuth
-	if remoteUser != "" {
-		auth = &http.BasicAuth{
-			Username: remoteUser,
-			Password: remotePassword,
-		}
+	auth, err := remote.auth()
+	if err != nil {
+		return err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	force, err := checkRemoteBranch(repoPath, r, gitRemote, auth, head)
+	if err != nil {
+		return err
 	}
 
-	return r.Push(&git.PushOptions{
-		RemoteName: "origin",
+	refSpec := fmt.Sprintf("%s:%s", head.Name(), head.Name())
+	if force {
+		refSpec = "+" + refSpec
+	}
+	err = r.Push(&git.PushOptions{
+		RemoteName: remote.Name,
+		RefSpecs:   []config.RefSpec{config.RefSpec(refSpec)},
 		Auth:       auth,
 	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	// Record the lease also if the remote was already up to date, e.g. for repos pushed by earlier versions, which
+	// did not record it.
+	lease := plumbing.NewRemoteReferenceName(remote.Name, head.Name().Short())
+	return r.Storer.SetReference(plumbing.NewHashReference(lease, head.Hash()))
+}
+
+// checkRemoteBranch returns whether the branch can be force-pushed: the remote branch is still where our last push
+// left it. If the remote branch doesn't exist yet or is behind our branch, it returns false, so a normal push is done.
+// Otherwise the remote diverged from our branch and it returns ErrRemoteChanged.
+func checkRemoteBranch(repoPath string, r *git.Repository, remote *git.Remote, auth transport.AuthMethod,
+	head *plumbing.Reference) (bool, error) {
+
+	remoteRefs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err == transport.ErrEmptyRemoteRepository {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var remoteRef *plumbing.Reference
+	for _, ref := range remoteRefs {
+		if ref.Name() == head.Name() {
+			remoteRef = ref
+		}
+	}
+	if remoteRef == nil {
+		return false, nil
+	}
+
+	lease, err := r.Reference(plumbing.NewRemoteReferenceName(remote.Config().Name, head.Name().Short()), true)
+	if err == nil && lease.Hash() == remoteRef.Hash() {
+		return true, nil
+	} else if err != nil && err != plumbing.ErrReferenceNotFound {
+		return false, err
+	}
+
+	// Fails if the remote commit is unknown or not an ancestor of ours
+	_, err = runGitCmd(repoPath, "git", "merge-base", "--is-ancestor", remoteRef.Hash().String(), head.Hash().String())
+	if err == nil {
+		return false, nil
+	}
+	if lease == nil {
+		return false, fmt.Errorf("%w: %s has commits that are not in the local backups. If the remote only has "+
+			"backups of this todo file, delete the branch on the remote to push again", ErrRemoteChanged, head.Name().Short())
+	}
+	return false, fmt.Errorf("%w: %s is at %s, expected %s", ErrRemoteChanged, head.Name().Short(), remoteRef.Hash(), lease.Hash())
 }
 
 func runGitCmd(repoPath string, cmdAndArgs ...string) (string, error) {
@@ -242,7 +338,10 @@ func doFindCommits(repoPath string, predicate func(*commitEntry) bool, stopAtFir
 	}
 
 	cIter, err := r.Log(&git.LogOptions{})
-	if err != nil {
+	if err == plumbing.ErrReferenceNotFound {
+		// No commits yet
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
 
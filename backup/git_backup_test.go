@@ -67,29 +67,25 @@ func TestEnableGitEncryption(t *testing.T) {
 	assert.Equal(t, expectedGitConfig, gitConfig)
 }
 
-func TestGitEncryption(t *testing.T) {
+func TestSetGitFilterRequired(t *testing.T) {
 	repoPath := tu.MakeTempDir("sibyl_git_backup_test")
 	defer tu.DeleteTempDir(repoPath)
-	assert.False(t, isRepoInitiated(repoPath))
+	initRepo(repoPath)
 
-	var sibylgoExecutableName string
-	if runtime.GOOS == "windows" {
-		sibylgoExecutableName = "sibylgo.exe"
-	} else {
-		sibylgoExecutableName = "sibylgo"
-	}
-	sibylgoExecutable, _ := filepath.Abs(filepath.Join("..", sibylgoExecutableName))
-	assert.True(t, util.Exists(sibylgoExecutable), "Sibylgo executable at %s does not exist. Build it first", sibylgoExecutable)
+	err := SetGitFilterRequired(repoPath, true)
 
-	configFile := repoPath + "/sibylgo.yml"
-	util.WriteFile(configFile, `
-backup:
-  encrypt_password: password123
-`)
-	sibylgoExecutable += " --config " + configFile
+	assert.NoError(t, err)
+	required, _ := runGitCmd(repoPath, "git", "config", "filter.sibylgo_filter.required")
+	assert.Equal(t, "true\n", required)
+}
+
+func TestGitEncryption(t *testing.T) {
+	repoPath := tu.MakeTempDir("sibyl_git_backup_test")
+	defer tu.DeleteTempDir(repoPath)
+	assert.False(t, isRepoInitiated(repoPath))
 
 	initRepo(repoPath)
-	EnableGitEncryption(repoPath, sibylgoExecutable)
+	enableTestEncryption(t, repoPath)
 
 	// Debugging in case of failure:
 	gitattributes, _ := util.ReadFile(repoPath + "/.gitattributes")
@@ -182,35 +178,25 @@ func TestCommit_NoChanges(t *testing.T) {
 	assert.Equal(t, "file2.txt", commits[1].Files[1])
 }
 
-func TestRevert(t *testing.T) {
-	// Given
-	repoPath := tu.MakeTempDir("sibyl_git_backup_test")
-	defer tu.DeleteTempDir(repoPath)
-	err := initRepo(repoPath)
-	assert.NoError(t, err)
-
-	file1 := filepath.Join(repoPath, "file1.txt")
-	for i := 0; i < 5; i++ {
-		os.WriteFile(file1, []byte(fmt.Sprintf("Content %d", i)), 0644)
-		commit(repoPath, fmt.Sprintf("Commit %d", i), "test@example.com", file1)
+// enableTestEncryption enables git encryption using the sibylgo executable, which has to be built first.
+func enableTestEncryption(t *testing.T, repoPath string) {
+	var sibylgoExecutableName string
+	if runtime.GOOS == "windows" {
+		sibylgoExecutableName = "sibylgo.exe"
+	} else {
+		sibylgoExecutableName = "sibylgo"
 	}
-	commits, _ := listCommits(repoPath)
-	assert.Equal(t, 5, len(commits))
-	todoContent, _ := util.ReadFile(file1)
-	assert.Equal(t, "Content 4", todoContent)
-
-	// When
-	assert.Equal(t, "Commit 2", commits[2].Message)
-	revertCommit, err := revertToCommit(repoPath, commits[2].Hash, "Revert commit", "test@example.com")
+	sibylgoExecutable, _ := filepath.Abs(filepath.Join("..", sibylgoExecutableName))
+	assert.True(t, util.Exists(sibylgoExecutable), "Sibylgo executable at %s does not exist. Build it first", sibylgoExecutable)
 
-	// Then
-	assert.NoError(t, err)
-	assert.Equal(t, "Revert commit", revertCommit.Message)
-	commitsAfterRevert, _ := listCommits(repoPath)
-	assert.Equal(t, 6, len(commitsAfterRevert))
-	todoContentAfterRevert, _ := util.ReadFile(file1)
-	assert.Equal(t, "Content 2", todoContentAfterRevert)
+	configFile := repoPath + "/sibylgo.yml"
+	util.WriteFile(configFile, `
+backup:
+  encrypt_password: password123
+`)
+	sibylgoExecutable += " --config " + configFile
 
+	EnableGitEncryption(repoPath, sibylgoExecutable)
 }
 
 func secondPrecision(dt time.Time) time.Time {
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sandro-h/sibylgo/status"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// defaultRemoteName is the name of the remote configured with remote_url.
+const defaultRemoteName = "origin"
+
+var remoteNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Remote is a git repository the backups are pushed to.
+type Remote struct {
+	Name     string
+	URL      string
+	User     string
+	Password string
+	// SSHKeyFile is the private key for SSH URLs. Without it, the keys of the ssh-agent are used.
+	SSHKeyFile     string
+	SSHKeyPassword string
+	// KnownHostsFile overrides the known_hosts files used to check the host key of SSH URLs.
+	KnownHostsFile string
+	// Schedule is the schedule for pushing to the remote. If empty, the remote is pushed to after each backup.
+	Schedule string
+}
+
+// HasRemotes returns true if the backup config defines any remote.
+func HasRemotes(backupCfg *util.Config) bool {
+	return backupCfg.HasKey("remote_url") || backupCfg.HasKey("remotes")
+}
+
+// ParseRemotes reads the remote_url and the remotes section of the backup config.
+func ParseRemotes(backupCfg *util.Config) ([]*Remote, error) {
+	var remotes []*Remote
+	if backupCfg.HasKey("remote_url") {
+		remotes = append(remotes, &Remote{
+			Name:     defaultRemoteName,
+			URL:      backupCfg.GetString("remote_url", ""),
+			User:     backupCfg.GetString("remote_user", ""),
+			Password: backupCfg.GetString("remote_password", ""),
+		})
+	}
+
+	remotesCfg := backupCfg.GetSubConfig("remotes")
+	for _, name := range remotesCfg.Keys() {
+		if !remoteNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid remote name %s, only letters, digits, - and _ are allowed", name)
+		}
+		if name == defaultRemoteName && backupCfg.HasKey("remote_url") {
+			return nil, fmt.Errorf("remote %s is already defined by remote_url", name)
+		}
+		cfg := remotesCfg.GetSubConfig(name)
+		if !cfg.HasKey("url") {
+			return nil, fmt.Errorf("remote %s: url must be set", name)
+		}
+		remotes = append(remotes, &Remote{
+			Name:           name,
+			URL:            cfg.GetString("url", ""),
+			User:           cfg.GetString("user", ""),
+			Password:       cfg.GetString("password", ""),
+			SSHKeyFile:     cfg.GetString("ssh_key_file", ""),
+			SSHKeyPassword: cfg.GetString("ssh_key_password", ""),
+			KnownHostsFile: cfg.GetString("known_hosts_file", ""),
+			Schedule:       cfg.GetString("schedule", ""),
+		})
+	}
+	return remotes, nil
+}
+
+// auth returns the authentication for the remote URL: SSH keys or the ssh-agent for SSH URLs, basic auth for HTTP URLs
+// with a user, or nil.
+func (r *Remote) auth() (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(r.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ep.Protocol {
+	case "ssh":
+		user := r.User
+		if user == "" {
+			user = ep.User
+		}
+		if user == "" {
+			user = "git"
+		}
+
+		var helper *ssh.HostKeyCallbackHelper
+		var auth transport.AuthMethod
+		if r.SSHKeyFile != "" {
+			keys, err := ssh.NewPublicKeysFromFile(user, util.ExpandHome(r.SSHKeyFile), r.SSHKeyPassword)
+			if err != nil {
+				return nil, fmt.Errorf("ssh key %s: %s", r.SSHKeyFile, err)
+			}
+			helper, auth = &keys.HostKeyCallbackHelper, keys
+		} else {
+			agent, err := ssh.NewSSHAgentAuth(user)
+			if err != nil {
+				return nil, fmt.Errorf("no ssh_key_file set and no ssh-agent: %s", err)
+			}
+			helper, auth = &agent.HostKeyCallbackHelper, agent
+		}
+
+		// Without a callback, go-git checks the default known_hosts files
+		if r.KnownHostsFile != "" {
+			helper.HostKeyCallback, err = ssh.NewKnownHostsCallback(util.ExpandHome(r.KnownHostsFile))
+			if err != nil {
+				return nil, fmt.Errorf("known hosts %s: %s", r.KnownHostsFile, err)
+			}
+		}
+		return auth, nil
+	case "http", "https":
+		if r.User != "" {
+			return &http.BasicAuth{Username: r.User, Password: r.Password}, nil
+		}
+	}
+	return nil, nil
+}
+
+// SyncToRemote pushes the backups to all remotes defined in the backup configuration that don't have their own schedule.
+// It tries all remotes and returns the first error.
+func SyncToRemote(backupCfg *util.Config, files *util.FileConfig) error {
+	remotes, err := ParseRemotes(backupCfg)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, r := range remotes {
+		if r.Schedule != "" {
+			continue
+		}
+		err = SyncRemote(backupCfg, files, r)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("remote %s: %w", r.Name, err)
+		}
+	}
+	return firstErr
+}
+
+// SyncRemote pushes the backups to the remote. With strict_encryption, it refuses to push if any backup
+// contains unencrypted content. Does nothing if there are no backups yet.
+func SyncRemote(backupCfg *util.Config, files *util.FileConfig, remote *Remote) error {
+	if !isRepoInitiated(files.TodoDir) {
+		log.Infof("No backups to push to remote %s yet\n", remote.Name)
+		return nil
+	}
+	if backupCfg.GetBool("strict_encryption", false) {
+		unencrypted, err := findUnencrypted(files.TodoDir)
+		if err != nil {
+			return err
+		}
+		if len(unencrypted) > 0 {
+			err = fmt.Errorf("%w, not pushing: %s", ErrNotEncrypted, strings.Join(unencrypted, ", "))
+			status.RecordRemoteSync(remote.URL, err)
+			remoteSyncFailuresTotal.Inc()
+			return err
+		}
+	}
+	log.Infof("Pushing backup to remote %s (%s)\n", remote.Name, remote.URL)
+
+	err := push(files.TodoDir, remote)
+	status.RecordRemoteSync(remote.URL, err)
+	if err != nil {
+		remoteSyncFailuresTotal.Inc()
+	}
+	return err
+}
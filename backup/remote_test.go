@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+func TestParseRemotes(t *testing.T) {
+	cfg, _ := util.LoadConfigString(`
+remote_url: https://git.example.com/todos
+remote_user: john
+remote_password: secret
+remotes:
+  nas:
+    url: ssh://backup@nas.local/todos.git
+    ssh_key_file: ~/.ssh/id_backup
+    known_hosts_file: ~/.ssh/known_hosts_nas
+    schedule: "0 3 * * *"
+  usb:
+    url: /media/usb/todos.git
+`)
+
+	remotes, err := ParseRemotes(cfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*Remote{
+		{Name: "origin", URL: "https://git.example.com/todos", User: "john", Password: "secret"},
+		{Name: "nas", URL: "ssh://backup@nas.local/todos.git", SSHKeyFile: "~/.ssh/id_backup",
+			KnownHostsFile: "~/.ssh/known_hosts_nas", Schedule: "0 3 * * *"},
+		{Name: "usb", URL: "/media/usb/todos.git"},
+	}, remotes)
+}
+
+func TestParseRemotes_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"remotes:\n  my/nas:\n    url: /tmp/x":                     "invalid remote name my/nas, only letters, digits, - and _ are allowed",
+		"remotes:\n  nas:\n    user: john":                         "remote nas: url must be set",
+		"remote_url: /tmp/x\nremotes:\n  origin:\n    url: /tmp/y": "remote origin is already defined by remote_url",
+	}
+	for cfgStr, expected := range cases {
+		cfg, _ := util.LoadConfigString(cfgStr)
+		_, err := ParseRemotes(cfg)
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestRemoteAuth_SSHKey(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	keyFile := filepath.Join(todoDir, "id_rsa")
+	knownHostsFile := filepath.Join(todoDir, "known_hosts")
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	util.WriteFile(keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})))
+	util.WriteFile(knownHostsFile, "# no hosts\n")
+
+	auth, err := (&Remote{URL: "ssh://backup@nas.local/todos.git", SSHKeyFile: keyFile, KnownHostsFile: knownHostsFile}).auth()
+
+	assert.NoError(t, err)
+	keys := auth.(*ssh.PublicKeys)
+	assert.Equal(t, "backup", keys.User)
+	assert.NotNil(t, keys.HostKeyCallback)
+
+	auth, _ = (&Remote{URL: "nas.local:todos.git", SSHKeyFile: keyFile}).auth()
+	assert.Equal(t, "git", auth.(*ssh.PublicKeys).User)
+}
+
+func TestRemoteAuth_SSHKeyMissing(t *testing.T) {
+	_, err := (&Remote{URL: "ssh://nas.local/todos.git", SSHKeyFile: "/does/not/exist"}).auth()
+
+	tu.AssertContains(t, "ssh key /does/not/exist", err.Error())
+}
+
+func TestRemoteAuth_HTTP(t *testing.T) {
+	auth, err := (&Remote{URL: "https://git.example.com/todos", User: "john", Password: "secret"}).auth()
+	assert.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "john", Password: "secret"}, auth)
+
+	auth, err = (&Remote{URL: "https://git.example.com/todos"}).auth()
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+
+	auth, err = (&Remote{URL: "/media/usb/todos.git"}).auth()
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestSyncToRemote_MultipleRemotes(t *testing.T) {
+	// Given
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remote1 := filepath.Join(todoDir, "remote1.git")
+	remote2 := filepath.Join(todoDir, "remote2.git")
+	scheduled := filepath.Join(todoDir, "scheduled.git")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1, 2)
+	for _, dir := range []string{remote1, remote2, scheduled} {
+		runGitCmd(todoDir, "git", "init", "--bare", "-q", dir)
+	}
+	cfg, _ := util.LoadConfigString("remote_url: " + remote1 + "\nremotes:\n  second:\n    url: " + remote2 +
+		"\n  nightly:\n    url: " + scheduled + "\n    schedule: \"0 3 * * *\"")
+
+	// When
+	err := SyncToRemote(cfg, files)
+
+	// Then the remotes without schedule are pushed to
+	assert.NoError(t, err)
+	local, _ := runGitCmd(files.TodoDir, "git", "rev-parse", "HEAD")
+	for _, dir := range []string{remote1, remote2} {
+		remote, _ := runGitCmd(dir, "git", "rev-parse", "HEAD")
+		assert.Equal(t, local, remote, dir)
+	}
+	_, err = runGitCmd(scheduled, "git", "rev-parse", "--verify", "--quiet", "HEAD")
+	assert.Error(t, err, "scheduled remote is only pushed to by its job")
+
+	// When the scheduled job runs
+	remotes, _ := ParseRemotes(cfg)
+	err = SyncRemote(cfg, files, remotes[1])
+
+	// Then
+	assert.NoError(t, err)
+	remote, _ := runGitCmd(scheduled, "git", "rev-parse", "HEAD")
+	assert.Equal(t, local, remote)
+}
+
+func TestPush_Diverged(t *testing.T) {
+	// Given a remote with commits that were never pushed from here
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	otherFiles, _ := makeBackupsOnDays(filepath.Join(todoDir, "other"), 1)
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 2)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	assert.NoError(t, push(otherFiles.TodoDir, &Remote{Name: "origin", URL: remoteDir}))
+
+	// When
+	err := push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir})
+
+	// Then
+	assert.True(t, errors.Is(err, ErrRemoteChanged), "expected ErrRemoteChanged, got %v", err)
+	tu.AssertContains(t, "has commits that are not in the local backups", err.Error())
+	tu.AssertContains(t, "delete the branch on the remote to push again", err.Error())
+}
+
+func TestPush_FastForwardWithoutLease(t *testing.T) {
+	// Given
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	assert.NoError(t, push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir}))
+	branch, _ := runGitCmd(files.TodoDir, "git", "symbolic-ref", "--short", "HEAD")
+	runGitCmd(files.TodoDir, "git", "update-ref", "-d", "refs/remotes/origin/"+strings.TrimSpace(branch))
+	util.WriteFile(files.TodoFile, "new content")
+	Save(files, "new save")
+
+	// When
+	err := push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir})
+
+	// Then the remote is an ancestor, so it can be pushed
+	assert.NoError(t, err)
+	local, _ := runGitCmd(files.TodoDir, "git", "rev-parse", "HEAD")
+	remote, _ := runGitCmd(remoteDir, "git", "rev-parse", "HEAD")
+	assert.Equal(t, local, remote)
+}
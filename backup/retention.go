@@ -0,0 +1,228 @@
+package backup
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Age is a period of time like 7 days or 3 months, counted back from now.
+type Age struct {
+	Days    int
+	Months  int
+	Forever bool
+}
+
+var agePattern = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// ParseAge parses periods like 7d, 2w, 3m, 1y or forever. An empty string or 0 is a zero period.
+func ParseAge(s string) (Age, error) {
+	if s == "forever" {
+		return Age{Forever: true}, nil
+	}
+	if s == "" || s == "0" {
+		return Age{}, nil
+	}
+	m := agePattern.FindStringSubmatch(s)
+	if m == nil {
+		return Age{}, fmt.Errorf("invalid period %s, expected e.g. 7d, 2w, 3m, 1y or forever", s)
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "d":
+		return Age{Days: n}, nil
+	case "w":
+		return Age{Days: 7 * n}, nil
+	case "m":
+		return Age{Months: n}, nil
+	default:
+		return Age{Months: 12 * n}, nil
+	}
+}
+
+// includes returns true if t is within the period before now.
+func (a Age) includes(t time.Time, now time.Time) bool {
+	if a.Forever {
+		return true
+	}
+	return t.After(now.AddDate(0, -a.Months, -a.Days))
+}
+
+// RetentionPolicy defines which backups are kept when pruning. All periods are counted back from now:
+// backups younger than KeepAll are all kept, older ones younger than KeepDaily only the newest per day, and so on.
+// Backups older than all periods are removed. The newest backup is always kept.
+type RetentionPolicy struct {
+	KeepAll     Age
+	KeepDaily   Age
+	KeepWeekly  Age
+	KeepMonthly Age
+}
+
+// ParseRetentionPolicy reads the retention policy from the retention section of the backup config.
+func ParseRetentionPolicy(retentionCfg *util.Config) (*RetentionPolicy, error) {
+	var policy RetentionPolicy
+	keys := []string{"keep_all", "keep_daily", "keep_weekly", "keep_monthly"}
+	targets := []*Age{&policy.KeepAll, &policy.KeepDaily, &policy.KeepWeekly, &policy.KeepMonthly}
+	for i, key := range keys {
+		// Not GetString, since YAML reads 0 as int
+		value := fmt.Sprint(retentionCfg.GetByPath(util.ConfigPath{Parts: []string{key}}, ""))
+		age, err := ParseAge(value)
+		if err != nil {
+			return nil, fmt.Errorf("retention %s: %s", key, err)
+		}
+		*targets[i] = age
+	}
+	return &policy, nil
+}
+
+// PruneReport lists the backups kept and removed by a prune.
+type PruneReport struct {
+	DryRun  bool      `json:"dryRun"`
+	Kept    []*Backup `json:"kept"`
+	Removed []*Backup `json:"removed"`
+}
+
+// Prune removes the backups not kept by the policy. With the git backend, each removed backup is squashed into
+// the next newer kept backup, so the kept backups have the same content as before, but new identifiers.
+// With dryRun, only reports what would be removed.
+func Prune(files *util.FileConfig, policy *RetentionPolicy, dryRun bool) (*PruneReport, error) {
+	report := &PruneReport{DryRun: dryRun, Kept: make([]*Backup, 0), Removed: make([]*Backup, 0)}
+
+	repoMutex.Lock()
+	defer repoMutex.Unlock()
+
+	b := currentBackend()
+	backups, err := b.List(files)
+	if err != nil {
+		return nil, err
+	}
+	keep := policy.selectKept(backups, getNow())
+	for i, bk := range backups {
+		if keep[i] {
+			report.Kept = append(report.Kept, bk)
+		} else {
+			report.Removed = append(report.Removed, bk)
+		}
+	}
+	if dryRun || len(report.Removed) == 0 {
+		return report, nil
+	}
+
+	log.Infof("Pruning %d of %d backups\n", len(report.Removed), len(backups))
+	rewritten, err := b.Remove(files, report.Removed)
+	if err != nil {
+		return nil, err
+	}
+	for _, bk := range report.Kept {
+		if id, found := rewritten[bk.Identifier]; found {
+			bk.Identifier = id
+		}
+	}
+	return report, nil
+}
+
+// selectKept returns for each backup (newest first) whether it is kept by the policy.
+func (p *RetentionPolicy) selectKept(backups []*Backup, now time.Time) []bool {
+	keep := make([]bool, len(backups))
+	seenDays := make(map[string]bool)
+	seenWeeks := make(map[string]bool)
+	seenMonths := make(map[string]bool)
+	keepNewestIn := func(seen map[string]bool, bucket string) bool {
+		if seen[bucket] {
+			return false
+		}
+		seen[bucket] = true
+		return true
+	}
+
+	for i, b := range backups {
+		t := b.Timestamp.In(now.Location())
+		year, week := t.ISOWeek()
+		switch {
+		case i == 0 || p.KeepAll.includes(t, now):
+			keep[i] = true
+		case p.KeepDaily.includes(t, now):
+			keep[i] = keepNewestIn(seenDays, t.Format("2006-01-02"))
+		case p.KeepWeekly.includes(t, now):
+			keep[i] = keepNewestIn(seenWeeks, fmt.Sprintf("%d-%d", year, week))
+		case p.KeepMonthly.includes(t, now):
+			keep[i] = keepNewestIn(seenMonths, t.Format("2006-01"))
+		}
+	}
+	return keep
+}
+
+// rewriteHistory recreates the kept commits (newest first) on top of each other and moves the current
+// branch to the new newest commit. Returns the new hash of each kept commit by its old hash.
+func rewriteHistory(repoPath string, commits []*commitEntry, keep []bool) (map[string]string, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	rewritten := make(map[string]string)
+	var parent *plumbing.Hash
+	changed := false
+	for i := len(commits) - 1; i >= 0; i-- {
+		if !keep[i] {
+			changed = true
+			continue
+		}
+		hash := plumbing.NewHash(commits[i].Hash)
+		if changed {
+			hash, err = copyCommit(r, hash, parent)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rewritten[commits[i].Hash] = hash.String()
+		parent = &hash
+	}
+
+	// Fails if a backup was committed in the meantime
+	newHead := plumbing.NewHashReference(head.Name(), *parent)
+	err = r.Storer.CheckAndSetReference(newHead, head)
+	if err != nil {
+		return nil, err
+	}
+	return rewritten, nil
+}
+
+// copyCommit creates a copy of the commit with the new parent, or no parent if it is nil.
+func copyCommit(r *git.Repository, hash plumbing.Hash, parent *plumbing.Hash) (plumbing.Hash, error) {
+	orig, err := r.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return copyCommitWithTree(r, orig, orig.TreeHash, parent)
+}
+
+// copyCommitWithTree creates a copy of the commit with a different tree and the new parent.
+func copyCommitWithTree(r *git.Repository, orig *object.Commit, tree plumbing.Hash, parent *plumbing.Hash) (plumbing.Hash, error) {
+	c := &object.Commit{
+		Author:    orig.Author,
+		Committer: orig.Committer,
+		Message:   orig.Message,
+		TreeHash:  tree,
+	}
+	if parent != nil {
+		c.ParentHashes = []plumbing.Hash{*parent}
+	}
+	obj := r.Storer.NewEncodedObject()
+	err := c.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.Storer.SetEncodedObject(obj)
+}
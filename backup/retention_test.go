@@ -0,0 +1,210 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAge(t *testing.T) {
+	age, err := ParseAge("7d")
+	assert.NoError(t, err)
+	assert.Equal(t, Age{Days: 7}, age)
+
+	age, _ = ParseAge("2w")
+	assert.Equal(t, Age{Days: 14}, age)
+	age, _ = ParseAge("3m")
+	assert.Equal(t, Age{Months: 3}, age)
+	age, _ = ParseAge("1y")
+	assert.Equal(t, Age{Months: 12}, age)
+	age, _ = ParseAge("forever")
+	assert.Equal(t, Age{Forever: true}, age)
+	age, _ = ParseAge("")
+	assert.Equal(t, Age{}, age)
+
+	_, err = ParseAge("7 days")
+	assert.Error(t, err)
+}
+
+func TestParseRetentionPolicy(t *testing.T) {
+	cfg, _ := util.LoadConfigString(`
+keep_all: 7d
+keep_daily: 0
+keep_monthly: forever
+`)
+
+	policy, err := ParseRetentionPolicy(cfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &RetentionPolicy{KeepAll: Age{Days: 7}, KeepMonthly: Age{Forever: true}}, policy)
+}
+
+func TestSelectKept(t *testing.T) {
+	policy := &RetentionPolicy{KeepAll: Age{Days: 7}, KeepDaily: Age{Months: 3}, KeepMonthly: Age{Forever: true}}
+	backups := []*Backup{
+		{Timestamp: tu.Dtt("19.10.2026 10:00")},
+		{Timestamp: tu.Dtt("18.10.2026 09:00")},
+		{Timestamp: tu.Dtt("18.10.2026 08:00")},
+		// Daily
+		{Timestamp: tu.Dtt("10.10.2026 18:00")},
+		{Timestamp: tu.Dtt("10.10.2026 08:00")},
+		{Timestamp: tu.Dtt("09.10.2026 12:00")},
+		// Monthly
+		{Timestamp: tu.Dtt("10.07.2026 12:00")},
+		{Timestamp: tu.Dtt("02.07.2026 12:00")},
+		{Timestamp: tu.Dtt("02.01.2025 12:00")},
+	}
+
+	keep := policy.selectKept(backups, tu.Dtt("19.10.2026 12:00"))
+
+	assert.Equal(t, []bool{true, true, true, true, false, true, true, false, true}, keep)
+}
+
+func TestSelectKept_AlwaysKeepsNewest(t *testing.T) {
+	policy := &RetentionPolicy{}
+	backups := []*Backup{
+		{Timestamp: tu.Dtt("19.01.2026 10:00")},
+		{Timestamp: tu.Dtt("18.01.2026 09:00")},
+	}
+
+	keep := policy.selectKept(backups, tu.Dtt("19.10.2026 12:00"))
+
+	assert.Equal(t, []bool{true, false}, keep)
+}
+
+func TestPrune(t *testing.T) {
+	// Given
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	files, backups := makeBackupsOnDays(todoDir, 1, 1, 2, 3, 3, 3)
+	setFakeTime("05.01.2019 11:30:00")
+	defer resetOriginalTime()
+	policy := &RetentionPolicy{KeepAll: Age{Days: 2}, KeepDaily: Age{Forever: true}}
+
+	// When
+	report, err := Prune(files, policy, false)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"save 5", "save 4", "save 3", "save 2", "save 1"}, messages(report.Kept))
+	assert.Equal(t, []string{"save 0"}, messages(report.Removed))
+	assert.Equal(t, backups[0].Identifier, report.Removed[0].Identifier)
+
+	remaining, _ := ListBackups(files)
+	assert.Equal(t, report.Kept, remaining)
+	content, _ := Content(files, remaining[4].Identifier)
+	assert.Equal(t, "content 1\n", content)
+	content, _ = Content(files, remaining[0].Identifier)
+	assert.Equal(t, "content 5\n", content)
+	_, err = GetBackup(files, backups[0].Identifier)
+	assert.Equal(t, ErrBackupNotFound, err)
+}
+
+func TestPrune_DryRun(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	files, backups := makeBackupsOnDays(todoDir, 1, 1, 2)
+	setFakeTime("05.01.2019 12:00:00")
+	defer resetOriginalTime()
+
+	report, err := Prune(files, &RetentionPolicy{KeepDaily: Age{Forever: true}}, true)
+
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"save 0"}, messages(report.Removed))
+	remaining, _ := ListBackups(files)
+	assert.Equal(t, 3, len(remaining))
+	assert.Equal(t, backups[2], remaining[0])
+}
+
+func TestPushWithLease(t *testing.T) {
+	// Given
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	otherDir := filepath.Join(todoDir, "other")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1, 1, 2)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	assert.NoError(t, push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir}))
+
+	// When pruning rewrites the history
+	setFakeTime("05.01.2019 12:00:00")
+	defer resetOriginalTime()
+	Prune(files, &RetentionPolicy{KeepDaily: Age{Forever: true}}, false)
+	err := push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir})
+
+	// Then it is force-pushed
+	assert.NoError(t, err)
+	local, _ := runGitCmd(files.TodoDir, "git", "rev-parse", "HEAD")
+	remote, _ := runGitCmd(remoteDir, "git", "rev-parse", "HEAD")
+	assert.Equal(t, local, remote)
+
+	// When someone else changed the remote
+	runGitCmd(todoDir, "git", "clone", "-q", remoteDir, otherDir)
+	util.WriteFile(filepath.Join(otherDir, "todo.txt"), "other content")
+	runGitCmd(otherDir, "git", "-c", "user.name=x", "-c", "user.email=x@example.com", "commit", "-q", "-am", "other")
+	runGitCmd(otherDir, "git", "push", "-q")
+	util.WriteFile(files.TodoFile, "new content")
+	Save(files, "new save")
+	Prune(files, &RetentionPolicy{}, false)
+	err = push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir})
+
+	// Then it is not overwritten
+	assert.True(t, errors.Is(err, ErrRemoteChanged), "expected ErrRemoteChanged, got %v", err)
+}
+
+func TestPushWithoutLease_AfterPrune(t *testing.T) {
+	// Given a remote pushed to by an earlier version, which did not record the pushed commit
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1, 1, 2)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	assert.NoError(t, push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir}))
+	branch, _ := runGitCmd(files.TodoDir, "git", "symbolic-ref", "--short", "HEAD")
+	runGitCmd(files.TodoDir, "git", "update-ref", "-d", "refs/remotes/origin/"+strings.TrimSpace(branch))
+
+	// When it is pushed without changes and pruning then rewrites the history
+	assert.NoError(t, push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir}))
+	setFakeTime("05.01.2019 12:00:00")
+	defer resetOriginalTime()
+	Prune(files, &RetentionPolicy{KeepDaily: Age{Forever: true}}, false)
+	err := push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir})
+
+	// Then the up-to-date push recorded the lease, so it is force-pushed
+	assert.NoError(t, err)
+	local, _ := runGitCmd(files.TodoDir, "git", "rev-parse", "HEAD")
+	remote, _ := runGitCmd(remoteDir, "git", "rev-parse", "HEAD")
+	assert.Equal(t, local, remote)
+}
+
+// makeBackupsOnDays creates a backup with new content on each of the days of January 2019.
+func makeBackupsOnDays(todoDir string, days ...int) (*util.FileConfig, []*Backup) {
+	os.MkdirAll(todoDir, 0755)
+	todoFile := filepath.Join(todoDir, "todo.txt")
+	files := util.NewFileConfigFromTodoFile(todoFile)
+	var backups []*Backup
+	for i, d := range days {
+		setFakeTime(fmt.Sprintf("%02d.01.2019 %02d:00:00", d, 8+i))
+		util.WriteFile(todoFile, fmt.Sprintf("content %d\n", i))
+		b, _ := Save(files, fmt.Sprintf("save %d", i))
+		backups = append(backups, b)
+	}
+	resetOriginalTime()
+	return files, backups
+}
+
+func messages(backups []*Backup) []string {
+	var res []string
+	for _, b := range backups {
+		res = append(res, b.Message)
+	}
+	return res
+}
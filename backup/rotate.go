@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// RotateKey re-encrypts all backups, decrypting them with the old cryptor and encrypting them with the new one.
+// Backups that were not encrypted yet are encrypted with the new cryptor, so oldCryptor can also be nil
+// to encrypt the history after enabling encryption. With the git backend, this rewrites the history, so the
+// remote is force-pushed on the next sync. Returns the number of re-encrypted files.
+func RotateKey(files *util.FileConfig, oldCryptor Cryptor, newCryptor Cryptor) (int, error) {
+	repoMutex.Lock()
+	defer repoMutex.Unlock()
+	return currentBackend().RotateKey(files, oldCryptor, newCryptor)
+}
+
+func (g *gitBackend) RotateKey(files *util.FileConfig, oldCryptor Cryptor, newCryptor Cryptor) (int, error) {
+	if !isRepoInitiated(files.TodoDir) {
+		return 0, nil
+	}
+
+	commits, err := listCommits(files.TodoDir)
+	if err != nil || len(commits) == 0 {
+		return 0, err
+	}
+
+	r, err := git.PlainOpen(files.TodoDir)
+	if err != nil {
+		return 0, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return 0, err
+	}
+
+	rt := &treeRotator{r: r, oldCryptor: oldCryptor, newCryptor: newCryptor,
+		blobs: make(map[plumbing.Hash]plumbing.Hash), trees: make(map[plumbing.Hash]plumbing.Hash)}
+	var parent *plumbing.Hash
+	for i := len(commits) - 1; i >= 0; i-- {
+		orig, err := r.CommitObject(plumbing.NewHash(commits[i].Hash))
+		if err != nil {
+			return 0, err
+		}
+		tree, err := rt.rotateTree(orig.TreeHash)
+		if err != nil {
+			return 0, fmt.Errorf("backup %s: %w", commits[i].Hash, err)
+		}
+		hash, err := copyCommitWithTree(r, orig, tree, parent)
+		if err != nil {
+			return 0, err
+		}
+		parent = &hash
+	}
+
+	// Fails if a backup was committed in the meantime
+	err = r.Storer.CheckAndSetReference(plumbing.NewHashReference(head.Name(), *parent), head)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Re-encrypted %d files in %d backups\n", len(rt.blobs), len(commits))
+
+	// Update the index to the new blobs, and free the space of the old ones
+	for _, args := range [][]string{
+		{"git", "reset", "-q"},
+		{"git", "reflog", "expire", "--expire=now", "--all"},
+		{"git", "gc", "--prune=now", "--quiet"},
+	} {
+		_, err = runGitCmd(files.TodoDir, args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(rt.blobs), nil
+}
+
+// treeRotator re-encrypts the .txt files of trees, remembering already rotated blobs and trees
+// since most of them are shared between backups.
+type treeRotator struct {
+	r          *git.Repository
+	oldCryptor Cryptor
+	newCryptor Cryptor
+	blobs      map[plumbing.Hash]plumbing.Hash
+	trees      map[plumbing.Hash]plumbing.Hash
+}
+
+func (rt *treeRotator) rotateTree(hash plumbing.Hash) (plumbing.Hash, error) {
+	if rotated, found := rt.trees[hash]; found {
+		return rotated, nil
+	}
+	tree, err := rt.r.TreeObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	rotated := &object.Tree{}
+	for _, e := range tree.Entries {
+		switch {
+		case e.Mode == filemode.Dir:
+			e.Hash, err = rt.rotateTree(e.Hash)
+		case e.Mode.IsFile() && strings.HasSuffix(e.Name, ".txt"):
+			e.Hash, err = rt.rotateBlob(e.Name, e.Hash)
+		}
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		rotated.Entries = append(rotated.Entries, e)
+	}
+
+	obj := rt.r.Storer.NewEncodedObject()
+	err = rotated.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	rt.trees[hash], err = rt.r.Storer.SetEncodedObject(obj)
+	return rt.trees[hash], err
+}
+
+func (rt *treeRotator) rotateBlob(name string, hash plumbing.Hash) (plumbing.Hash, error) {
+	if rotated, found := rt.blobs[hash]; found {
+		return rotated, nil
+	}
+	content, err := readBlob(rt.r, hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	encrypted, err := reencrypt(name, content, rt.oldCryptor, rt.newCryptor)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	obj := rt.r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	_, err = w.Write([]byte(encrypted))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	w.Close()
+	rt.blobs[hash], err = rt.r.Storer.SetEncodedObject(obj)
+	return rt.blobs[hash], err
+}
+
+// reencrypt decrypts the content with the old cryptor, or takes it as is if it was not encrypted yet,
+// and encrypts it with the new cryptor.
+func reencrypt(name string, content string, oldCryptor Cryptor, newCryptor Cryptor) (string, error) {
+	plain := content
+	var err error
+	if oldCryptor != nil {
+		plain, err = oldCryptor.DecryptString(content)
+	}
+	if oldCryptor == nil || err != nil {
+		if IsEncrypted(content) {
+			return "", fmt.Errorf("cannot decrypt %s with the old key", name)
+		}
+		// Backup from before encryption was enabled
+		plain = content
+	}
+
+	var encrypted strings.Builder
+	err = newCryptor.EncryptContent(strings.NewReader(plain), &encrypted)
+	if err != nil {
+		return "", err
+	}
+	return encrypted.String(), nil
+}
+
+func readBlob(r *git.Repository, hash plumbing.Hash) (string, error) {
+	blob, err := r.BlobObject(hash)
+	if err != nil {
+		return "", err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// findUnencrypted returns the .txt files in any backup that are not encrypted.
+func findUnencrypted(repoPath string) ([]string, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := listCommits(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	checked := make(map[plumbing.Hash]bool)
+	var unencrypted []string
+	for _, ce := range commits {
+		c, err := r.CommitObject(plumbing.NewHash(ce.Hash))
+		if err != nil {
+			return nil, err
+		}
+		fIter, err := c.Files()
+		if err != nil {
+			return nil, err
+		}
+		err = fIter.ForEach(func(f *object.File) error {
+			if !strings.HasSuffix(f.Name, ".txt") || checked[f.Hash] {
+				return nil
+			}
+			checked[f.Hash] = true
+			content, err := readBlob(r, f.Hash)
+			if err != nil {
+				return err
+			}
+			if !IsEncrypted(content) {
+				unencrypted = append(unencrypted, fmt.Sprintf("%s in %s", f.Name, ce.Hash[:8]))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return unencrypted, nil
+}
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateKey(t *testing.T) {
+	// Given
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	initRepo(todoDir)
+	enableTestEncryption(t, todoDir)
+	todoFile := filepath.Join(todoDir, "todo.txt")
+	files := util.NewFileConfigFromTodoFile(todoFile)
+	util.WriteFile(todoFile, "[] line 1\n")
+	Save(files, "save 1")
+	util.WriteFile(todoFile, "[] line 1\n[] line 2\n")
+	Save(files, "save 2")
+	newCryptor := &AESGCMCryptor{Password: "new password"}
+
+	// When
+	count, err := RotateKey(files, &AnsibleCryptor{Password: "password123"}, newCryptor)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	backups, _ := ListBackups(files)
+	assert.Equal(t, []string{"save 2", "save 1"}, messages(backups))
+	raw, _ := runGitCmd(todoDir, "git", "show", backups[1].Identifier+":todo.txt")
+	assert.Equal(t, "[] line 1\n", decrypt(t, newCryptor, raw))
+
+	// And the git filters use the new key
+	util.WriteFile(filepath.Join(todoDir, "sibylgo.yml"), "backup:\n  encryption: aes-gcm\n  encrypt_password: new password\n")
+	content, err := Content(files, backups[0].Identifier)
+	assert.NoError(t, err)
+	assert.Equal(t, "[] line 1\n[] line 2\n", content)
+}
+
+func TestRotateKey_EncryptsPlaintextHistory(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	files, _ := makeBackupsOnDays(todoDir, 1, 2)
+	unencrypted, _ := findUnencrypted(todoDir)
+	assert.Equal(t, 2, len(unencrypted))
+
+	_, err := RotateKey(files, nil, &AESGCMCryptor{Password: "password123"})
+
+	assert.NoError(t, err)
+	unencrypted, _ = findUnencrypted(todoDir)
+	assert.Empty(t, unencrypted)
+}
+
+func TestRotateKey_WrongOldKey(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	files, _ := makeBackupsOnDays(todoDir, 1)
+	RotateKey(files, nil, &AESGCMCryptor{Password: "password123"})
+	before, _ := runGitCmd(todoDir, "git", "rev-parse", "HEAD")
+
+	_, err := RotateKey(files, &AESGCMCryptor{Password: "wrong"}, &AESGCMCryptor{Password: "new"})
+
+	assert.Error(t, err)
+	after, _ := runGitCmd(todoDir, "git", "rev-parse", "HEAD")
+	assert.Equal(t, before, after)
+}
+
+func TestSyncToRemote_StrictRefusesUnencrypted(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	cfg, _ := util.LoadConfigString("remote_url: " + remoteDir + "\nstrict_encryption: true")
+
+	err := SyncToRemote(cfg, files)
+
+	assert.True(t, errors.Is(err, ErrNotEncrypted), "expected ErrNotEncrypted, got %v", err)
+	_, err = runGitCmd(remoteDir, "git", "rev-parse", "--verify", "--quiet", "HEAD")
+	assert.Error(t, err, "expected nothing pushed")
+}
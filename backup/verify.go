@@ -0,0 +1,257 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/util"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+// DefaultVerifyDays is how many days of backups are verified by default.
+const DefaultVerifyDays = 7
+
+// VerifyReport lists the problems found in the backups of one location.
+type VerifyReport struct {
+	// Location is "local" or the name of the remote.
+	Location string
+	// Checked is the number of backups that were decrypted and parsed.
+	Checked  int
+	Problems []string
+}
+
+// OK returns true if no problems were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) addProblem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Verify checks that the backups of the last days can be restored: each backup is decrypted and parsed, and days
+// without any backup are reported. If remotes are configured, each remote is cloned into a temporary directory and
+// verified instead of the local backups, and compared to the local backups.
+func Verify(backupCfg *util.Config, files *util.FileConfig, days int) ([]*VerifyReport, error) {
+	var cryptor Cryptor
+	if EncryptionEnabled(backupCfg) {
+		var err error
+		cryptor, err = NewCryptor(backupCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	since := util.SetToStartOfDay(getNow()).AddDate(0, 0, -days)
+
+	remotes, err := ParseRemotes(backupCfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		report, err := verifyLocal(files, cryptor, since)
+		if err != nil {
+			return nil, err
+		}
+		return []*VerifyReport{report}, nil
+	}
+
+	var reports []*VerifyReport
+	for _, r := range remotes {
+		report, err := verifyRemote(files, r, cryptor, since)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func verifyLocal(files *util.FileConfig, cryptor Cryptor, since time.Time) (*VerifyReport, error) {
+	report := &VerifyReport{Location: "local"}
+	backups, err := ListBackups(files)
+	if err != nil {
+		return nil, err
+	}
+	recent := backupsSince(backups, since)
+	for _, b := range recent {
+		// Read the stored content, since reading decrypted content passes undecryptable content through.
+		content, found, err := currentBackend().ReadStoredFile(files, b, files.TodoFile)
+		if err == nil && found {
+			content, err = decryptBackup(content, cryptor)
+		}
+		checkContent(report, b, content, found, err)
+	}
+	checkDays(report, backups, since)
+	return report, nil
+}
+
+func verifyRemote(files *util.FileConfig, remote *Remote, cryptor Cryptor, since time.Time) (*VerifyReport, error) {
+	report := &VerifyReport{Location: remote.Name}
+	tmpDir, err := ioutil.TempDir("", "sibylgo-verify")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	auth, err := remote.auth()
+	if err != nil {
+		report.addProblem("cannot authenticate: %s", err)
+		return report, nil
+	}
+	r, err := git.PlainClone(tmpDir, true, &git.CloneOptions{URL: remote.URL, Auth: auth})
+	if err == transport.ErrEmptyRemoteRepository {
+		report.addProblem("remote has no backups")
+		return report, nil
+	} else if err != nil {
+		report.addProblem("cannot clone %s: %s", remote.URL, err)
+		return report, nil
+	}
+
+	commits, err := listCommits(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []*Backup
+	for _, c := range commits {
+		backups = append(backups, toBackup(c))
+	}
+	recent := backupsSince(backups, since)
+	todoPath := filepath.ToSlash(relPath(files.TodoDir, files.TodoFile))
+	for _, b := range recent {
+		content, found, err := readCommitFile(r, b.Identifier, todoPath)
+		if err == nil && found {
+			content, err = decryptBackup(content, cryptor)
+		}
+		checkContent(report, b, content, found, err)
+	}
+	checkDays(report, backups, since)
+
+	err = compareToLocal(report, files, recent, since)
+	return report, err
+}
+
+// backupsSince returns the backups since the time. The backups are ordered from newest to oldest.
+func backupsSince(backups []*Backup, since time.Time) []*Backup {
+	for i, b := range backups {
+		if b.Timestamp.Before(since) {
+			return backups[:i]
+		}
+	}
+	return backups
+}
+
+func readCommitFile(r *git.Repository, hash string, file string) (string, bool, error) {
+	c, err := r.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return "", false, err
+	}
+	f, err := c.File(file)
+	if err == object.ErrFileNotFound {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	content, err := f.Contents()
+	return content, true, err
+}
+
+// decryptBackup decrypts the stored content of a backup. With encryption configured, unencrypted content is an
+// error too, since the todos were backed up in plain text.
+func decryptBackup(content string, cryptor Cryptor) (string, error) {
+	if !IsEncrypted(content) {
+		if cryptor != nil {
+			return "", errors.New("backup is not encrypted, although encryption is configured")
+		}
+		return content, nil
+	}
+	if cryptor == nil {
+		return "", fmt.Errorf("backup is encrypted, but no encryption is configured")
+	}
+	return cryptor.DecryptString(content)
+}
+
+// checkContent reports a backup whose todo file could not be read, decrypted or parsed.
+func checkContent(report *VerifyReport, b *Backup, content string, found bool, err error) {
+	report.Checked++
+	name := describeBackup(b)
+	if err != nil {
+		report.addProblem("%s: cannot read: %s", name, err)
+		return
+	}
+	if !found {
+		report.addProblem("%s: does not contain the todo file", name)
+		return
+	}
+	if !utf8.ValidString(content) {
+		report.addProblem("%s: corrupted content, not valid UTF-8", name)
+		return
+	}
+	_, err = parse.String(content)
+	if err != nil {
+		report.addProblem("%s: cannot parse: %s", name, err)
+	}
+}
+
+// checkDays reports the days since the time (or since the first backup) without any backup, excluding today.
+func checkDays(report *VerifyReport, backups []*Backup, since time.Time) {
+	if len(backups) == 0 {
+		report.addProblem("no backups")
+		return
+	}
+	backedUp := make(map[string]bool)
+	for _, b := range backups {
+		backedUp[b.Timestamp.Format("2006-01-02")] = true
+	}
+	first := util.SetToStartOfDay(backups[len(backups)-1].Timestamp)
+	if first.After(since) {
+		since = first
+	}
+	today := util.SetToStartOfDay(getNow())
+	for d := since; d.Before(today); d = d.AddDate(0, 0, 1) {
+		if !backedUp[d.Format("2006-01-02")] {
+			report.addProblem("no backup on %s", d.Format("2006-01-02"))
+		}
+	}
+}
+
+// compareToLocal reports recent local backups missing on the remote and remote backups not in the local backups.
+func compareToLocal(report *VerifyReport, files *util.FileConfig, remoteBackups []*Backup, since time.Time) error {
+	localBackups, err := ListBackups(files)
+	if err != nil {
+		return err
+	}
+	remoteIDs := make(map[string]bool)
+	for _, b := range remoteBackups {
+		remoteIDs[b.Identifier] = true
+	}
+	localIDs := make(map[string]bool)
+	for _, b := range backupsSince(localBackups, since) {
+		localIDs[b.Identifier] = true
+		if !remoteIDs[b.Identifier] {
+			report.addProblem("%s: missing on the remote", describeBackup(b))
+		}
+	}
+	for _, b := range remoteBackups {
+		if !localIDs[b.Identifier] {
+			report.addProblem("%s: not in the local backups", describeBackup(b))
+		}
+	}
+	return nil
+}
+
+func describeBackup(b *Backup) string {
+	id := b.Identifier
+	if len(id) == 40 {
+		id = id[:8]
+	}
+	return fmt.Sprintf("backup %s (%s, %s)", id, b.Timestamp.Format("2006-01-02 15:04"), b.Subject())
+}
@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify_Local(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	useBackend(t, "backend: snapshot")
+	defer resetBackend()
+	files, _ := makeBackupsOnDays(todoDir, 1, 2, 4)
+	setFakeTime("05.01.2019 11:30:00")
+	defer resetOriginalTime()
+	cfg, _ := util.LoadConfigString("backend: snapshot")
+
+	reports, err := Verify(cfg, files, 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*VerifyReport{{Location: "local", Checked: 2, Problems: []string{"no backup on 2019-01-03"}}}, reports)
+}
+
+func TestVerify_LocalEncryption(t *testing.T) {
+	// Given plaintext backups made before encryption was enabled and one encrypted with another password
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	useBackend(t, "backend: snapshot")
+	defer resetBackend()
+	files, _ := makeBackupsOnDays(todoDir, 2, 3)
+	useBackend(t, "backend: snapshot\nencryption: aes-gcm\nencrypt_password: password123")
+	makeBackupsOnDays(todoDir, 4)
+	setFakeTime("05.01.2019 11:30:00")
+	defer resetOriginalTime()
+	cfg, _ := util.LoadConfigString("backend: snapshot\nencryption: aes-gcm\nencrypt_password: otherpassword")
+
+	// When
+	reports, err := Verify(cfg, files, 3)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 3, reports[0].Checked)
+	problems := reports[0].Problems
+	assert.Equal(t, 3, len(problems), "%v", problems)
+	tu.AssertContains(t, "(2019-01-04 08:00, save 0): cannot read: cipher: message authentication failed", problems[0])
+	tu.AssertContains(t, "(2019-01-03 09:00, save 1): cannot read: backup is not encrypted", problems[1])
+	tu.AssertContains(t, "(2019-01-02 08:00, save 0): cannot read: backup is not encrypted", problems[2])
+}
+
+func TestVerify_Remote(t *testing.T) {
+	// Given a remote with plaintext backups, a backup that was not pushed from here and one that can't be decrypted
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	otherDir := filepath.Join(todoDir, "other")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1, 2, 3)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	assert.NoError(t, push(files.TodoDir, &Remote{Name: "origin", URL: remoteDir}))
+	cryptor := &AESGCMCryptor{Password: "password123"}
+	runGitCmd(todoDir, "git", "clone", "-q", remoteDir, otherDir)
+	for _, content := range []string{encrypt(t, cryptor, "[] secret\n"), "$SIBYLGO_AESGCM;1;argon2id;t=1,m=65536,p=4\nbroken\n"} {
+		util.WriteFile(filepath.Join(otherDir, "todo.txt"), content)
+		runGitCmd(otherDir, "git", "-c", "user.name=x", "-c", "user.email=x@example.com", "commit", "-q", "-am", "other")
+	}
+	runGitCmd(otherDir, "git", "push", "-q")
+	other, _ := runGitCmd(otherDir, "git", "log", "--format=%H", "-n", "2")
+	otherIDs := strings.Fields(other)
+	util.WriteFile(files.TodoFile, "[] local only\n")
+	setFakeTime("04.01.2019 09:00:00")
+	defer resetOriginalTime()
+	local, _ := Save(files, "local only")
+	setFakeTime("05.01.2019 11:30:00")
+	cfg, _ := util.LoadConfigString("remote_url: " + remoteDir + "\nencryption: aes-gcm\nencrypt_password: password123")
+
+	// When
+	reports, err := Verify(cfg, files, 3)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, "origin", reports[0].Location)
+	assert.Equal(t, 4, reports[0].Checked, "backups since 02.01.2019")
+	problems := reports[0].Problems
+	assert.Equal(t, 7, len(problems), "%v", problems)
+	tu.AssertContains(t, "backup "+otherIDs[0][:8], problems[0])
+	tu.AssertContains(t, "cannot read", problems[0])
+	tu.AssertContains(t, "(2019-01-03 10:00, save 2): cannot read: backup is not encrypted", problems[1])
+	tu.AssertContains(t, "(2019-01-02 09:00, save 1): cannot read: backup is not encrypted", problems[2])
+	assert.Equal(t, "no backup on 2019-01-04", problems[3])
+	assert.Equal(t, "backup "+local.Identifier[:8]+" (2019-01-04 09:00, local only): missing on the remote", problems[4])
+	tu.AssertContains(t, "backup "+otherIDs[0][:8], problems[5])
+	tu.AssertContains(t, "not in the local backups", problems[5])
+	tu.AssertContains(t, "backup "+otherIDs[1][:8], problems[6])
+}
+
+func TestVerify_EmptyRemote(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_backup_test")
+	defer tu.DeleteTempDir(todoDir)
+	remoteDir := filepath.Join(todoDir, "remote.git")
+	files, _ := makeBackupsOnDays(filepath.Join(todoDir, "local"), 1)
+	runGitCmd(todoDir, "git", "init", "--bare", "-q", remoteDir)
+	cfg, _ := util.LoadConfigString("remote_url: " + remoteDir)
+
+	reports, err := Verify(cfg, files, 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"remote has no backups"}, reports[0].Problems)
+}
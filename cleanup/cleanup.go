@@ -35,10 +35,11 @@ func MoveDoneToTrashFile(todoFilePath string, trashFilePath string, onlyTopLevel
 ------------------
 `, getNow().Format("02.01.2006 15:04:05"))
 
-	util.WriteFile(todoFilePath, kept)
-	util.AppendFile(trashFilePath, header+deleted)
-
-	return nil
+	err = util.WriteFileIfUnchanged(todoFilePath, rawTodoContent, kept)
+	if err != nil {
+		return err
+	}
+	return util.AppendFile(trashFilePath, header+deleted)
 }
 
 // MoveDoneToEndOfFile moves all done moments in the todo file to the end of that file.
@@ -57,9 +58,7 @@ func MoveDoneToEndOfFile(todoFilePath string, onlyTopLevel bool) error {
 	}
 
 	kept, deleted := modify.Delete(rawTodoContent, done)
-	util.WriteFile(todoFilePath, kept+"\n"+deleted)
-
-	return nil
+	return util.WriteFileIfUnchanged(todoFilePath, rawTodoContent, kept+"\n"+deleted)
 }
 
 // SeparateDoneFromString separates the moments from the raw content string into
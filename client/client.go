@@ -0,0 +1,480 @@
+// Package client is a typed Go client for the sibylgo REST API, see api/openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/auth"
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/calendar"
+	"github.com/sandro-h/sibylgo/history"
+	"github.com/sandro-h/sibylgo/instances"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/preview"
+	"github.com/sandro-h/sibylgo/query"
+	"github.com/sandro-h/sibylgo/reminder"
+	"github.com/sandro-h/sibylgo/scheduler"
+	"github.com/sandro-h/sibylgo/status"
+)
+
+// DefaultURL is the address the backend listens on by default.
+const DefaultURL = "http://localhost:8082"
+
+// Client calls the REST API of a sibylgo backend.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	hmacSecret string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates all requests with the bearer token (rest.auth_token).
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHMACSecret signs all requests with the secret (rest.hmac_secret).
+func WithHMACSecret(secret string) Option {
+	return func(c *Client) { c.hmacSecret = secret }
+}
+
+// WithHTTPClient uses a custom http.Client, e.g. to trust a self-signed certificate.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithUnixSocket connects to the backend through a Unix domain socket (rest.socket).
+// The host of the base URL is ignored in this case.
+func WithUnixSocket(socket string) Option {
+	return func(c *Client) {
+		c.httpClient = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}}
+	}
+}
+
+// New creates a client for the backend at baseURL, e.g. http://localhost:8082.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Error is returned if the backend responds with an error. It contains the fields of the
+// error envelope.
+type Error struct {
+	StatusCode int                    `json:"-"`
+	Code       string                 `json:"code"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details"`
+	DocCoords  *moment.DocCoords      `json:"docCoords"`
+	RequestID  string                 `json:"requestId"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// FormatRange is a range of the todo content with a formatting style.
+type FormatRange struct {
+	Start int
+	End   int
+	Style string
+}
+
+// FoldRange is a foldable range of lines.
+type FoldRange struct {
+	StartLine int
+	EndLine   int
+}
+
+// WeeklyReminders are the moments due on a day and in its week.
+type WeeklyReminders struct {
+	Today []*instances.Instance `json:"today"`
+	Week  []*instances.Instance `json:"week"`
+}
+
+// Status is the status of the backend.
+type Status struct {
+	status.Status
+	Version   string                `json:"version"`
+	StartedAt time.Time             `json:"startedAt"`
+	TodoFile  string                `json:"todoFile"`
+	Jobs      []scheduler.JobStatus `json:"jobs"`
+}
+
+// Format computes the editor formatting of the todo content.
+func (c *Client) Format(content string) ([]FormatRange, error) {
+	lines, err := c.postContentLines("/format", content)
+	if err != nil {
+		return nil, err
+	}
+	var res []FormatRange
+	for _, l := range lines {
+		parts := strings.SplitN(l, ",", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unexpected format line %q", l)
+		}
+		start, err1 := strconv.Atoi(parts[0])
+		end, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("unexpected format line %q", l)
+		}
+		res = append(res, FormatRange{Start: start, End: end, Style: parts[2]})
+	}
+	return res, nil
+}
+
+// Folding computes the foldable line ranges of the todo content.
+func (c *Client) Folding(content string) ([]FoldRange, error) {
+	lines, err := c.postContentLines("/folding", content)
+	if err != nil {
+		return nil, err
+	}
+	var res []FoldRange
+	for _, l := range lines {
+		var r FoldRange
+		_, err := fmt.Sscanf(l, "%d-%d", &r.StartLine, &r.EndLine)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected folding line %q", l)
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// Clean moves done moments to the end of the todo file.
+func (c *Client) Clean() error {
+	return c.do("POST", "/clean", nil, nil)
+}
+
+// Trash moves done moments to the trash file.
+func (c *Client) Trash() error {
+	return c.do("POST", "/trash", nil, nil)
+}
+
+// CalendarEntries returns the calendar entries between start and end.
+func (c *Client) CalendarEntries(start time.Time, end time.Time) ([]calendar.Entry, error) {
+	q := url.Values{"start": {isoDate(start)}, "end": {isoDate(end)}}
+	var res []calendar.Entry
+	err := c.do("GET", "/moments?"+q.Encode(), nil, &res)
+	return res, err
+}
+
+// InsertMoment inserts a new moment at the top of the category. An empty category inserts
+// it before the first category.
+func (c *Client) InsertMoment(name string, category string) error {
+	q := url.Values{"name": {name}}
+	if category != "" {
+		q.Set("category", category)
+	}
+	return c.do("POST", "/moments?"+q.Encode(), nil, nil)
+}
+
+// WeeklyReminders returns the moments due on the date and in its week.
+func (c *Client) WeeklyReminders(date time.Time) (*WeeklyReminders, error) {
+	var res WeeklyReminders
+	err := c.do("GET", "/reminders/"+isoDate(date)+"/weekly", nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetVacation returns the vacation set with SetVacation, or nil if none is set.
+func (c *Client) GetVacation() (*reminder.Vacation, error) {
+	return c.doVacation("GET", "/reminders/vacation")
+}
+
+// SetVacation sets the vacation from the from to the to day, inclusive, during which only critical reminders
+// are sent. It replaces the one set before.
+func (c *Client) SetVacation(from time.Time, to time.Time) (*reminder.Vacation, error) {
+	q := url.Values{"from": {isoDate(from)}, "to": {isoDate(to)}}
+	return c.doVacation("PUT", "/reminders/vacation?"+q.Encode())
+}
+
+// ClearVacation clears the vacation set with SetVacation.
+func (c *Client) ClearVacation() error {
+	_, err := c.doVacation("DELETE", "/reminders/vacation")
+	return err
+}
+
+func (c *Client) doVacation(method string, path string) (*reminder.Vacation, error) {
+	var res struct {
+		Vacation *reminder.Vacation `json:"vacation"`
+	}
+	err := c.do(method, path, nil, &res)
+	return res.Vacation, err
+}
+
+// DescribeAction returns what the action link token from a reminder does, without applying it.
+func (c *Client) DescribeAction(token string) (string, error) {
+	return c.doAction("GET", token)
+}
+
+// ApplyAction applies the action link token from a reminder to the todo file and returns what was done.
+// Every token can only be used once.
+func (c *Client) ApplyAction(token string) (string, error) {
+	return c.doAction("POST", token)
+}
+
+func (c *Client) doAction(method string, token string) (string, error) {
+	var res struct {
+		Message string `json:"message"`
+	}
+	err := c.do(method, "/actions/"+url.PathEscape(token), nil, &res)
+	return res.Message, err
+}
+
+// Preview returns the preview of the todo file.
+func (c *Client) Preview() (*preview.Preview, error) {
+	var res preview.Preview
+	err := c.do("GET", "/preview", nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PreviewContent returns the preview of the passed todo content.
+func (c *Client) PreviewContent(content string) (*preview.Preview, error) {
+	var res preview.Preview
+	err := c.do("POST", "/preview", encodeContent(content), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SearchResult contains the moments matching a query.
+type SearchResult struct {
+	Query   string         `json:"query"`
+	Results []query.Result `json:"results"`
+}
+
+// Search returns the moments in the todo file matching the query, see the query package.
+func (c *Client) Search(q string) (*SearchResult, error) {
+	var res SearchResult
+	err := c.do("GET", "/search?"+url.Values{"q": {q}}.Encode(), nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ReloadConfig reloads sibylgo.yml and returns the applied changes.
+func (c *Client) ReloadConfig() ([]string, error) {
+	var res struct {
+		Changes []string `json:"changes"`
+	}
+	err := c.do("POST", "/admin/reload", nil, &res)
+	return res.Changes, err
+}
+
+// Jobs returns the scheduled background jobs.
+func (c *Client) Jobs() ([]scheduler.JobStatus, error) {
+	var res []scheduler.JobStatus
+	err := c.do("GET", "/jobs", nil, &res)
+	return res, err
+}
+
+// RunJob triggers the job immediately.
+func (c *Client) RunJob(name string) error {
+	return c.do("POST", "/jobs/"+url.PathEscape(name)+"/run", nil, nil)
+}
+
+// MomentHistory returns the changes of the moment with the ID or name across the backups, oldest first.
+func (c *Client) MomentHistory(id string) ([]*history.Entry, error) {
+	var res []*history.Entry
+	err := c.do("GET", "/moments/"+url.PathEscape(id)+"/history", nil, &res)
+	return res, err
+}
+
+// RestoreMoment copies a deleted moment from the backup, or the newest backup containing it if backupID is empty,
+// back into the todo file and returns the restored text.
+func (c *Client) RestoreMoment(id string, backupID string) (string, error) {
+	path := "/moments/" + url.PathEscape(id) + "/restore"
+	if backupID != "" {
+		path += "?" + url.Values{"backup": {backupID}}.Encode()
+	}
+	var res struct {
+		Text string `json:"text"`
+	}
+	err := c.do("POST", path, nil, &res)
+	return res.Text, err
+}
+
+// BackupContent is a backup with the content of the todo file at that point.
+type BackupContent struct {
+	backup.Backup
+	Content string `json:"content"`
+}
+
+// Backups returns the backups of the todo file, newest first.
+func (c *Client) Backups() ([]*backup.Backup, error) {
+	var res []*backup.Backup
+	err := c.do("GET", "/backups", nil, &res)
+	return res, err
+}
+
+// Backup returns the backup with the id and its content.
+func (c *Client) Backup(id string) (*BackupContent, error) {
+	var res BackupContent
+	err := c.do("GET", "/backups/"+url.PathEscape(id), nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// BackupDiff returns a unified diff between the backup and the backup against,
+// or the current todo file if against is empty.
+func (c *Client) BackupDiff(id string, against string) (string, error) {
+	path := "/backups/" + url.PathEscape(id) + "/diff"
+	if against != "" {
+		path += "?" + url.Values{"against": {against}}.Encode()
+	}
+	data, err := c.doRaw("GET", path, nil)
+	return string(data), err
+}
+
+// RestoreBackup restores the todo and trash file from the backup and returns the restore backup.
+func (c *Client) RestoreBackup(id string) (*backup.Backup, error) {
+	var res backup.Backup
+	err := c.do("POST", "/backups/"+url.PathEscape(id)+"/restore", nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PruneBackups removes the backups not kept by the retention policy, or with dryRun only reports what would be removed.
+func (c *Client) PruneBackups(dryRun bool) (*backup.PruneReport, error) {
+	var res backup.PruneReport
+	err := c.do("POST", "/backups/prune?"+url.Values{"dryRun": {strconv.FormatBool(dryRun)}}.Encode(), nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Health returns nil if the backend is healthy.
+func (c *Client) Health() error {
+	return c.do("GET", "/health", nil, nil)
+}
+
+// Status returns the status of the backend and its background work.
+func (c *Client) Status() (*Status, error) {
+	var res Status
+	err := c.do("GET", "/status", nil, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Metrics returns the metrics in the Prometheus text format.
+func (c *Client) Metrics() (string, error) {
+	data, err := c.doRaw("GET", "/metrics", nil)
+	return string(data), err
+}
+
+// OpenAPISpec returns the OpenAPI document of the backend.
+func (c *Client) OpenAPISpec() ([]byte, error) {
+	return c.doRaw("GET", "/openapi.json", nil)
+}
+
+func (c *Client) postContentLines(path string, content string) ([]string, error) {
+	data, err := c.doRaw("POST", path, encodeContent(content))
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, l := range strings.Split(string(data), "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+func (c *Client) do(method string, path string, body []byte, res interface{}) error {
+	data, err := c.doRaw(method, path, body)
+	if err != nil || res == nil {
+		return err
+	}
+	return json.Unmarshal(data, res)
+}
+
+func (c *Client) doRaw(method string, path string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	// E.g. the action links answer with HTML pages otherwise
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.hmacSecret != "" {
+		req.Header.Set(auth.SignatureHeader, auth.SignatureHeaderValue(c.hmacSecret, method, req.URL.RequestURI(), body))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, parseError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+func parseError(statusCode int, data []byte) error {
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if json.Unmarshal(data, &envelope) != nil || envelope.Error == nil {
+		return &Error{StatusCode: statusCode, Message: strings.TrimSpace(string(data))}
+	}
+	envelope.Error.StatusCode = statusCode
+	return envelope.Error
+}
+
+func encodeContent(content string) []byte {
+	return []byte(base64.StdEncoding.EncodeToString([]byte(content)))
+}
+
+func isoDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sandro-h/sibylgo/auth"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	var received string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST /format", r.Method+" "+r.URL.Path)
+		body, _ := ioutil.ReadAll(r.Body)
+		decoded, _ := base64.StdEncoding.DecodeString(string(body))
+		received = string(decoded)
+		fmt.Fprint(w, "0,8,mom\n9,13,date\n")
+	})
+
+	res, err := c.Format("[] foo (1.1.20)")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "[] foo (1.1.20)", received)
+	assert.Equal(t, []FormatRange{{0, 8, "mom"}, {9, 13, "date"}}, res)
+}
+
+func TestFolding(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "0-2\n4-7\n")
+	})
+
+	res, err := c.Folding("content")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []FoldRange{{0, 2}, {4, 7}}, res)
+}
+
+func TestCalendarEntries(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/moments?end=2019-01-31&start=2019-01-01", r.URL.RequestURI())
+		fmt.Fprint(w, `[{"title":"foo","start":"2019-01-04","end":"2019-01-05","color":"#fff"}]`)
+	})
+
+	res, err := c.CalendarEntries(tu.Dt("01.01.2019"), tu.Dt("31.01.2019"))
+
+	assert.Nil(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, "foo", res[0].Title)
+	assert.Equal(t, "#fff", res[0].Color)
+}
+
+func TestInsertMoment(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/moments?category=Work+stuff&name=new+moment", r.URL.RequestURI())
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{"message": "Inserted moment"}`)
+	})
+
+	assert.Nil(t, c.InsertMoment("new moment", "Work stuff"))
+}
+
+func TestWeeklyReminders(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/reminders/2019-01-04/weekly", r.URL.Path)
+		fmt.Fprint(w, `{"today":[{"name":"foo","workState":"inProgress","originDocCoords":{"lineNumber":3}}],"week":null}`)
+	})
+
+	res, err := c.WeeklyReminders(tu.Dt("04.01.2019"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "foo", res.Today[0].Name)
+	assert.Equal(t, "inProgress", string(res.Today[0].WorkState))
+	assert.Equal(t, 3, res.Today[0].OriginDocCoords.LineNumber)
+	assert.Empty(t, res.Week)
+}
+
+func TestVacation(t *testing.T) {
+	var requests []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.Method == "DELETE" {
+			fmt.Fprint(w, `{"vacation":null}`)
+			return
+		}
+		fmt.Fprint(w, `{"vacation":{"from":"2019-01-04","to":"2019-01-06"}}`)
+	})
+
+	set, err := c.SetVacation(tu.Dt("04.01.2019"), tu.Dt("06.01.2019"))
+	assert.Nil(t, err)
+	got, err := c.GetVacation()
+	assert.Nil(t, err)
+	assert.Nil(t, c.ClearVacation())
+
+	assert.Equal(t, []string{
+		"PUT /reminders/vacation?from=2019-01-04&to=2019-01-06",
+		"GET /reminders/vacation",
+		"DELETE /reminders/vacation",
+	}, requests)
+	assert.Equal(t, tu.Dt("04.01.2019"), set.From)
+	assert.True(t, got.Contains(tu.Dtt("06.01.2019 23:00")))
+}
+
+func TestVacation_None(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"vacation":null}`)
+	})
+
+	v, err := c.GetVacation()
+
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestActions(t *testing.T) {
+	var requests []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		if r.Method == "GET" {
+			fmt.Fprint(w, `{"message":"Mark foo as done"}`)
+			return
+		}
+		w.WriteHeader(410)
+		fmt.Fprint(w, `{"error":{"code":"gone","message":"action link was already used"}}`)
+	})
+
+	desc, err := c.DescribeAction("abc.def")
+	assert.Nil(t, err)
+	_, applyErr := c.ApplyAction("abc.def")
+
+	assert.Equal(t, []string{"GET /actions/abc.def", "POST /actions/abc.def"}, requests)
+	assert.Equal(t, "Mark foo as done", desc)
+	assert.Equal(t, "gone", applyErr.(*Error).Code)
+	assert.Equal(t, 410, applyErr.(*Error).StatusCode)
+}
+
+func TestSearch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "state:open @phone", r.URL.Query().Get("q"))
+		fmt.Fprint(w, `{"query":"state:open @phone","results":[{"name":"call","path":"x/call","docCoords":{"lineNumber":4}}]}`)
+	})
+
+	res, err := c.Search("state:open @phone")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "x/call", res.Results[0].Path)
+	assert.Equal(t, 4, res.Results[0].DocCoords.LineNumber)
+}
+
+func TestBackup(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/backups/abc123", r.URL.Path)
+		fmt.Fprint(w, `{"id":"abc123","timestamp":"2026-10-19T10:00:00Z","message":"Daily backup","content":"[] foo\n"}`)
+	})
+
+	b, err := c.Backup("abc123")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", b.Identifier)
+	assert.Equal(t, "Daily backup", b.Message)
+	assert.Equal(t, "[] foo\n", b.Content)
+}
+
+func TestBackupDiff(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/backups/abc123/diff", r.URL.Path)
+		assert.Equal(t, "def456", r.URL.Query().Get("against"))
+		fmt.Fprint(w, "-[] foo\n+[] bar\n")
+	})
+
+	diff, err := c.BackupDiff("abc123", "def456")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "-[] foo\n+[] bar\n", diff)
+}
+
+func TestMomentHistory(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/moments/b1/history", r.URL.Path)
+		fmt.Fprint(w, `[{"backupId":"abc","timestamp":"2026-10-19T10:00:00Z","text":"[x] bar #b1","workState":"done","comments":[],"changes":["state changed from new to done"]}]`)
+	})
+
+	entries, err := c.MomentHistory("b1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", entries[0].BackupID)
+	assert.Equal(t, []string{"state changed from new to done"}, entries[0].Changes)
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(422)
+		fmt.Fprint(w, `{"error":{"code":"parse_error","message":"line 3: bad","docCoords":{"lineNumber":2,"offset":10,"length":0},"requestId":"abc"}}`)
+	})
+
+	_, err := c.PreviewContent("content")
+
+	apiErr, ok := err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, 422, apiErr.StatusCode)
+	assert.Equal(t, "parse_error", apiErr.Code)
+	assert.Equal(t, 2, apiErr.DocCoords.LineNumber)
+	assert.Equal(t, "abc", apiErr.RequestID)
+	assert.Equal(t, "422 parse_error: line 3: bad", err.Error())
+}
+
+func TestPlainTextError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "proxy error", 502)
+	})
+
+	err := c.Health()
+
+	assert.Equal(t, &Error{StatusCode: 502, Message: "proxy error"}, err)
+}
+
+func TestTokenAuth(t *testing.T) {
+	handler := auth.Middleware(auth.Options{Token: "s3cret"})(http.HandlerFunc(ok))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	assert.NotNil(t, New(srv.URL).Clean())
+	assert.Nil(t, New(srv.URL, WithToken("s3cret")).Clean())
+}
+
+func TestHMACAuth(t *testing.T) {
+	handler := auth.Middleware(auth.Options{HMACSecret: "s3cret"})(http.HandlerFunc(ok))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	c := New(srv.URL, WithHMACSecret("s3cret"))
+	assert.Nil(t, c.InsertMoment("foo", "bar"))
+	_, err := c.PreviewContent("content")
+	assert.Nil(t, err)
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "{}")
+}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return New(srv.URL)
+}
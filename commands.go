@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/history"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// command is a CLI subcommand, e.g. sibylgo backup list.
+type command struct {
+	usage string
+	run   func(args []string, out io.Writer) error
+}
+
+var commands = map[string]command{
+	"backup list":       {"backup list", runBackupList},
+	"backup show":       {"backup show <id>", runBackupShow},
+	"backup diff":       {"backup diff <id> [<against id>]", runBackupDiff},
+	"backup restore":    {"backup restore <id>", runBackupRestore},
+	"backup prune":      {"backup prune [--dry-run]", runBackupPrune},
+	"backup rotate-key": {"backup rotate-key [<old config file>]", runBackupRotateKey},
+	"backup verify":     {"backup verify [--days <n>]", runBackupVerify},
+	"history":           {"history <moment id or name>", runHistory},
+	"search":            {"search <query>", runSearch},
+	"history restore":   {"history restore <moment id or name> [<backup id>]", runHistoryRestore},
+}
+
+var errUsage = errors.New("invalid arguments")
+
+// runCommand runs the subcommand given by the CLI args (after the flags).
+func runCommand(cfg *util.Config, args []string, out io.Writer) error {
+	cmd, cmdArgs, found := findCommand(args)
+	if !found {
+		return fmt.Errorf("unknown command %s, usage:\n%s", strings.Join(args, " "), usage())
+	}
+
+	currentCfg = cfg
+	setFiles(util.NewFileConfigFromConfig(cfg))
+	if files.TodoFile == "" {
+		return errors.New("todoFile is not set")
+	}
+	err := backup.Configure(cfg.GetSubConfig("backup"))
+	if err != nil {
+		return err
+	}
+	err = cmd.run(cmdArgs, out)
+	if err == errUsage {
+		return fmt.Errorf("usage: sibylgo %s", cmd.usage)
+	}
+	return err
+}
+
+// findCommand returns the command with the longest name matching the start of args, and the remaining args.
+func findCommand(args []string) (command, []string, bool) {
+	if len(args) >= 2 {
+		if cmd, found := commands[args[0]+" "+args[1]]; found {
+			return cmd, args[2:], true
+		}
+	}
+	cmd, found := commands[args[0]]
+	return cmd, args[1:], found
+}
+
+func usage() string {
+	var lines []string
+	for _, c := range commands {
+		lines = append(lines, "  sibylgo "+c.usage)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func runBackupList(args []string, out io.Writer) error {
+	backups, err := listBackups()
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		fmt.Fprintf(out, "%s  %s  %s\n", shortID(b.Identifier), b.Timestamp.Format("2006-01-02 15:04:05"), b.Subject())
+	}
+	return nil
+}
+
+func runBackupShow(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	content, err := backup.Content(files, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, content)
+	return nil
+}
+
+func runBackupDiff(args []string, out io.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	against := ""
+	if len(args) == 2 {
+		against = args[1]
+	}
+	diff, err := backup.Diff(files, args[0], against)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, diff)
+	return nil
+}
+
+func runBackupRestore(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	restored, err := doRestoreBackup(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s\n", restored.Message)
+	return nil
+}
+
+func runHistory(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	entries, err := history.Get(files, args[0])
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		id := "current "
+		if e.BackupID != "" {
+			id = shortID(e.BackupID)
+		}
+		fmt.Fprintf(out, "%s  %s  %s\n", id, e.Timestamp.Format("2006-01-02 15:04:05"), strings.Join(e.Changes, ", "))
+		fmt.Fprintf(out, "    %s\n", e.Text)
+	}
+	return nil
+}
+
+func runHistoryRestore(args []string, out io.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	backupID := ""
+	if len(args) == 2 {
+		backupID = args[1]
+	}
+	restored, err := doRestoreMoment(args[0], backupID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, restored)
+	return nil
+}
+
+func runBackupPrune(args []string, out io.Writer) error {
+	dryRun := false
+	for _, a := range args {
+		if a != "-n" && a != "--dry-run" {
+			return errUsage
+		}
+		dryRun = true
+	}
+	report, err := pruneBackups(dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	for _, b := range report.Removed {
+		fmt.Fprintf(out, "%s %s  %s  %s\n", verb, shortID(b.Identifier), b.Timestamp.Format("2006-01-02 15:04:05"), b.Subject())
+	}
+	fmt.Fprintf(out, "%s %d backups, keeping %d\n", verb, len(report.Removed), len(report.Kept))
+	return nil
+}
+
+func runBackupRotateKey(args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	backupCfg := currentCfg.GetSubConfig("backup")
+	if !backup.EncryptionEnabled(backupCfg) {
+		return errors.New("backup encryption is not configured")
+	}
+	newCryptor, err := backup.NewCryptor(backupCfg)
+	if err != nil {
+		return err
+	}
+
+	var oldCryptor backup.Cryptor
+	if len(args) == 1 {
+		if !util.Exists(args[0]) {
+			return fmt.Errorf("old config %s does not exist", args[0])
+		}
+		// Like the current config, so secrets, ${ENV} references and _file keys resolve
+		oldCfg, err := readConfig(args[0])
+		if err != nil {
+			return fmt.Errorf("old config: %s", err)
+		}
+		oldCryptor, err = backup.NewCryptor(oldCfg.GetSubConfig("backup"))
+		if err != nil {
+			return fmt.Errorf("old config: %s", err)
+		}
+	}
+
+	count, err := backup.RotateKey(files, oldCryptor, newCryptor)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Re-encrypted %d files\n", count)
+	if backup.HasRemotes(backupCfg) && count > 0 {
+		return backup.SyncToRemote(backupCfg, files)
+	}
+	return nil
+}
+
+func runBackupVerify(args []string, out io.Writer) error {
+	backupCfg := currentCfg.GetSubConfig("backup")
+	days := backupCfg.GetInt("verify_days", backup.DefaultVerifyDays)
+	if len(args) == 2 && args[0] == "--days" {
+		var err error
+		days, err = strconv.Atoi(args[1])
+		if err != nil || days < 0 {
+			return errUsage
+		}
+	} else if len(args) > 0 {
+		return errUsage
+	}
+
+	reports, err := backup.Verify(backupCfg, files, days)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, r := range reports {
+		fmt.Fprintf(out, "%s: checked %d backups, %d problems\n", r.Location, r.Checked, len(r.Problems))
+		for _, p := range r.Problems {
+			fmt.Fprintf(out, "  %s\n", p)
+		}
+		count += len(r.Problems)
+	}
+	if count > 0 {
+		return fmt.Errorf("found %d problems", count)
+	}
+	return nil
+}
+
+// shortID abbreviates git commit hashes like git does. Other backup identifiers are kept as is.
+func shortID(id string) string {
+	if len(id) == 40 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sandro-h/sibylgo/actions"
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/clock"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/preview"
+	"github.com/sandro-h/sibylgo/query"
+	"github.com/sandro-h/sibylgo/reminder"
+	"github.com/sandro-h/sibylgo/scheduler"
+	"github.com/sandro-h/sibylgo/supervisor"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const configWatchInterval = 2 * time.Second
+
+var mailKeys = []string{"mailHost", "mailPort", "mailFrom", "mailTo", "mailUser", "mailPassword"}
+var reminderKeys = append([]string{"notifiers", "reminders", "actions"}, mailKeys...)
+var restKeys = []string{"host", "port", "optimized_format", "rest"}
+
+var configPath string
+var previewViews []preview.View
+var currentCfg = &util.Config{}
+var configMutex sync.Mutex
+
+// runtimeMu guards files, actionSigner and previewViews, which are replaced on reloads while the REST handlers
+// use them. Outside of applyConfig, they are read with currentFiles, currentActionSigner and currentViews.
+var runtimeMu sync.RWMutex
+
+// invalidConfigError is returned by applyConfig if the new config is invalid.
+type invalidConfigError struct {
+	err error
+}
+
+func (e *invalidConfigError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidConfigError) Unwrap() error {
+	return e.err
+}
+
+// applyConfig compares the new config with the currently active one and (re-)initializes
+// all parts of the backend whose config sections changed. On the first call, oldCfg is
+// nil and everything configured is started.
+func applyConfig(oldCfg *util.Config, newCfg *util.Config) ([]util.ConfigChange, error) {
+	err := validateConfig(newCfg)
+	if err != nil {
+		return nil, &invalidConfigError{err}
+	}
+
+	initial := oldCfg == nil
+	if initial {
+		oldCfg = &util.Config{}
+	}
+	changes := util.DiffConfigs(oldCfg, newCfg)
+
+	log.SetLevel(getConfigLogLevel(newCfg))
+
+	if util.ChangesTouch(changes, "parse") {
+		parse.ParseConfig.BackingCfg = newCfg.GetSubConfig("parse")
+		parse.ResetConfig()
+	}
+
+	if util.ChangesTouch(changes, "views") {
+		// Already validated, so there are no errors.
+		views, _ := loadViews(newCfg)
+		runtimeMu.Lock()
+		previewViews = views
+		runtimeMu.Unlock()
+	}
+
+	todoChanged := initial || util.ChangesTouch(changes, "todoFile")
+	if todoChanged {
+		setFiles(util.NewFileConfigFromConfig(newCfg))
+		if files.TodoFile != "" {
+			log.Infof("Using todo file %s\n", files.TodoFile)
+		}
+	}
+
+	if initial {
+		services.Start(schedulerService, jobs.Run)
+	}
+	// Schedule changes are cheap to apply, so just reschedule all jobs.
+	scheduleChanged := util.ChangesTouch(changes, "schedule")
+
+	// The backup verification mails the problems
+	if todoChanged || scheduleChanged || util.ChangesTouch(changes, "backup") ||
+		(newCfg.GetSubConfig("backup").GetBool("verify", false) && util.ChangesTouch(changes, mailKeys...)) {
+		stopJob(backupJob, "daily backup")
+		stopJob(pruneJob, "backup pruning")
+		stopScheduledPushes()
+		if services.Stop(changeBackupService) {
+			log.Info("Stopped backups after changes\n")
+		}
+		if files.TodoFile != "" {
+			startBackups(newCfg)
+		}
+	}
+
+	// Already validated, so there are no errors.
+	signer, _ := newActionSigner(newCfg)
+	runtimeMu.Lock()
+	actionSigner = signer
+	runtimeMu.Unlock()
+
+	// The default base URL of the action links is the REST server
+	if todoChanged || scheduleChanged || util.ChangesTouch(changes, reminderKeys...) ||
+		(newCfg.HasKey("actions") && util.ChangesTouch(changes, restKeys...)) {
+		stopJob(mailReminderJob, "reminders")
+		stopJob(weeklyDigestJob, "weekly digest")
+		stopSubscriptions()
+		if hasReminders(newCfg) {
+			startReminders(newCfg)
+		}
+	}
+
+	if todoChanged || scheduleChanged || util.ChangesTouch(changes, "external_sources") {
+		stopJob(extSourcesJob, "external sources")
+		if newCfg.HasKey("external_sources") {
+			startExternalSources(newCfg, files)
+		}
+	}
+
+	if todoChanged || scheduleChanged || util.ChangesTouch(changes, "outlook_events") {
+		stopJob(outlookJob, "outlook syncing")
+		if newCfg.HasKey("outlook_events") {
+			startOutlookEvents(newCfg, files.TodoFile)
+		}
+	}
+
+	if initial {
+		startRestServer(newCfg)
+	} else if util.ChangesTouch(changes, restKeys...) {
+		// Restart asynchronously, since the reload might have been triggered by a request
+		// to the REST server itself, which has to complete before the server can shut down.
+		go restartRestServer(newCfg)
+	}
+
+	if !initial && util.ChangesTouch(changes, "popup") {
+		log.Warn("Changes to the popup config require a restart\n")
+	}
+
+	currentCfg = newCfg
+	return changes, nil
+}
+
+func setFiles(f *util.FileConfig) {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	files = f
+}
+
+// currentFiles returns the files of the active config.
+func currentFiles() *util.FileConfig {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return files
+}
+
+// currentActionSigner returns the signer of the action links of the active config, or nil.
+func currentActionSigner() *actions.Signer {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return actionSigner
+}
+
+// currentViews returns the saved views of the active config.
+func currentViews() []preview.View {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return previewViews
+}
+
+func validateConfig(cfg *util.Config) error {
+	hasTodoFile := cfg.GetString("todoFile", "") != ""
+	if cfg.HasKey("mailTo") {
+		if !hasTodoFile {
+			return errors.New("cannot run mail reminders without todoFile set")
+		}
+		for _, k := range []string{"mailHost", "mailPort", "mailFrom"} {
+			if !cfg.HasKey(k) {
+				return errors.New(k + " must be set")
+			}
+		}
+	}
+	if cfg.HasKey("reminders") && !hasTodoFile {
+		return errors.New("cannot run reminders without todoFile set")
+	}
+	_, err := reminderNotifiers(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = reminder.LoadTemplates(cfg.GetSubConfig("reminders").GetString("template_dir", ""))
+	if err != nil {
+		return err
+	}
+	_, err = configVacation(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.HasKey("actions") && !hasTodoFile {
+		return errors.New("cannot run actions without todoFile set")
+	}
+	_, err = newActionSigner(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.HasKey("external_sources") && !hasTodoFile {
+		return errors.New("cannot run external sources without todoFile set")
+	}
+	if cfg.HasKey("outlook_events") && !hasTodoFile {
+		return errors.New("cannot run outlook events without todoFile set")
+	}
+	_, err = loadViews(cfg)
+	if err != nil {
+		return err
+	}
+	backupCfg := cfg.GetSubConfig("backup")
+	_, err = backup.ParseRetentionPolicy(backupCfg.GetSubConfig("retention"))
+	if err != nil {
+		return err
+	}
+	if backup.EncryptionEnabled(backupCfg) {
+		_, err = backup.NewCryptor(backupCfg)
+		if err != nil {
+			return fmt.Errorf("backup encryption: %s", err)
+		}
+	}
+	_, err = backup.NewBackend(backupCfg)
+	if err != nil {
+		return fmt.Errorf("backup: %s", err)
+	}
+	_, err = time.ParseDuration(backupCfg.GetString("on_change_delay", defaultChangeBackupDelay))
+	if err != nil {
+		return fmt.Errorf("backup on_change_delay: %s", err)
+	}
+	remotes, err := backup.ParseRemotes(backupCfg)
+	if err != nil {
+		return fmt.Errorf("backup: %s", err)
+	}
+	for _, r := range remotes {
+		if r.Schedule == "" {
+			continue
+		}
+		_, err := scheduler.ParseSchedule(r.Schedule)
+		if err != nil {
+			return fmt.Errorf("backup remote %s: %s", r.Name, err)
+		}
+	}
+	tlsCfg := cfg.GetSubConfig("rest").GetSubConfig("tls")
+	if tlsCfg.HasKey("cert_file") != tlsCfg.HasKey("key_file") {
+		return errors.New("rest.tls.cert_file and rest.tls.key_file must be set together")
+	}
+	scheduleCfg := cfg.GetSubConfig("schedule")
+	for _, job := range scheduleCfg.Keys() {
+		if _, found := defaultSchedules[job]; !found {
+			return fmt.Errorf("unknown job %s in schedule", job)
+		}
+		_, err := scheduler.ParseSchedule(scheduleCfg.GetString(job, ""))
+		if err != nil {
+			return fmt.Errorf("job %s: %s", job, err)
+		}
+	}
+	return nil
+}
+
+// loadViews parses the saved views shown in the preview, sorted by name.
+func loadViews(cfg *util.Config) ([]preview.View, error) {
+	viewsCfg := cfg.GetSubConfig("views")
+	var views []preview.View
+	for _, name := range viewsCfg.Keys() {
+		q, err := query.Parse(viewsCfg.GetString(name, ""))
+		if err != nil {
+			return nil, fmt.Errorf("view %s: %s", name, err)
+		}
+		views = append(views, preview.View{Name: name, Query: q})
+	}
+	return views, nil
+}
+
+// reloadConfig reads the config file again and applies all changes. If the new config
+// is invalid, the currently active config stays in place.
+func reloadConfig() ([]util.ConfigChange, error) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	newCfg, err := readConfig(configPath)
+	if err != nil {
+		log.Errorf("Could not reload config %s: %s\n", configPath, err)
+		return nil, err
+	}
+
+	changes, err := applyConfig(currentCfg, newCfg)
+	if err != nil {
+		log.Errorf("Could not apply reloaded config %s: %s\n", configPath, err)
+		return nil, err
+	}
+
+	if len(changes) == 0 {
+		log.Infof("Reloaded config %s, nothing changed\n", configPath)
+	} else {
+		log.Infof("Reloaded config %s:\n", configPath)
+		for _, c := range changes {
+			log.Infof("  %s\n", c)
+		}
+	}
+	return changes, nil
+}
+
+// startConfigWatcher polls the config file for modifications and reloads it when it changes.
+func startConfigWatcher() {
+	if configPath == "" || !util.Exists(configPath) || !currentCfg.GetBool("watch_config", true) {
+		return
+	}
+
+	lastMod := configModTime()
+	services.Start(configWatchService, func(ctx context.Context) error {
+		return supervisor.Every(ctx, clock.Real, configWatchInterval, func() {
+			newLastMod := configModTime()
+			if newLastMod != lastMod {
+				lastMod = newLastMod
+				reloadConfig()
+			}
+		})
+	})
+	log.Infof("Watching config file %s for changes\n", configPath)
+}
+
+func configModTime() time.Time {
+	stat, err := os.Stat(configPath)
+	if err != nil {
+		return time.Unix(0, 0)
+	}
+	return stat.ModTime()
+}
+
+func stopJob(name string, description string) {
+	if jobs.Remove(name) {
+		log.Infof("Stopped %s\n", description)
+	}
+}
@@ -3,12 +3,13 @@ package extsources
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/metrics"
 	"github.com/sandro-h/sibylgo/modify"
 	"github.com/sandro-h/sibylgo/moment"
 	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/status"
 	"github.com/sandro-h/sibylgo/util"
 	log "github.com/sirupsen/logrus"
 )
@@ -20,40 +21,35 @@ var externalSources = map[string]fetchFunc{
 
 const idPrefix = "ext_"
 
+var fetchesTotal = metrics.NewCounterVec("sibylgo_external_source_fetches_total",
+	"Number of fetches from external sources.", "source", "result")
+
 type fetchFunc func(*util.Config) ([]moment.Moment, error)
 
-// ExternalSourcesProcess periodically checks a list of external sources (based on the passed config) for moments,
+// ExternalSourcesProcess checks a list of external sources (based on the passed config) for moments,
 // then updates the todo file with them.
 type ExternalSourcesProcess struct {
-	files         *util.FileConfig
-	extSrcConfig  *util.Config
-	checkInterval time.Duration
+	files        *util.FileConfig
+	extSrcConfig *util.Config
 }
 
 // NewExternalSourcesProcess creates a new ExternalSourcesProcess.
 func NewExternalSourcesProcess(files *util.FileConfig, extSrcConfig *util.Config) *ExternalSourcesProcess {
-	return &ExternalSourcesProcess{files, extSrcConfig, 10 * time.Minute}
-}
-
-// CheckInfinitely repeatedly checks the external sources in the check interval.
-// This method blocks indefinitely and should be run as a go routine.
-func (p *ExternalSourcesProcess) CheckInfinitely() {
-	for {
-		p.CheckOnce()
-		time.Sleep(p.checkInterval)
-	}
+	return &ExternalSourcesProcess{files, extSrcConfig}
 }
 
 // CheckOnce does a single check on the external sources.
-func (p *ExternalSourcesProcess) CheckOnce() {
+func (p *ExternalSourcesProcess) CheckOnce() error {
 	content, err := util.ReadFile(p.files.TodoFile)
 	if err != nil {
 		log.Errorf("[Ext sources] Failed to read todo file %s: %s\n", p.files.TodoFile, err.Error())
+		return err
 	}
 
 	updatedContent, err := FetchAndApplyExternalSourceMoments(content, p.extSrcConfig)
 	if err != nil {
 		log.Errorf("%s\n", err.Error())
+		return err
 	}
 
 	if updatedContent != content {
@@ -66,8 +62,10 @@ func (p *ExternalSourcesProcess) CheckOnce() {
 		err = util.WriteFile(p.files.TodoFile, updatedContent)
 		if err != nil {
 			log.Errorf("[Ext sources] Failed to write todo file %s: %s\n", p.files.TodoFile, err.Error())
+			return err
 		}
 	}
+	return nil
 }
 
 // FetchAndApplyExternalSourceMoments fetches all moments from the configured sources and
@@ -110,10 +108,13 @@ func fetchExternalSourceMoments(extSrcConfig *util.Config) ([]moment.Moment, map
 			continue
 		}
 		moments, err := fetchFunc(extSrcConfig.GetSubConfig(srcName))
+		status.RecordExternalSource(srcName, len(moments), err)
 		if err != nil {
+			fetchesTotal.Inc(srcName, "error")
 			log.Errorf("[Ext sources] Fetching %s failed: %s\n", srcName, err.Error())
 			continue
 		}
+		fetchesTotal.Inc(srcName, "ok")
 		for _, m := range moments {
 			if m.GetID() == nil {
 				log.Errorf("[Ext sources] %s moment %s has no ID. Skipping it.\n", srcName, m.GetName())
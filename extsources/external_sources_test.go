@@ -168,7 +168,7 @@ func TestExternalSources_FileBackup(t *testing.T) {
 	updatedContent, _ := util.ReadFile(todoFile)
 	assert.Equal(t, todosWithDummies, updatedContent)
 
-	backups, _ := backup.ListBackups(files.TodoDir)
+	backups, _ := backup.ListBackups(files)
 	assert.Equal(t, 1, len(backups))
 	assert.Equal(t, "Backup before applying external source changes", backups[0].Message)
 }
@@ -191,7 +191,7 @@ func TestExternalSources_NoFileBackupIfNoChanges(t *testing.T) {
 	updatedContent, _ := util.ReadFile(files.TodoFile)
 	assert.Equal(t, todosOddlySpacedDummies, updatedContent)
 
-	backups, _ := backup.ListBackups(files.TodoDir)
+	backups, _ := backup.ListBackups(files)
 	assert.Equal(t, 0, len(backups))
 }
 
@@ -216,6 +216,6 @@ func TestExternalSources_NoFileBackupIfNoChanges_NoTrailingNewline(t *testing.T)
 	updatedContent, _ := util.ReadFile(files.TodoFile)
 	assert.Equal(t, todosWithDummies, updatedContent)
 
-	backups, _ := backup.ListBackups(files.TodoDir)
+	backups, _ := backup.ListBackups(files)
 	assert.Equal(t, 0, len(backups))
 }
@@ -0,0 +1,481 @@
+// Package history tracks a single moment across the backups of the todo file.
+package history
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/modify"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// ErrMomentNotFound is returned if no version of the todo file contains the moment.
+var ErrMomentNotFound = errors.New("moment not found")
+
+// ErrMomentExists is returned when restoring a moment that still exists in the todo file.
+var ErrMomentExists = errors.New("moment still exists in the todo file")
+
+// minNameSimilarity is how similar the names of moments without matching ID must be to be considered the same moment.
+const minNameSimilarity = 0.6
+
+// Version is the content of the todo file at some point in time.
+type Version struct {
+	// BackupID is the backup the content is from. It is empty for the current todo file.
+	BackupID  string
+	Timestamp time.Time
+	Content   string
+}
+
+// Entry is a version in which the moment changed.
+type Entry struct {
+	BackupID  string           `json:"backupId,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+	Text      string           `json:"text"`
+	WorkState moment.WorkState `json:"workState"`
+	Category  string           `json:"category,omitempty"`
+	Comments  []string         `json:"comments"`
+	Deleted   bool             `json:"deleted,omitempty"`
+	Changes   []string         `json:"changes"`
+}
+
+// snapshot is a moment as it was in one version.
+type snapshot struct {
+	id       string
+	name     string
+	category string
+	text     string
+	rawText  string
+	state    moment.WorkState
+	priority int
+	dates    string
+	comments []string
+	// position is the relative position of the moment in the document, from 0 to 1.
+	position float64
+}
+
+// LoadVersions returns the content of the todo file in all backups and the current todo file, oldest first.
+func LoadVersions(files *util.FileConfig) ([]*Version, error) {
+	var versions []*Version
+	backups, err := backup.ListBackups(files)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		content, found, err := backup.TodoContent(files, b)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			versions = append(versions, &Version{BackupID: b.Identifier, Timestamp: b.Timestamp, Content: content})
+		}
+	}
+
+	content, err := util.ReadFile(files.TodoFile)
+	if err != nil {
+		return nil, err
+	}
+	current := &Version{Timestamp: time.Now(), Content: content}
+	if info, err := os.Stat(files.TodoFile); err == nil {
+		current.Timestamp = info.ModTime()
+	}
+	return append(versions, current), nil
+}
+
+// Get returns the history of the moment with the ID or name from the backups and the current todo file, oldest first.
+func Get(files *util.FileConfig, ref string) ([]*Entry, error) {
+	versions, err := LoadVersions(files)
+	if err != nil {
+		return nil, err
+	}
+	return Track(versions, ref)
+}
+
+// Track follows the moment with the ID or name across the versions and returns the versions in which it changed.
+// Moments are matched by their #id or, if they don't have one, by a similar name and position in the document.
+func Track(versions []*Version, ref string) ([]*Entry, error) {
+	found, err := track(versions, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0)
+	var prev *snapshot
+	existed := false
+	for i, cur := range found {
+		var changes []string
+		e := cur
+		switch {
+		case cur != nil && prev == nil && existed:
+			changes = []string{"restored"}
+		case cur != nil && prev == nil:
+			changes = []string{"created"}
+		case cur == nil && prev != nil:
+			changes = []string{"deleted"}
+			e = prev
+		case cur != nil:
+			changes = compare(prev, cur)
+		}
+		if len(changes) > 0 {
+			entries = append(entries, toEntry(versions[i], e, cur == nil, changes))
+		}
+		if cur != nil {
+			existed = true
+		}
+		prev = cur
+	}
+	return entries, nil
+}
+
+// track returns the snapshot of the moment in each version, or nil if it doesn't exist in the version.
+func track(versions []*Version, ref string) ([]*snapshot, error) {
+	snapshots := make([][]*snapshot, len(versions))
+	for i, v := range versions {
+		// A backup that can't be parsed just doesn't contain the moment
+		todos, err := parse.String(v.Content)
+		if err == nil {
+			snapshots[i] = toSnapshots(todos, v.Content)
+		}
+	}
+
+	anchorVersion, anchor := findAnchor(snapshots, ref)
+	if anchor == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMomentNotFound, ref)
+	}
+
+	found := make([]*snapshot, len(versions))
+	found[anchorVersion] = anchor
+	tracked := anchor
+	for i := anchorVersion - 1; i >= 0; i-- {
+		found[i] = findMatch(snapshots[i], tracked)
+		if found[i] != nil {
+			tracked = found[i]
+		}
+	}
+	tracked = anchor
+	for i := anchorVersion + 1; i < len(versions); i++ {
+		found[i] = findMatch(snapshots[i], tracked)
+		if found[i] != nil {
+			tracked = found[i]
+		}
+	}
+	return found, nil
+}
+
+// findAnchor returns the newest snapshot with the ID, or else the newest snapshot with the name.
+func findAnchor(snapshots [][]*snapshot, ref string) (int, *snapshot) {
+	ref = strings.TrimPrefix(strings.TrimSpace(ref), "#")
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		for _, s := range snapshots[i] {
+			if s.id != "" && s.id == ref {
+				return i, s
+			}
+		}
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		for _, s := range snapshots[i] {
+			if strings.EqualFold(s.name, ref) {
+				return i, s
+			}
+		}
+	}
+	return -1, nil
+}
+
+// findMatch returns the snapshot of the same moment as tracked, or nil if there is none.
+func findMatch(candidates []*snapshot, tracked *snapshot) *snapshot {
+	if tracked.id != "" {
+		for _, c := range candidates {
+			if c.id == tracked.id {
+				return c
+			}
+		}
+	}
+
+	var best *snapshot
+	bestScore := 0.0
+	for _, c := range candidates {
+		if c.id != "" && tracked.id != "" {
+			// Different IDs, so definitely a different moment
+			continue
+		}
+		similarity := nameSimilarity(c.name, tracked.name)
+		if similarity < minNameSimilarity {
+			continue
+		}
+		score := 0.8*similarity + 0.2*(1-math.Abs(c.position-tracked.position))
+		if score > bestScore {
+			best = c
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func compare(prev *snapshot, cur *snapshot) []string {
+	var changes []string
+	if prev.name != cur.name {
+		changes = append(changes, fmt.Sprintf("renamed from '%s' to '%s'", prev.name, cur.name))
+	}
+	if prev.state != cur.state {
+		changes = append(changes, fmt.Sprintf("state changed from %s to %s", prev.state, cur.state))
+	}
+	if prev.priority != cur.priority {
+		changes = append(changes, fmt.Sprintf("priority changed from %d to %d", prev.priority, cur.priority))
+	}
+	if prev.dates != cur.dates {
+		changes = append(changes, fmt.Sprintf("dates changed from '%s' to '%s'", prev.dates, cur.dates))
+	}
+	if prev.category != cur.category {
+		changes = append(changes, fmt.Sprintf("moved from category '%s' to '%s'", prev.category, cur.category))
+	}
+	added, removed := diffComments(prev.comments, cur.comments)
+	for _, c := range added {
+		changes = append(changes, "comment added: "+c)
+	}
+	for _, c := range removed {
+		changes = append(changes, "comment removed: "+c)
+	}
+	if len(changes) == 0 && prev.text != cur.text {
+		changes = append(changes, "text changed")
+	}
+	return changes
+}
+
+func diffComments(prev []string, cur []string) ([]string, []string) {
+	counts := make(map[string]int)
+	for _, c := range prev {
+		counts[c]++
+	}
+	var added []string
+	for _, c := range cur {
+		if counts[c] > 0 {
+			counts[c]--
+		} else {
+			added = append(added, c)
+		}
+	}
+	var removed []string
+	for _, c := range prev {
+		if counts[c] > 0 {
+			counts[c]--
+			removed = append(removed, c)
+		}
+	}
+	return added, removed
+}
+
+func toEntry(v *Version, s *snapshot, deleted bool, changes []string) *Entry {
+	return &Entry{
+		BackupID:  v.BackupID,
+		Timestamp: v.Timestamp,
+		Text:      s.text,
+		WorkState: s.state,
+		Category:  s.category,
+		Comments:  append(make([]string, 0), s.comments...),
+		Deleted:   deleted,
+		Changes:   changes,
+	}
+}
+
+func toSnapshots(todos *moment.Todos, content string) []*snapshot {
+	lines := strings.Split(content, "\n")
+	var res []*snapshot
+	var add func(mom moment.Moment)
+	add = func(mom moment.Moment) {
+		res = append(res, toSnapshot(mom, lines))
+		for _, sub := range mom.GetSubMoments() {
+			add(sub)
+		}
+	}
+	for _, m := range todos.Moments {
+		add(m)
+	}
+	for i, s := range res {
+		if len(res) > 1 {
+			s.position = float64(i) / float64(len(res)-1)
+		}
+	}
+	return res
+}
+
+func toSnapshot(mom moment.Moment, lines []string) *snapshot {
+	s := &snapshot{
+		name:     mom.GetName(),
+		state:    mom.GetWorkState(),
+		priority: mom.GetPriority(),
+		dates:    formatDates(mom),
+	}
+	if mom.GetID() != nil {
+		s.id = mom.GetID().Value
+	}
+	if mom.GetCategory() != nil {
+		s.category = mom.GetCategory().Name
+	}
+	for _, c := range mom.GetComments() {
+		s.comments = append(s.comments, strings.TrimSpace(c.Content))
+	}
+	start := mom.GetDocCoords().LineNumber
+	end := mom.GetBottomLineNumber()
+	if start < len(lines) {
+		s.text = strings.TrimSpace(lines[start])
+	}
+	if end >= len(lines) {
+		end = len(lines) - 1
+	}
+	s.rawText = dedent(lines[start : end+1])
+	return s
+}
+
+func formatDates(mom moment.Moment) string {
+	var parts []string
+	switch m := mom.(type) {
+	case *moment.SingleMoment:
+		if m.Start != nil {
+			parts = append(parts, m.Start.Time.Format("2006-01-02"))
+		}
+		if m.End != nil && !moment.IsSingleDayMoment(m) {
+			parts = append(parts, "-"+m.End.Time.Format("2006-01-02"))
+		}
+	case *moment.RecurMoment:
+		if m.Recurrence.RefDate != nil {
+			parts = append(parts, fmt.Sprintf("every %s from %s", recurrenceNames[m.Recurrence.Recurrence], m.Recurrence.RefDate.Time.Format("2006-01-02")))
+		}
+	}
+	if mom.GetTimeOfDay() != nil {
+		parts = append(parts, mom.GetTimeOfDay().Time.Format("15:04"))
+	}
+	return strings.Join(parts, " ")
+}
+
+var recurrenceNames = map[int]string{
+	moment.RecurDaily:        "day",
+	moment.RecurWeekly:       "week",
+	moment.RecurMonthly:      "month",
+	moment.RecurYearly:       "year",
+	moment.RecurBiWeekly:     "2 weeks",
+	moment.RecurTriWeekly:    "3 weeks",
+	moment.RecurQuadriWeekly: "4 weeks",
+}
+
+// dedent removes the indentation of the first line from all lines, so a sub moment can be restored as top-level moment.
+func dedent(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	indent := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	var res []string
+	for _, l := range lines {
+		res = append(res, strings.TrimPrefix(l, indent))
+	}
+	return strings.Join(res, "\n") + "\n"
+}
+
+// nameSimilarity returns how similar the names are, from 0 (completely different) to 1 (equal, ignoring case).
+func nameSimilarity(a string, b string) float64 {
+	ra := []rune(strings.ToLower(strings.TrimSpace(a)))
+	rb := []rune(strings.ToLower(strings.TrimSpace(b)))
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(first int, others ...int) int {
+	m := first
+	for _, o := range others {
+		if o < m {
+			m = o
+		}
+	}
+	return m
+}
+
+// Restore copies a moment that was deleted from the todo file back into it, from the backup with the ID or,
+// if backupID is empty, from the newest backup containing it. The moment is appended to its category, or to the
+// moments without category if the category doesn't exist anymore. Returns the restored text.
+func Restore(files *util.FileConfig, ref string, backupID string) (string, error) {
+	versions, err := LoadVersions(files)
+	if err != nil {
+		return "", err
+	}
+	found, err := track(versions, ref)
+	if err != nil {
+		return "", err
+	}
+	current := len(versions) - 1
+	if found[current] != nil {
+		return "", fmt.Errorf("%w: %s", ErrMomentExists, ref)
+	}
+
+	var source *snapshot
+	for i := current - 1; i >= 0; i-- {
+		if found[i] == nil {
+			continue
+		}
+		if backupID == "" || strings.HasPrefix(versions[i].BackupID, backupID) {
+			source = found[i]
+			break
+		}
+	}
+	if source == nil {
+		if backupID != "" {
+			return "", fmt.Errorf("%w: %s in backup %s", ErrMomentNotFound, ref, backupID)
+		}
+		return "", fmt.Errorf("%w: %s", ErrMomentNotFound, ref)
+	}
+
+	category := source.category
+	if category != "" && !hasCategory(versions[current].Content, category) {
+		category = ""
+	}
+	err = modify.AppendTextInFile(files.TodoFile, category, source.rawText)
+	if err != nil {
+		return "", err
+	}
+	return source.rawText, nil
+}
+
+func hasCategory(content string, category string) bool {
+	todos, err := parse.String(content)
+	if err != nil {
+		return false
+	}
+	for _, c := range todos.Categories {
+		if c.Name == category {
+			return true
+		}
+	}
+	return false
+}
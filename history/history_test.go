@@ -0,0 +1,141 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandro-h/sibylgo/backup"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackByID(t *testing.T) {
+	versions := toVersions(
+		`[] foo
+[] bar #b1
+`,
+		`[] foo
+[] bar (20.10.26) #b1
+`,
+		`[] bar (20.10.26) #b1
+	some comment
+[] foo
+`,
+		`[x] bar stuff (20.10.26) #b1
+	some comment
+[] foo
+`,
+		`[] foo
+`,
+		`[] foo
+[] bar #b1
+`)
+
+	entries, err := Track(versions, "b1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(entries))
+	assert.Equal(t, []string{"created"}, entries[0].Changes)
+	assert.Equal(t, "v0", entries[0].BackupID)
+	assert.Equal(t, []string{"dates changed from '' to '2026-10-20'"}, entries[1].Changes)
+	assert.Equal(t, []string{"comment added: some comment"}, entries[2].Changes)
+	assert.Equal(t, []string{"renamed from 'bar' to 'bar stuff'", "state changed from new to done"}, entries[3].Changes)
+	assert.Equal(t, "[x] bar stuff (20.10.26) #b1", entries[3].Text)
+	assert.Equal(t, []string{"deleted"}, entries[4].Changes)
+	assert.True(t, entries[4].Deleted)
+	assert.Equal(t, "[x] bar stuff (20.10.26) #b1", entries[4].Text)
+	assert.Equal(t, []string{"restored"}, entries[5].Changes)
+}
+
+func TestTrackByName(t *testing.T) {
+	versions := toVersions(
+		`[] buy milk
+[] call bob
+`,
+		`[] call bob
+[] buy milk
+	at the store
+`,
+		`[] call bob
+[] buy oat milk
+	at the store
+`,
+		`------
+ Work
+------
+[] buy milk
+[] call bob
+[] buy oat milk!
+	at the store
+`)
+
+	entries, err := Track(versions, "buy oat milk")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, []string{"created"}, entries[0].Changes)
+	assert.Equal(t, []string{"comment added: at the store"}, entries[1].Changes)
+	assert.Equal(t, []string{"renamed from 'buy milk' to 'buy oat milk'"}, entries[2].Changes)
+	assert.Equal(t, []string{"priority changed from 0 to 1", "moved from category '' to 'Work'"}, entries[3].Changes)
+}
+
+func TestTrackNotFound(t *testing.T) {
+	versions := toVersions("[] foo\n")
+
+	_, err := Track(versions, "bar")
+
+	assert.True(t, errors.Is(err, ErrMomentNotFound))
+}
+
+func TestNameSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, nameSimilarity("Buy milk", "buy milk"))
+	assert.InDelta(t, 0.67, nameSimilarity("buy milk", "buy oat milk"), 0.01)
+	assert.Less(t, nameSimilarity("buy milk", "call bob"), minNameSimilarity)
+}
+
+func TestRestore(t *testing.T) {
+	todoDir := tu.MakeTempDir("sibyl_history_test")
+	defer tu.DeleteTempDir(todoDir)
+	todoFile := filepath.Join(todoDir, "todo.txt")
+	files := util.NewFileConfigFromTodoFile(todoFile)
+	util.WriteFile(todoFile, `------
+ Work
+------
+[] foo
+	[] bar #b1
+		comment
+`)
+	backup.Save(files, "save 1")
+	util.WriteFile(todoFile, `------
+ Work
+------
+[] foo
+`)
+	backup.Save(files, "save 2")
+
+	restored, err := Restore(files, "b1", "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "[] bar #b1\n\tcomment\n", restored)
+	content, _ := util.ReadFile(todoFile)
+	assert.Equal(t, `------
+ Work
+------
+[] foo
+[] bar #b1
+	comment
+`, content)
+
+	_, err = Restore(files, "b1", "")
+	assert.True(t, errors.Is(err, ErrMomentExists))
+}
+
+func toVersions(contents ...string) []*Version {
+	var versions []*Version
+	for i, c := range contents {
+		versions = append(versions, &Version{BackupID: "v" + string(rune('0'+i)), Timestamp: tu.Dt("01.10.2026").AddDate(0, 0, i), Content: c})
+	}
+	return versions
+}
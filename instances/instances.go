@@ -15,6 +15,8 @@ type Instance struct {
 	Start           time.Time        `json:"start"`
 	End             time.Time        `json:"end"`
 	TimeOfDay       *time.Time       `json:"timeOfDay"`
+	Reminders       []time.Duration  `json:"-"`
+	Comments        []string         `json:"-"`
 	Priority        int              `json:"priority"`
 	Category        *moment.Category `json:"-"`
 	Done            bool             `json:"done"`
@@ -22,6 +24,8 @@ type Instance struct {
 	EndsInRange     bool             `json:"endsInRange"`
 	SubInstances    []*Instance      `json:"subInstances"`
 	OriginDocCoords moment.DocCoords `json:"originDocCoords"`
+	// Moment is the moment the instance was generated from.
+	Moment moment.Moment `json:"-"`
 }
 
 // CloneShallow creates a clone of the moment instances without its sub instances.
@@ -31,10 +35,14 @@ func (m *Instance) CloneShallow() *Instance {
 		Start:           m.Start,
 		End:             m.End,
 		Priority:        m.Priority,
+		Category:        m.Category,
 		Done:            m.Done,
 		WorkState:       m.WorkState,
 		EndsInRange:     m.EndsInRange,
+		Reminders:       m.Reminders,
+		Comments:        m.Comments,
 		OriginDocCoords: m.OriginDocCoords,
+		Moment:          m.Moment,
 	}
 	if m.TimeOfDay != nil {
 		cp := *m.TimeOfDay
@@ -137,12 +145,15 @@ func createSingleInstances(mom *moment.SingleMoment, from time.Time, to time.Tim
 		Start:           start,
 		End:             end,
 		OriginDocCoords: mom.DocCoords,
+		Moment:          mom,
 	}
 	inst.Priority = mom.GetPriority()
 	inst.Category = mom.GetCategory()
 	inst.Done = mom.IsDone()
 	inst.WorkState = mom.GetWorkState()
 	inst.EndsInRange = mom.End != nil && !mom.End.Time.After(end)
+	inst.Reminders = mom.GetReminders()
+	inst.Comments = commentContents(mom)
 	if mom.TimeOfDay != nil {
 		tm := util.SetTime(start, mom.TimeOfDay.Time)
 		inst.TimeOfDay = &tm
@@ -159,12 +170,15 @@ func createRecurInstances(mom *moment.RecurMoment, from time.Time, to time.Time)
 			Start:           start,
 			End:             util.SetToEndOfDay(start),
 			OriginDocCoords: mom.DocCoords,
+			Moment:          mom,
 		}
 		inst.Priority = mom.GetPriority()
 		inst.Category = mom.GetCategory()
 		inst.Done = mom.IsDone()
 		inst.WorkState = mom.GetWorkState()
 		inst.EndsInRange = true
+		inst.Reminders = mom.GetReminders()
+		inst.Comments = commentContents(mom)
 		if mom.TimeOfDay != nil {
 			tm := util.SetTime(start, mom.TimeOfDay.Time)
 			inst.TimeOfDay = &tm
@@ -174,6 +188,14 @@ func createRecurInstances(mom *moment.RecurMoment, from time.Time, to time.Time)
 	return insts
 }
 
+func commentContents(mom moment.Moment) []string {
+	var res []string
+	for _, c := range mom.GetComments() {
+		res = append(res, c.Content)
+	}
+	return res
+}
+
 func dateTm(dt *moment.Date) *time.Time {
 	if dt == nil {
 		return nil
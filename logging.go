@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"github.com/sandro-h/sibylgo/util"
 	log "github.com/sirupsen/logrus"
 	"strings"
@@ -9,8 +10,11 @@ import (
 // SimpleFormatter logs the message only
 type SimpleFormatter struct{}
 
-// Format renders a single log entry
+// Format renders a single log entry, prefixed with the request ID if there is one.
 func (f *SimpleFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if id, ok := entry.Data["request_id"]; ok && id != "" {
+		return []byte(fmt.Sprintf("[%s] %s", id, entry.Message)), nil
+	}
 	return []byte(entry.Message), nil
 }
 
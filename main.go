@@ -1,19 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/sandro-h/sibylgo/actions"
 	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/clock"
 	"github.com/sandro-h/sibylgo/extsources"
+	"github.com/sandro-h/sibylgo/notify"
 	"github.com/sandro-h/sibylgo/outlook"
 	"github.com/sandro-h/sibylgo/parse"
 	"github.com/sandro-h/sibylgo/popup"
 	"github.com/sandro-h/sibylgo/reminder"
+	"github.com/sandro-h/sibylgo/scheduler"
+	"github.com/sandro-h/sibylgo/supervisor"
 	"github.com/sandro-h/sibylgo/util"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,11 +40,49 @@ var buildVersion = "0.0.0"
 var buildNumber = "0"
 var buildRevision = "-"
 
+const shutdownTimeout = 30 * time.Second
+
+const (
+	backupJob           = "backup"
+	pruneJob            = "prune"
+	pushJobPrefix       = "push_"
+	verifyJob           = "verify"
+	mailReminderJob     = "reminders"
+	subscriptionPrefix  = "reminders_"
+	weeklyDigestJob     = "weekly_digest"
+	extSourcesJob       = "extsources"
+	outlookJob          = "outlook"
+	schedulerService    = "scheduler"
+	configWatchService  = "config_watcher"
+	changeBackupService = "change_backup"
+)
+
+// changeBackupPollInterval is how often the todo file is checked for changes to back up.
+const changeBackupPollInterval = 5 * time.Second
+const defaultChangeBackupDelay = "3m"
+
+// defaultSchedules are the cron expressions used for the jobs if they are not overridden in the
+// schedule section of the config.
+var defaultSchedules = map[string]string{
+	backupJob:       "*/5 * * * *",
+	pruneJob:        "@daily",
+	verifyJob:       "@weekly",
+	mailReminderJob: "*/5 * * * *",
+	weeklyDigestJob: "0 8 * * 1",
+	extSourcesJob:   "*/10 * * * *",
+	outlookJob:      "@every 5s",
+}
+
 var configFile = flag.String("config", "", "Path to config yml file. By default uses sibylgo.yml in same directory as this executable, if it exists.")
 var doEncrypt = flag.Bool("encrypt", false, "Encrypt stdin and write to stdout")
 var doDecrypt = flag.Bool("decrypt", false, "Decrypt stdin and write to stdout")
+var doEncryptSecrets = flag.Bool("encrypt-secrets", false, "Encrypt stdin with secrets_password and write to stdout, for use as the secrets config block")
 var files *util.FileConfig
-var extSourcesProcess *extsources.ExternalSourcesProcess
+
+var subscriptionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+var actionSigner *actions.Signer
+var services = supervisor.New(clock.Real)
+var jobs = scheduler.New(clock.Real)
 
 func main() {
 	flag.Parse()
@@ -41,12 +91,33 @@ func main() {
 		log.SetOutput(ioutil.Discard)
 		cfg := loadConfig()
 		err := cryptContent(cfg.GetSubConfig("backup"))
+		if err != nil {
+			// Non-zero exit, so git does not store content that failed to encrypt
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *doEncryptSecrets {
+		log.SetOutput(ioutil.Discard)
+		err := encryptSecrets(loadConfig())
 		if err != nil {
 			panic(err)
 		}
 		return
 	}
 
+	if flag.NArg() > 0 {
+		log.SetOutput(ioutil.Discard)
+		err := runCommand(loadConfig(), flag.Args(), os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.SetFormatter(&SimpleFormatter{})
 
 	fmt.Printf("%s\n", ascii)
@@ -54,43 +125,44 @@ func main() {
 
 	cfg := loadConfig()
 
-	log.SetLevel(getConfigLogLevel(cfg))
-
-	parse.ParseConfig.BackingCfg = cfg.GetSubConfig("parse")
-
-	files = util.NewFileConfigFromConfig(cfg)
-	if files.TodoFile != "" {
-		log.Infof("Using todo file %s\n", files.TodoFile)
-		startBackups(cfg.GetSubConfig("backup"))
-	}
-
-	if cfg.HasKey("mailTo") {
-		startMailReminders(cfg)
+	_, err := applyConfig(nil, cfg)
+	if err != nil {
+		panic(err)
 	}
 
-	if cfg.HasKey("external_sources") {
-		extSrcConfig := cfg.GetSubConfig("external_sources")
-		if files.TodoFile == "" {
-			panic("Cannot run external sources without todoFile set")
-		}
-		startExternalSources(files, extSrcConfig)
-	}
+	startConfigWatcher()
 
-	if cfg.HasKey("outlook_events") {
-		outlookConfig := cfg.GetSubConfig("outlook_events")
-		if files.TodoFile == "" {
-			panic("Cannot run outlook events without todoFile set")
-		}
-		startOutlookEvents(files.TodoFile, outlookConfig)
-	}
-
-	startRestServer(cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	files := currentFiles()
 	if files.TodoFile != "" && cfg.HasKey("popup") {
+		// The popup UI has to run on the main go routine and only returns when the app quits.
+		go func() {
+			<-ctx.Done()
+			shutdown()
+			os.Exit(0)
+		}()
 		popup.Start(files, cfg.GetSubConfig("popup"))
 	} else {
-		// Wait forever
-		select {}
+		<-ctx.Done()
+	}
+	shutdown()
+}
+
+// shutdown stops the REST server and all background services. In-flight requests and
+// checks (e.g. writing the todo file or committing a backup) are completed first.
+func shutdown() {
+	log.Info("Shutting down\n")
+	// Stop watching first, so no reload can start services while shutting down.
+	services.Stop(configWatchService)
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	stopRestServer()
+	err := services.Shutdown(shutdownTimeout)
+	if err != nil {
+		log.Errorf("Error during shutdown: %s\n", err)
 	}
 }
 
@@ -108,110 +180,469 @@ func loadConfig() *util.Config {
 		}
 	}
 
-	cfg := &util.Config{}
 	log.Infof("%s\n", absoluteCfgFile)
-	if util.Exists(absoluteCfgFile) {
-		var err error
-		cfg, err = util.LoadConfig(absoluteCfgFile)
-		if err != nil {
-			panic(err)
-		}
+	cfg, err := readConfig(absoluteCfgFile)
+	if err != nil {
+		panic(err)
 	}
 
+	configPath = absoluteCfgFile
 	return cfg
 }
 
-func startBackups(backupCfg *util.Config) {
-	if backupCfg.HasKey("encrypt_password") {
+func readConfig(path string) (*util.Config, error) {
+	if !util.Exists(path) {
+		return &util.Config{}, nil
+	}
+	cfg, err := util.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	err = resolveSecrets(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func getJobSchedule(cfg *util.Config, job string) string {
+	return cfg.GetSubConfig("schedule").GetString(job, defaultSchedules[job])
+}
+
+func startBackups(cfg *util.Config) {
+	backupCfg := cfg.GetSubConfig("backup")
+	err := backup.Configure(backupCfg)
+	if err != nil {
+		log.Errorf("Error configuring backups: %s\n", err)
+		return
+	}
+	// Other backends encrypt the backups themselves
+	if backupCfg.GetString("backend", backup.BackendGit) == backup.BackendGit && backup.EncryptionEnabled(backupCfg) {
 		exec, err := os.Executable()
 		if err != nil {
 			panic(err)
 		}
-		backup.EnableGitEncryption(files.TodoDir, exec)
+		if *configFile != "" {
+			// The git filters need the same config to find the encryption password
+			absCfg, _ := filepath.Abs(*configFile)
+			exec += " --config " + absCfg
+		}
+		err = backup.EnableGitEncryption(files.TodoDir, exec)
+		if err == nil {
+			err = backup.SetGitFilterRequired(files.TodoDir, backupCfg.GetBool("strict_encryption", false))
+		}
+		if err != nil {
+			log.Errorf("Error enabling backup encryption: %s\n", err)
+		}
 	}
 
-	startDailyBackupProcess(backupCfg, files)
+	startDailyBackupProcess(cfg, backupCfg, files)
+	if backupCfg.HasKey("retention") {
+		startBackupPruning(cfg, backupCfg, files)
+	}
+	startScheduledPushes(backupCfg, files)
+	if backupCfg.GetBool("verify", false) {
+		startBackupVerification(cfg, backupCfg, files)
+	}
+	if backupCfg.GetBool("on_change", false) {
+		startChangeBackups(backupCfg, files)
+	}
 }
 
 func cryptContent(backupCfg *util.Config) error {
-	var cryptor backup.Cryptor = &backup.AnsibleCryptor{
-		Password: backupCfg.GetStringOrFail("encrypt_password"),
+	cryptor, err := backup.NewCryptor(backupCfg)
+	if err != nil {
+		return err
 	}
 
 	if *doEncrypt {
-		err := cryptor.EncryptContent(os.Stdin, os.Stdout)
+		return cryptor.EncryptContent(os.Stdin, os.Stdout)
+	}
+
+	in := os.Stdin
+	if flag.NArg() > 0 {
+		in, err = os.Open(flag.Arg(0))
 		if err != nil {
-			panic(err)
+			return err
 		}
-	} else if *doDecrypt {
-		in := os.Stdin
-		var err error
-		if flag.NArg() > 0 {
-			in, err = os.Open(flag.Arg(0))
-			if err != nil {
-				panic(err)
-			}
-			defer in.Close()
+		defer in.Close()
+	}
+	return cryptor.DecryptContent(in, os.Stdout)
+}
+
+func startReminders(cfg *util.Config) {
+	// Already validated, so there are no errors.
+	routes, _ := reminderNotifiers(cfg)
+	p := reminder.NewReminderProcess(files.TodoFile, routes.daily, routes.timed)
+	p.Weekly = routes.weekly
+	p.Escalation = routes.escalation
+	p.EscalateAfterDays = cfg.GetSubConfig("reminders").GetInt("escalate_after_days", reminder.DefaultEscalateAfterDays)
+	p.TemplateDir = cfg.GetSubConfig("reminders").GetString("template_dir", "")
+	p.Vacation, _ = configVacation(cfg)
+	p.Actions = actionSigner
+	p.OnParse = recordFileParse
+	jobs.Add(mailReminderJob, getJobSchedule(cfg, mailReminderJob), p.CheckOnce)
+	// Catch up on the reminders missed while the backend was down.
+	jobs.RunNow(mailReminderJob)
+	if p.Weekly != nil {
+		jobs.Add(weeklyDigestJob, getJobSchedule(cfg, weeklyDigestJob), p.SendWeeklyDigest)
+	}
+	for _, s := range routes.subscriptions {
+		sp := reminder.NewReminderProcess(files.TodoFile, s.notifier, s.notifier)
+		sp.StateFile = reminder.SubscriptionStateFile(sp.StateFile, s.name)
+		sp.Filter = s.filter
+		sp.TemplateDir = p.TemplateDir
+		sp.Vacation = p.Vacation
+		sp.VacationStateFile = p.StateFile
+		sp.Actions = actionSigner
+		sp.OnParse = recordFileParse
+		jobs.Add(subscriptionPrefix+s.name, s.schedule, sp.CheckOnce)
+		jobs.RunNow(subscriptionPrefix + s.name)
+		log.Infof("Started reminders for subscription %s\n", s.name)
+	}
+	log.Info("Started reminders\n")
+}
+
+func stopSubscriptions() {
+	for _, j := range jobs.Jobs() {
+		if strings.HasPrefix(j.Name, subscriptionPrefix) {
+			stopJob(j.Name, "reminders for subscription "+strings.TrimPrefix(j.Name, subscriptionPrefix))
 		}
+	}
+}
+
+// hasReminders returns true if reminders are sent by mail or to the notifiers in the reminders section.
+func hasReminders(cfg *util.Config) bool {
+	return cfg.HasKey("mailTo") || cfg.HasKey("reminders")
+}
+
+// reminderRoutes are the notifiers for the different kinds of reminders. Nil means not sent.
+type reminderRoutes struct {
+	daily         notify.Notifier
+	timed         notify.Notifier
+	weekly        notify.Notifier
+	escalation    notify.Notifier
+	subscriptions []*reminderSubscription
+}
 
-		err = cryptor.DecryptContent(in, os.Stdout)
+// reminderSubscription gets the daily and timed reminders for the todos matching its filter.
+type reminderSubscription struct {
+	name     string
+	notifier notify.Notifier
+	filter   *reminder.Filter
+	schedule string
+}
+
+// reminderNotifiers returns the notifiers for the reminders, as routed in the reminders section.
+// By default, the daily and the timed reminders are sent by mail if mailTo is set.
+func reminderNotifiers(cfg *util.Config) (*reminderRoutes, error) {
+	notifiers, err := notify.NewFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var defaultNames []string
+	if cfg.HasKey("mailTo") {
+		defaultNames = []string{notify.MailNotifierName}
+	}
+	remindersCfg := cfg.GetSubConfig("reminders")
+	routes := &reminderRoutes{}
+	for _, r := range []struct {
+		key          string
+		defaultNames []string
+		target       *notify.Notifier
+	}{
+		{"daily", defaultNames, &routes.daily},
+		{"timed", defaultNames, &routes.timed},
+		{"weekly", nil, &routes.weekly},
+		{"escalation", nil, &routes.escalation},
+	} {
+		*r.target, err = notify.Route(notifiers, remindersCfg.GetStringList(r.key, r.defaultNames))
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("reminders %s: %s", r.key, err)
 		}
 	}
-	return nil
+	if remindersCfg.GetInt("escalate_after_days", reminder.DefaultEscalateAfterDays) < 0 {
+		return nil, errors.New("reminders escalate_after_days must not be negative")
+	}
+	subscriptionsCfg := remindersCfg.GetSubConfig("subscriptions")
+	for _, name := range subscriptionsCfg.Keys() {
+		s, err := newReminderSubscription(cfg, notifiers, name, subscriptionsCfg.GetSubConfig(name))
+		if err != nil {
+			return nil, fmt.Errorf("reminders subscription %s: %s", name, err)
+		}
+		routes.subscriptions = append(routes.subscriptions, s)
+	}
+	return routes, nil
 }
 
-func startMailReminders(cfg *util.Config) {
-	cfg.GetStringOrFail("todoFile")
-	mailHost := cfg.GetStringOrFail("mailHost")
-	mailPort := cfg.GetIntOrFail("mailPort")
-	mailFrom := cfg.GetStringOrFail("mailFrom")
-	mailTo := cfg.GetStringOrFail("mailTo")
-	mailUser := cfg.GetString("mailUser", "")
-	mailPassword := cfg.GetString("mailPassword", "")
+// newReminderSubscription creates a subscription sending to the mail recipients in to and to the notifiers.
+func newReminderSubscription(cfg *util.Config, notifiers map[string]notify.Notifier, name string,
+	subCfg *util.Config) (*reminderSubscription, error) {
+	if !subscriptionNamePattern.MatchString(name) {
+		return nil, errors.New("invalid name, only letters, digits, - and _ are allowed")
+	}
+	routed, err := notify.Route(notifiers, subCfg.GetStringList("notifiers", nil))
+	if err != nil {
+		return nil, err
+	}
+	m, _ := routed.(*notify.Multi)
+	if m == nil {
+		m = &notify.Multi{}
+	}
+	if to := subCfg.GetStringList("to", nil); len(to) > 0 {
+		mail, err := notify.NewMailNotifier(cfg, to...)
+		if err != nil {
+			return nil, err
+		}
+		m.Names = append(m.Names, "mail to "+strings.Join(to, ", "))
+		m.Notifiers = append(m.Notifiers, mail)
+	}
+	if len(m.Notifiers) == 0 {
+		return nil, errors.New("to or notifiers must be set")
+	}
+	filter, err := reminder.NewFilter(subCfg.GetStringList("categories", nil), subCfg.GetStringList("tags", nil))
+	if err != nil {
+		return nil, err
+	}
+	schedule := subCfg.GetString("schedule", getJobSchedule(cfg, mailReminderJob))
+	_, err = scheduler.ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &reminderSubscription{name: name, notifier: m, filter: filter, schedule: schedule}, nil
+}
+
+// configVacation returns the vacation in the reminders section, or nil if none is set.
+func configVacation(cfg *util.Config) (*reminder.Vacation, error) {
+	remindersCfg := cfg.GetSubConfig("reminders")
+	if !remindersCfg.HasKey("vacation") {
+		return nil, nil
+	}
+	vacationCfg := remindersCfg.GetSubConfig("vacation")
+	v, err := reminder.ParseVacation(vacationCfg.GetString("from", ""), vacationCfg.GetString("to", ""))
+	if err != nil {
+		return nil, fmt.Errorf("reminders vacation: %s", err)
+	}
+	return v, nil
+}
 
-	host := reminder.MailHostProperties{Host: mailHost, Port: mailPort, User: mailUser, Password: mailPassword}
-	p := reminder.NewMailReminderProcessForSMTP(files.TodoFile, host, mailFrom, mailTo)
-	go p.CheckInfinitely()
-	log.Info("Started mail reminders\n")
+// newActionSigner returns the signer for the action links in reminders, or nil if the actions section is not set.
+// By default, the links point to the REST server at host and port.
+func newActionSigner(cfg *util.Config) (*actions.Signer, error) {
+	if !cfg.HasKey("actions") {
+		return nil, nil
+	}
+	actionsCfg := cfg.GetSubConfig("actions")
+	key := actionsCfg.GetString("hmac_key", "")
+	if len(key) < 16 {
+		return nil, errors.New("actions hmac_key must be set and have at least 16 characters")
+	}
+	expiry := actions.DefaultExpiry
+	if actionsCfg.HasKey("expiry") {
+		var ok bool
+		expiry, ok = parse.ParseLeadTime(actionsCfg.GetString("expiry", ""))
+		if !ok {
+			return nil, fmt.Errorf("invalid actions expiry %s, must be like 7d", actionsCfg.GetString("expiry", ""))
+		}
+	}
+	baseURL := actionsCfg.GetString("base_url", "")
+	if baseURL == "" {
+		restCfg := cfg.GetSubConfig("rest")
+		if restCfg.HasKey("socket") {
+			return nil, errors.New("actions base_url must be set if the REST server listens on a socket")
+		}
+		scheme := "http"
+		tlsCfg := restCfg.GetSubConfig("tls")
+		if tlsCfg.HasKey("cert_file") || tlsCfg.GetBool("self_signed", false) {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://%s:%d", scheme, cfg.GetString("host", "localhost"), cfg.GetInt("port", 8082))
+	}
+	return &actions.Signer{Key: []byte(key), BaseURL: baseURL, Expiry: expiry}, nil
 }
 
-func startExternalSources(files *util.FileConfig, extSrcConfig *util.Config) {
-	extSourcesProcess = extsources.NewExternalSourcesProcess(files, extSrcConfig)
-	go extSourcesProcess.CheckInfinitely()
+func startExternalSources(cfg *util.Config, files *util.FileConfig) {
+	p := extsources.NewExternalSourcesProcess(files, cfg.GetSubConfig("external_sources"))
+	jobs.Add(extSourcesJob, getJobSchedule(cfg, extSourcesJob), p.CheckOnce)
 	log.Info("Started external sources\n")
 }
 
-func startOutlookEvents(todoFile string, outlookConfig *util.Config) {
-	if outlookConfig.GetBool("enabled", false) {
-		go outlook.CheckInfinitely(todoFile, 5*time.Second)
+func startOutlookEvents(cfg *util.Config, todoFile string) {
+	if cfg.GetSubConfig("outlook_events").GetBool("enabled", false) {
+		lastMod := time.Unix(0, 0)
+		jobs.Add(outlookJob, getJobSchedule(cfg, outlookJob), func() error {
+			return outlook.CheckOnce(todoFile, &lastMod, recordFileParse)
+		})
 		log.Info("Started outlook syncing\n")
 	}
 }
 
-func startDailyBackupProcess(backupCfg *util.Config, files *util.FileConfig) {
-	dailyBackupFunc := func() {
-		for {
-			doDailyBackup(backupCfg, files)
-			time.Sleep(5 * time.Minute)
+func startDailyBackupProcess(cfg *util.Config, backupCfg *util.Config, files *util.FileConfig) {
+	jobs.Add(backupJob, getJobSchedule(cfg, backupJob), func() error {
+		return doDailyBackup(backupCfg, files)
+	})
+	log.Info("Started daily backup\n")
+}
+
+func startBackupPruning(cfg *util.Config, backupCfg *util.Config, files *util.FileConfig) {
+	// Already validated, so there are no errors.
+	policy, _ := backup.ParseRetentionPolicy(backupCfg.GetSubConfig("retention"))
+	jobs.Add(pruneJob, getJobSchedule(cfg, pruneJob), func() error {
+		_, err := doPruneBackups(backupCfg, files, policy, false)
+		return err
+	})
+	log.Info("Started backup pruning\n")
+}
+
+func startBackupVerification(cfg *util.Config, backupCfg *util.Config, files *util.FileConfig) {
+	days := backupCfg.GetInt("verify_days", backup.DefaultVerifyDays)
+	var mail notify.Notifier
+	if cfg.HasKey("mailTo") {
+		mail = notify.NewMailNotifierFromConfig(cfg)
+	}
+	jobs.Add(verifyJob, getJobSchedule(cfg, verifyJob), func() error {
+		return doVerifyBackups(backupCfg, files, days, mail)
+	})
+	log.Info("Started backup verification\n")
+}
+
+// doVerifyBackups verifies the backups and mails the problems, if mail is set.
+func doVerifyBackups(backupCfg *util.Config, files *util.FileConfig, days int, mail notify.Notifier) error {
+	reports, err := backup.Verify(backupCfg, files, days)
+	if err != nil {
+		log.Errorf("Error verifying backups: %s\n", err)
+		return err
+	}
+
+	count := 0
+	var content string
+	var text string
+	for _, r := range reports {
+		if r.OK() {
+			log.Infof("Verified %d backups in %s\n", r.Checked, r.Location)
+			continue
+		}
+		count += len(r.Problems)
+		content += fmt.Sprintf("<h3>%s</h3>\n<ul>\n", html.EscapeString(r.Location))
+		text += r.Location + ":\n"
+		for _, p := range r.Problems {
+			log.Errorf("Backup problem in %s: %s\n", r.Location, p)
+			content += fmt.Sprintf("<li>%s</li>\n", html.EscapeString(p))
+			text += "- " + p + "\n"
+		}
+		content += "</ul>\n"
+	}
+	if count == 0 {
+		return nil
+	}
+
+	if mail != nil {
+		err = mail.Notify(&notify.Message{Title: fmt.Sprintf("Backup verification found %d problems", count),
+			Text: text, HTML: content})
+		if err != nil {
+			log.Errorf("Error sending backup verification mail: %s\n", err)
+		}
+	}
+	return fmt.Errorf("backup verification found %d problems", count)
+}
+
+// startChangeBackups backs up the todo file when it stopped changing for on_change_delay, e.g. after
+// editing it manually.
+func startChangeBackups(backupCfg *util.Config, files *util.FileConfig) {
+	// Already validated, so there are no errors.
+	delay, _ := time.ParseDuration(backupCfg.GetString("on_change_delay", defaultChangeBackupDelay))
+	debouncer := backup.NewChangeDebouncer(delay, todoModTime(files))
+	services.Start(changeBackupService, func(ctx context.Context) error {
+		return supervisor.Every(ctx, clock.Real, changeBackupPollInterval, func() {
+			if debouncer.Check(todoModTime(files), clock.Real.Now()) {
+				doChangeBackup(backupCfg, files)
+			}
+		})
+	})
+	log.Infof("Started backups %s after changes\n", delay)
+}
+
+func todoModTime(files *util.FileConfig) time.Time {
+	stat, err := os.Stat(files.TodoFile)
+	if err != nil {
+		return time.Unix(0, 0)
+	}
+	return stat.ModTime()
+}
+
+func doChangeBackup(backupCfg *util.Config, files *util.FileConfig) {
+	newBackup, err := backup.SaveChanges(files)
+	if err != nil {
+		log.Errorf("Error backing up changes: %s\n", err)
+		return
+	}
+	if backup.HasRemotes(backupCfg) && newBackup != nil {
+		err = backup.SyncToRemote(backupCfg, files)
+		if err != nil {
+			log.Errorf("Error syncing backup to remote: %s\n", err)
 		}
 	}
-	go dailyBackupFunc()
-	log.Info("Started daily backup\n")
 }
 
-func doDailyBackup(backupCfg *util.Config, files *util.FileConfig) {
+// startScheduledPushes adds a push_<name> job for each remote with its own schedule. The other remotes
+// are pushed to after each backup.
+func startScheduledPushes(backupCfg *util.Config, files *util.FileConfig) {
+	// Already validated, so there are no errors.
+	remotes, _ := backup.ParseRemotes(backupCfg)
+	for _, r := range remotes {
+		if r.Schedule == "" {
+			continue
+		}
+		remote := r
+		jobs.Add(pushJobPrefix+remote.Name, remote.Schedule, func() error {
+			err := backup.SyncRemote(backupCfg, files, remote)
+			if err != nil {
+				log.Errorf("Error syncing backup to remote %s: %s\n", remote.Name, err)
+			}
+			return err
+		})
+		log.Infof("Started pushing backups to %s\n", remote.Name)
+	}
+}
+
+func stopScheduledPushes() {
+	for _, j := range jobs.Jobs() {
+		if strings.HasPrefix(j.Name, pushJobPrefix) {
+			stopJob(j.Name, "pushing backups to "+strings.TrimPrefix(j.Name, pushJobPrefix))
+		}
+	}
+}
+
+func doPruneBackups(backupCfg *util.Config, files *util.FileConfig, policy *backup.RetentionPolicy, dryRun bool) (*backup.PruneReport, error) {
+	report, err := backup.Prune(files, policy, dryRun)
+	if err != nil {
+		log.Errorf("Error pruning backups: %s\n", err)
+		return nil, err
+	}
+
+	if backup.HasRemotes(backupCfg) && !dryRun && len(report.Removed) > 0 {
+		err = backup.SyncToRemote(backupCfg, files)
+		if err != nil {
+			log.Errorf("Error syncing pruned backups to remote: %s\n", err)
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func doDailyBackup(backupCfg *util.Config, files *util.FileConfig) error {
 	newBackup, err := backup.CheckAndMakeDailyBackup(files)
 	if err != nil {
 		log.Errorf("Error making the daily backup: %s\n", err)
-		return
+		return err
 	}
 
-	if backupCfg.HasKey("remote_url") && newBackup != nil {
+	if backup.HasRemotes(backupCfg) && newBackup != nil {
 		err = backup.SyncToRemote(backupCfg, files)
 		if err != nil {
 			log.Errorf("Error syncing backup to remote: %s\n", err)
+			return err
 		}
 	}
+	return nil
 }
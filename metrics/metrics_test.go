@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "A test counter.", "result")
+	c.Inc("ok")
+	c.Inc("ok")
+	c.Inc("error")
+
+	assert.Equal(t, 2.0, c.Get("ok"))
+	assert.Equal(t, 1.0, c.Get("error"))
+	assert.Contains(t, writeMetric(c), `# HELP test_counter_total A test counter.
+# TYPE test_counter_total counter
+test_counter_total{result="error"} 1
+test_counter_total{result="ok"} 2
+`)
+}
+
+func TestGaugeVec(t *testing.T) {
+	g := NewGaugeVec("test_gauge", "A test gauge.", "category")
+	g.Set(3, "work")
+	g.Set(1, "home \"sweet\" home")
+
+	assert.Contains(t, writeMetric(g), `test_gauge{category="home \"sweet\" home"} 1
+test_gauge{category="work"} 3
+`)
+
+	g.Reset()
+	assert.NotContains(t, writeMetric(g), `test_gauge{`)
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "A test histogram.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/todo")
+	h.Observe(0.5, "/todo")
+	h.Observe(2, "/todo")
+
+	assert.Contains(t, writeMetric(h), `# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/todo",le="0.1"} 1
+test_duration_seconds_bucket{route="/todo",le="1"} 2
+test_duration_seconds_bucket{route="/todo",le="+Inf"} 3
+test_duration_seconds_sum{route="/todo"} 2.55
+test_duration_seconds_count{route="/todo"} 3
+`)
+}
+
+func TestWriteTextIncludesRegisteredMetrics(t *testing.T) {
+	NewCounterVec("test_registered_total", "Registered.").Inc()
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+
+	assert.Contains(t, buf.String(), "test_registered_total 1\n")
+}
+
+func writeMetric(m metric) string {
+	var buf bytes.Buffer
+	m.write(&buf)
+	return buf.String()
+}
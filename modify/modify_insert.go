@@ -2,6 +2,7 @@ package modify
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/sandro-h/sibylgo/moment"
 	"github.com/sandro-h/sibylgo/parse"
@@ -12,6 +13,9 @@ import (
 
 const noCatIdentifier = "__noCat__"
 
+// ErrMissingCategories is returned if moments should be inserted into categories that don't exist.
+var ErrMissingCategories = errors.New("content is missing necessary categories to insert moments")
+
 // Append inserts moments into the todo content. The moments are inserted at the end
 // of whichever category is set for them. The categories set for the moments must all exist in the content already,
 // new categories are not created. If no category is set, the moment will be appended into the "none"
@@ -153,7 +157,7 @@ func validateMissingInsertCategories(momsByCategory *map[string][]moment.Moment,
 		delete(missingCats, c.name)
 	}
 	if len(missingCats) > 0 {
-		return fmt.Errorf("content is missing necessary categories to insert moments: %s", util.Keys(missingCats))
+		return fmt.Errorf("%w: %s", ErrMissingCategories, util.Keys(missingCats))
 	}
 	return nil
 }
@@ -170,3 +174,54 @@ func (b categoryBoundary) getBound(prepend bool) int {
 	}
 	return b.bottom
 }
+
+// AppendText inserts raw todo text, e.g. a moment copied from a backup, at the end of the category.
+// If category is empty, the text is appended to the moments without category at the start of the content.
+// The category must exist in the content already.
+func AppendText(content string, category string, text string) (string, error) {
+	todos, err := parse.String(content)
+	if err != nil {
+		return "", err
+	}
+	catName := category
+	if catName == "" {
+		catName = noCatIdentifier
+	}
+
+	bound := -2
+	for _, b := range findCategoryBoundaries(todos) {
+		if b.name == catName {
+			bound = b.bottom
+			break
+		}
+	}
+	if bound == -2 {
+		return "", fmt.Errorf("%w: [%s]", ErrMissingCategories, category)
+	}
+
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	if bound == -1 {
+		return text + content, nil
+	}
+
+	res := ""
+	ln := 0
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		res += scanner.Text() + "\n"
+		if ln == bound {
+			res += text
+		}
+		ln++
+	}
+	return res, nil
+}
+
+// AppendTextInFile inserts raw todo text at the end of the category in the todo file, see AppendText.
+func AppendTextInFile(todoFile string, category string, text string) error {
+	return modifyInFile(todoFile, func(content string) (string, error) {
+		return AppendText(content, category, text)
+	})
+}
@@ -0,0 +1,90 @@
+package modify
+
+import (
+	"fmt"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	"sort"
+	"time"
+)
+
+// InFile modifies the content of the todo file with modifyFunc. Fails with util.ErrWriteConflict if the file was
+// changed in the meantime.
+func InFile(todoFile string, modifyFunc func(string) (string, error)) error {
+	return modifyInFile(todoFile, modifyFunc)
+}
+
+// MarkDone marks the moment done in the todo content. The rest of the moment line is kept as it is.
+// The moment must have been parsed from the same content.
+func MarkDone(content string, mom moment.Moment) (string, error) {
+	runes := []rune(content)
+	coords := mom.GetDocCoords()
+	if coords.Offset+coords.Length > len(runes) {
+		return "", fmt.Errorf("moment '%s' is not in the content", mom.GetName())
+	}
+	line := runes[coords.Offset : coords.Offset+coords.Length]
+	lbracket := indexRune(line, parse.ParseConfig.GetLBracket(), 0)
+	rbracket := indexRune(line, parse.ParseConfig.GetRBracket(), lbracket+1)
+	if lbracket < 0 || rbracket < 0 {
+		return "", fmt.Errorf("moment '%s' is not in the content", mom.GetName())
+	}
+	from := coords.Offset + lbracket + 1
+	to := coords.Offset + rbracket
+	return string(runes[:from]) + string(parse.ParseConfig.GetDoneMark()) + string(runes[to:]), nil
+}
+
+// ShiftDates moves the start and end date of the moment by the given number of days in the todo content.
+// The dates keep their format, e.g. 5.1.19 becomes 6.1.19 and 05.01.2019 becomes 06.01.2019.
+// The moment must have been parsed from the same content.
+func ShiftDates(content string, mom *moment.SingleMoment, days int) (string, error) {
+	var dates []*moment.Date
+	for _, dt := range []*moment.Date{mom.Start, mom.End} {
+		// A single date is both start and end.
+		if dt != nil && (len(dates) == 0 || dates[0].Offset != dt.Offset) {
+			dates = append(dates, dt)
+		}
+	}
+	if len(dates) == 0 {
+		return "", fmt.Errorf("moment '%s' has no date", mom.GetName())
+	}
+	// Replace from the back so the offsets of the other dates stay valid.
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Offset > dates[j].Offset })
+
+	runes := []rune(content)
+	for _, dt := range dates {
+		if dt.Offset+dt.Length > len(runes) {
+			return "", fmt.Errorf("moment '%s' is not in the content", mom.GetName())
+		}
+		old := string(runes[dt.Offset : dt.Offset+dt.Length])
+		format := dateFormatOf(old)
+		if format == "" {
+			return "", fmt.Errorf("date %s of moment '%s' is not in the content", old, mom.GetName())
+		}
+		shifted := []rune(dt.Time.AddDate(0, 0, days).Format(format))
+		runes = append(runes[:dt.Offset], append(shifted, runes[dt.Offset+dt.Length:]...)...)
+	}
+	return string(runes), nil
+}
+
+// dateFormatOf returns the first date format that parses the date, like the parser does.
+func dateFormatOf(date string) string {
+	for _, f := range parse.ParseConfig.GetDateFormats() {
+		_, err := time.ParseInLocation(f, date, time.Local)
+		if err == nil {
+			return f
+		}
+	}
+	return ""
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	if from < 0 {
+		return -1
+	}
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,63 @@
+package modify
+
+import (
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const momentContent = `------------------
+ Work
+------------------
+[] tëst (5.1.19 13:00) #t1
+[p] ranged (05.01.2019-2.2.2019)
+	[] sub (-8.1.19)
+		comment
+`
+
+func TestMarkDone(t *testing.T) {
+	todos, _ := parse.String(momentContent)
+
+	res, err := MarkDone(momentContent, todos.Moments[1])
+	assert.NoError(t, err)
+	res, _ = MarkDone(res, todos.Moments[1].GetSubMoments()[0])
+
+	assert.Equal(t, `------------------
+ Work
+------------------
+[] tëst (5.1.19 13:00) #t1
+[x] ranged (05.01.2019-2.2.2019)
+	[x] sub (-8.1.19)
+		comment
+`, res)
+}
+
+func TestShiftDates(t *testing.T) {
+	todos, _ := parse.String(momentContent)
+
+	res, err := ShiftDates(momentContent, todos.Moments[0].(*moment.SingleMoment), 1)
+	assert.NoError(t, err)
+	res, _ = ShiftDates(res, todos.Moments[1].(*moment.SingleMoment), 30)
+	assert.Equal(t, `------------------
+ Work
+------------------
+[] tëst (6.1.19 13:00) #t1
+[p] ranged (04.02.2019-4.3.2019)
+	[] sub (-8.1.19)
+		comment
+`, res)
+
+	sub := todos.Moments[1].GetSubMoments()[0].(*moment.SingleMoment)
+	res, err = ShiftDates(momentContent, sub, 7)
+	assert.NoError(t, err)
+	assert.Contains(t, res, "\t[] sub (-15.1.19)\n\t\tcomment\n")
+}
+
+func TestShiftDates_NoDate(t *testing.T) {
+	todos, _ := parse.String("[] foo\n")
+
+	_, err := ShiftDates("[] foo\n", todos.Moments[0].(*moment.SingleMoment), 1)
+
+	assert.EqualError(t, err, "moment 'foo' has no date")
+}
@@ -1,10 +1,12 @@
 package modify
 
 import (
+	"errors"
 	"github.com/sandro-h/sibylgo/moment"
 	"github.com/sandro-h/sibylgo/parse"
 	tu "github.com/sandro-h/sibylgo/testutil"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 )
 
@@ -81,6 +83,35 @@ func TestUpsertWithDuplicateID(t *testing.T) {
 	assert.Equal(t, "duplicate moment ID 'bar'", err.Error())
 }
 
+func TestAppendText(t *testing.T) {
+	const testName = "TestAppendText"
+	input := tu.ReadTestdata(t, testName, "insert.orig")
+
+	modified, err := AppendText(input, "cat 1", "[] restored\n\tcomment")
+
+	assert.Nil(t, err)
+	assert.Contains(t, modified, "\t[] bar2\n[] restored\n\tcomment\n---------------\n cat 2")
+}
+
+func TestAppendTextWithoutCategory(t *testing.T) {
+	const testName = "TestAppendTextWithoutCategory"
+	input := tu.ReadTestdata(t, testName, "insert.orig")
+
+	modified, err := AppendText(input, "", "[] restored\n")
+
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(modified, "[] hello\n[] restored\n\n"))
+}
+
+func TestAppendTextMissingCategory(t *testing.T) {
+	const testName = "TestAppendTextMissingCategory"
+	input := tu.ReadTestdata(t, testName, "insert.orig")
+
+	_, err := AppendText(input, "nonexistent cat", "[] restored\n")
+
+	assert.True(t, errors.Is(err, ErrMissingCategories))
+}
+
 func parseTestdata(t *testing.T, testName string, path string) []moment.Moment {
 	update := tu.ReadTestdata(t, testName, path)
 	toUpdate, err := parse.String(update)
@@ -16,7 +16,7 @@ func modifyInFile(todoFile string, modifyFunc func(string) (string, error)) erro
 		return err
 	}
 
-	err = util.WriteFile(todoFile, updatedContent)
+	err = util.WriteFileIfUnchanged(todoFile, content, updatedContent)
 	if err != nil {
 		return err
 	}
@@ -13,6 +13,7 @@ type Moment interface {
 	SetCategory(cat *Category)
 	SetWorkState(state WorkState)
 	SetPriority(prio int)
+	SetReminders(leads []time.Duration)
 	AddSubMoment(sub Moment)
 	AddComment(com *CommentLine)
 	RemoveLastComment()
@@ -30,6 +31,7 @@ type Moment interface {
 	GetLastComment() *CommentLine
 	GetDocCoords() DocCoords
 	GetTimeOfDay() *Date
+	GetReminders() []time.Duration
 	GetBottomLineNumber() int
 }
 
@@ -64,6 +66,7 @@ type BaseMoment struct {
 	category   *Category
 	comments   []*CommentLine
 	subMoments []Moment
+	reminders  []time.Duration
 	TimeOfDay  *Date
 	DocCoords
 }
@@ -93,6 +96,11 @@ func (m *BaseMoment) SetPriority(prio int) {
 	m.priority = prio
 }
 
+// SetReminders sets the lead times before the moment at which reminders are sent.
+func (m *BaseMoment) SetReminders(leads []time.Duration) {
+	m.reminders = leads
+}
+
 // AddSubMoment adds a sub moment to the moment.
 func (m *BaseMoment) AddSubMoment(sub Moment) {
 	m.subMoments = append(m.subMoments, sub)
@@ -182,6 +190,12 @@ func (m *BaseMoment) GetTimeOfDay() *Date {
 	return m.TimeOfDay
 }
 
+// GetReminders returns the lead times before the moment at which reminders are sent,
+// if defined.
+func (m *BaseMoment) GetReminders() []time.Duration {
+	return m.reminders
+}
+
 // GetBottomLineNumber returns the highest line number in the text file associated
 // with the moment. This could be the line number of the last comment or last sub moment.
 func (m *BaseMoment) GetBottomLineNumber() int {
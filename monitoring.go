@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sandro-h/sibylgo/metrics"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/reminder"
+	"github.com/sandro-h/sibylgo/status"
+	log "github.com/sirupsen/logrus"
+)
+
+const noCategory = "_none"
+
+var startTime = time.Now()
+
+var requestDuration = metrics.NewHistogramVec("sibylgo_http_request_duration_seconds",
+	"Latency of REST requests.", metrics.DefaultBuckets, "method", "route", "code")
+var openMoments = metrics.NewGaugeVec("sibylgo_open_moments",
+	"Number of moments that are not done, per category.", "category")
+var overdueMoments = metrics.NewGaugeVec("sibylgo_overdue_moments",
+	"Number of moments that are not done and whose end date has passed, per category.", "category")
+var parsesTotal = metrics.NewCounterVec("sibylgo_parses_total",
+	"Number of parsed todo files and contents.", "source", "result")
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// measureRequests records the latency of every REST request by route.
+func measureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := r.URL.Path
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		requestDuration.Observe(time.Since(start).Seconds(), r.Method, route, strconv.Itoa(rec.code))
+	})
+}
+
+// parseTodoFile parses the todo file and records the parse.
+func parseTodoFile(path string) (*moment.Todos, error) {
+	todos, err := parse.File(path)
+	recordFileParse(path, err)
+	return todos, err
+}
+
+// parseContent parses todo content sent by a client and records the parse.
+func parseContent(reader io.Reader) (*moment.Todos, error) {
+	todos, err := parse.Reader(reader)
+	recordParse("content", err)
+	return todos, err
+}
+
+// recordFileParse records a parse of the todo file in the status and metrics.
+func recordFileParse(path string, err error) {
+	status.RecordParse(path, err)
+	recordParse("file", err)
+}
+
+func recordParse(source string, err error) {
+	if err != nil {
+		parsesTotal.Inc(source, "error")
+	} else {
+		parsesTotal.Inc(source, "ok")
+	}
+}
+
+// updateMomentMetrics recomputes the moment gauges from the current todo file.
+func updateMomentMetrics() {
+	files := currentFiles()
+	openMoments.Reset()
+	overdueMoments.Reset()
+	if files.TodoFile == "" {
+		return
+	}
+
+	// Scrapes are not recorded, so they do not count as parses or replace the last parse in the status.
+	todos, err := parse.File(files.TodoFile)
+	if err != nil {
+		log.Errorf("Could not parse todo file for metrics: %s\n", err)
+		return
+	}
+
+	openCounts := make(map[string]int)
+	for _, c := range todos.Categories {
+		openCounts[c.Name] = 0
+	}
+	countOpenMoments(todos.Moments, openCounts)
+	overdueCounts := make(map[string]int)
+	for cat := range openCounts {
+		overdueCounts[cat] = 0
+	}
+	for _, o := range reminder.FindOverdueMoments(todos, time.Now()) {
+		overdueCounts[categoryName(o.Moment)]++
+	}
+
+	for cat, cnt := range openCounts {
+		openMoments.Set(float64(cnt), cat)
+	}
+	for cat, cnt := range overdueCounts {
+		overdueMoments.Set(float64(cnt), cat)
+	}
+}
+
+func countOpenMoments(moms []moment.Moment, counts map[string]int) {
+	for _, m := range moms {
+		if !m.IsDone() {
+			counts[categoryName(m)]++
+			countOpenMoments(m.GetSubMoments(), counts)
+		}
+	}
+}
+
+func categoryName(m moment.Moment) string {
+	if m.GetCategory() == nil {
+		return noCategory
+	}
+	return m.GetCategory().Name
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const commandTimeout = 30 * time.Second
+
+// CommandNotifier runs a local command for each message. The text is passed on stdin and the title, text
+// and HTML in the SIBYLGO_TITLE, SIBYLGO_TEXT and SIBYLGO_HTML environment variables.
+type CommandNotifier struct {
+	// Command is the executable and its arguments.
+	Command []string
+}
+
+// Notify runs the command and fails if it exits with an error.
+func (n *CommandNotifier) Notify(msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.Command[0], n.Command[1:]...)
+	cmd.Stdin = strings.NewReader(msg.Text)
+	cmd.Env = append(os.Environ(),
+		"SIBYLGO_TITLE="+msg.Title,
+		"SIBYLGO_TEXT="+msg.Text,
+		"SIBYLGO_HTML="+msg.HTML)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s %s", n.Command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
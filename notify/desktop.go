@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsDest   = "org.freedesktop.Notifications"
+	notificationsPath   = "/org/freedesktop/Notifications"
+	notificationsNotify = "org.freedesktop.Notifications.Notify"
+)
+
+// DesktopNotifier shows the message as desktop notification via the org.freedesktop.Notifications
+// D-Bus service of the session bus.
+type DesktopNotifier struct {
+	// call calls the D-Bus method, overridden in tests.
+	call func(method string, args ...interface{}) error
+}
+
+// Notify shows the notification.
+func (n *DesktopNotifier) Notify(msg *Message) error {
+	call := n.call
+	if call == nil {
+		call = callSessionBus
+	}
+	// app name, replaces id, icon, summary, body, actions, hints, timeout (-1 is the server default)
+	return call(notificationsNotify, "sibylgo", uint32(0), "", msg.Title, msg.Text,
+		[]string{}, map[string]dbus.Variant{}, int32(-1))
+}
+
+func callSessionBus(method string, args ...interface{}) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Object(notificationsDest, notificationsPath).Call(method, 0, args...).Err
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"html"
+	"net/http"
+	"strings"
+)
+
+// WebhookNotifier posts the message as JSON with title, text and html to the URL. The actions of the message
+// are added as a list of label and url.
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+}
+
+// Notify sends the message.
+func (n *WebhookNotifier) Notify(msg *Message) error {
+	body := map[string]interface{}{"title": msg.Title, "text": msg.Text, "html": msg.HTML}
+	if len(msg.Actions) > 0 {
+		body["actions"] = msg.Actions
+	}
+	return postJSON(n.URL, n.Headers, body)
+}
+
+// NtfyNotifier publishes the message to an ntfy topic, e.g. https://ntfy.sh/my-todos.
+type NtfyNotifier struct {
+	URL string
+	// Token is the access token for protected topics, optional.
+	Token string
+	// Priority is the ntfy priority (1-5, or min, low, default, high, max), optional.
+	Priority string
+}
+
+// Notify sends the message.
+func (n *NtfyNotifier) Notify(msg *Message) error {
+	req, err := http.NewRequest("POST", n.URL, strings.NewReader(msg.Text))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", msg.Title)
+	if n.Priority != "" {
+		req.Header.Set("Priority", n.Priority)
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send(req)
+}
+
+// GotifyNotifier sends the message to a Gotify server with an application token.
+type GotifyNotifier struct {
+	// URL is the base URL of the server, e.g. https://gotify.example.com.
+	URL      string
+	Token    string
+	Priority int
+}
+
+// Notify sends the message.
+func (n *GotifyNotifier) Notify(msg *Message) error {
+	return postJSON(strings.TrimSuffix(n.URL, "/")+"/message", map[string]string{"X-Gotify-Key": n.Token},
+		map[string]interface{}{"title": msg.Title, "message": msg.Text, "priority": n.Priority})
+}
+
+// SlackNotifier posts the message to a Slack-compatible incoming webhook (also Mattermost, Rocket.Chat, ...).
+type SlackNotifier struct {
+	URL string
+}
+
+// Notify sends the message.
+func (n *SlackNotifier) Notify(msg *Message) error {
+	return postJSON(n.URL, nil, map[string]string{"text": "*" + msg.Title + "*\n" + msg.Text})
+}
+
+// MatrixNotifier posts the message to a Matrix incoming webhook, e.g. of matrix-hookshot, which accepts
+// a text and an HTML body.
+type MatrixNotifier struct {
+	URL string
+}
+
+// Notify sends the message.
+func (n *MatrixNotifier) Notify(msg *Message) error {
+	body := msg.HTML
+	if body == "" {
+		body = html.EscapeString(msg.Text)
+	}
+	return postJSON(n.URL, nil, map[string]string{
+		"text": msg.Title + "\n" + msg.Text,
+		"html": "<b>" + html.EscapeString(msg.Title) + "</b><br>\n" + body,
+	})
+}
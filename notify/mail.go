@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sandro-h/sibylgo/util"
+	"gopkg.in/gomail.v2"
+)
+
+// MailNotifier sends the message as mail over SMTP, with the text and HTML as alternatives.
+type MailNotifier struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+	// To can be several addresses separated by commas.
+	To string
+}
+
+// NewMailNotifierFromConfig creates a MailNotifier with the mailHost, mailPort, mailUser, mailPassword,
+// mailFrom and mailTo config keys.
+func NewMailNotifierFromConfig(cfg *util.Config) *MailNotifier {
+	return &MailNotifier{
+		Host:     cfg.GetStringOrFail("mailHost"),
+		Port:     cfg.GetIntOrFail("mailPort"),
+		User:     cfg.GetString("mailUser", ""),
+		Password: cfg.GetString("mailPassword", ""),
+		From:     cfg.GetStringOrFail("mailFrom"),
+		To:       cfg.GetStringOrFail("mailTo"),
+	}
+}
+
+// newMailNotifier creates a MailNotifier for the to address of a mail notifier config, sending over the
+// mail host of the root config.
+func newMailNotifier(root *util.Config, cfg *util.Config) (*MailNotifier, error) {
+	if !cfg.HasKey("to") {
+		return nil, fmt.Errorf("to must be set")
+	}
+	return NewMailNotifier(root, cfg.GetString("to", ""))
+}
+
+// NewMailNotifier creates a MailNotifier for the recipients, sending over the mail host of the root config.
+func NewMailNotifier(root *util.Config, to ...string) (*MailNotifier, error) {
+	for _, k := range []string{"mailHost", "mailPort", "mailFrom"} {
+		if !root.HasKey(k) {
+			return nil, fmt.Errorf("%s must be set", k)
+		}
+	}
+	return &MailNotifier{
+		Host:     root.GetStringOrFail("mailHost"),
+		Port:     root.GetIntOrFail("mailPort"),
+		User:     root.GetString("mailUser", ""),
+		Password: root.GetString("mailPassword", ""),
+		From:     root.GetStringOrFail("mailFrom"),
+		To:       strings.Join(to, ", "),
+	}, nil
+}
+
+// Notify sends the message.
+func (n *MailNotifier) Notify(msg *Message) error {
+	d := gomail.NewDialer(n.Host, n.Port, n.User, n.Password)
+	return d.DialAndSend(n.newMail(msg))
+}
+
+// newMail creates the mail for the message. With both text and HTML, it is multipart/alternative.
+func (n *MailNotifier) newMail(msg *Message) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", n.From)
+	m.SetHeader("To", recipients(n.To)...)
+	m.SetHeader("Subject", msg.Title)
+	switch {
+	case msg.Text != "" && msg.HTML != "":
+		// Mail clients show the last part they support
+		m.SetBody("text/plain", msg.Text)
+		m.AddAlternative("text/html", msg.HTML)
+	case msg.HTML != "":
+		m.SetBody("text/html", msg.HTML)
+	default:
+		m.SetBody("text/plain", msg.Text)
+	}
+	return m
+}
+
+func recipients(to string) []string {
+	var res []string
+	for _, r := range strings.Split(to, ",") {
+		if strings.TrimSpace(r) != "" {
+			res = append(res, strings.TrimSpace(r))
+		}
+	}
+	return res
+}
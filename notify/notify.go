@@ -0,0 +1,260 @@
+// Package notify delivers notifications, e.g. reminders, by mail, webhooks, push services, chat webhooks,
+// a local command or desktop notifications.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// Notifier types that can be set with type in the notifiers config.
+const (
+	TypeWebhook = "webhook"
+	TypeNtfy    = "ntfy"
+	TypeGotify  = "gotify"
+	TypeSlack   = "slack"
+	TypeMatrix  = "matrix"
+	TypeCommand = "command"
+	TypeDesktop = "desktop"
+	TypeMail    = "mail"
+)
+
+// MailNotifierName is the name of the notifier that sends mails with the mail* config keys.
+const MailNotifierName = "mail"
+
+const httpTimeout = 10 * time.Second
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Message is a notification.
+type Message struct {
+	Title string
+	// Text is the plain text body.
+	Text string
+	// HTML is the body for notifiers that support it, e.g. mail.
+	HTML string
+	// Critical messages are delivered even during quiet hours and on non-working days.
+	Critical bool
+	// Expires is when a held back message is no longer worth delivering. Zero means never.
+	Expires time.Time
+	// Actions are links to act on the subject of the message, e.g. to mark a todo done. They are also in the
+	// Text and HTML, but notifiers can offer them separately.
+	Actions []Action
+}
+
+// Action is a link to act on the subject of a message.
+type Action struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// Notifier sends notifications to some destination.
+type Notifier interface {
+	Notify(msg *Message) error
+}
+
+// Multi sends notifications to several notifiers.
+type Multi struct {
+	Names     []string
+	Notifiers []Notifier
+}
+
+// Notify sends the message to all notifiers, even if some fail. Returns the errors of all failed notifiers.
+func (m *Multi) Notify(msg *Message) error {
+	var errs []string
+	for i, n := range m.Notifiers {
+		err := n.Notify(msg)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", m.Names[i], err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Flush flushes all notifiers that hold back messages. Returns the errors of all failed notifiers.
+func (m *Multi) Flush() error {
+	var errs []string
+	for i, n := range m.Notifiers {
+		err := Flush(n)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", m.Names[i], err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// NewFromConfig creates the notifiers in the notifiers section of the config, by name. If mails are configured
+// with mailTo, the mail notifier is added too. Notifiers with quiet_hours or working_days hold back their
+// messages outside of those in an Outbox next to the todo file.
+func NewFromConfig(cfg *util.Config) (map[string]Notifier, error) {
+	notifiers := make(map[string]Notifier)
+	if cfg.HasKey("mailTo") {
+		notifiers[MailNotifierName] = NewMailNotifierFromConfig(cfg)
+	}
+
+	notifiersCfg := cfg.GetSubConfig("notifiers")
+	outbox := NewOutbox(util.NewFileConfigFromConfig(cfg).OutboxFile)
+	for _, name := range notifiersCfg.Keys() {
+		if !namePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid notifier name %s, only letters, digits, - and _ are allowed", name)
+		}
+		notifierCfg := notifiersCfg.GetSubConfig(name)
+		var n Notifier
+		var err error
+		if name == MailNotifierName {
+			// The mail notifier is configured with the mail* keys, only its delivery window can be set here.
+			n = notifiers[MailNotifierName]
+			if n == nil || !onlyWindowKeys(notifierCfg) {
+				return nil, fmt.Errorf("notifier name %s is reserved for the mail* config", name)
+			}
+		} else {
+			n, err = newNotifier(cfg, notifierCfg)
+		}
+		if err == nil {
+			n, err = withWindow(cfg, name, n, notifierCfg, outbox)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %s", name, err)
+		}
+		notifiers[name] = n
+	}
+	return notifiers, nil
+}
+
+func onlyWindowKeys(cfg *util.Config) bool {
+	for _, k := range cfg.Keys() {
+		if k != "quiet_hours" && k != "working_days" {
+			return false
+		}
+	}
+	return true
+}
+
+// withWindow wraps n in a Deferring notifier if quiet_hours or working_days are set in its config.
+func withWindow(root *util.Config, name string, n Notifier, cfg *util.Config, outbox *Outbox) (Notifier, error) {
+	if !cfg.HasKey("quiet_hours") && !cfg.HasKey("working_days") {
+		return n, nil
+	}
+	window, err := ParseDeliveryWindow(cfg.GetString("quiet_hours", ""), cfg.GetStringList("working_days", nil))
+	if err != nil {
+		return nil, err
+	}
+	if !root.HasKey("todoFile") {
+		return nil, fmt.Errorf("quiet_hours and working_days need todoFile to be set")
+	}
+	return &Deferring{Name: name, Notifier: n, Window: window, Outbox: outbox}, nil
+}
+
+// newNotifier creates the notifier for its config section cfg. Mail notifiers use the mail* keys of the root config.
+func newNotifier(root *util.Config, cfg *util.Config) (Notifier, error) {
+	typ := cfg.GetString("type", "")
+	url := cfg.GetString("url", "")
+	if url == "" && typ != TypeCommand && typ != TypeDesktop && typ != TypeMail {
+		return nil, fmt.Errorf("url must be set")
+	}
+
+	switch typ {
+	case TypeWebhook:
+		headers := make(map[string]string)
+		headersCfg := cfg.GetSubConfig("headers")
+		for _, k := range headersCfg.Keys() {
+			headers[k] = headersCfg.GetString(k, "")
+		}
+		return &WebhookNotifier{URL: url, Headers: headers}, nil
+	case TypeNtfy:
+		return &NtfyNotifier{URL: url, Token: cfg.GetString("token", ""), Priority: cfg.GetString("priority", "")}, nil
+	case TypeGotify:
+		if !cfg.HasKey("token") {
+			return nil, fmt.Errorf("token must be set")
+		}
+		return &GotifyNotifier{URL: url, Token: cfg.GetString("token", ""), Priority: cfg.GetInt("priority", 5)}, nil
+	case TypeSlack:
+		return &SlackNotifier{URL: url}, nil
+	case TypeMatrix:
+		return &MatrixNotifier{URL: url}, nil
+	case TypeCommand:
+		command := cfg.GetStringList("command", nil)
+		if len(command) == 0 {
+			return nil, fmt.Errorf("command must be set")
+		}
+		return &CommandNotifier{Command: command}, nil
+	case TypeDesktop:
+		return &DesktopNotifier{}, nil
+	case TypeMail:
+		return newMailNotifier(root, cfg)
+	default:
+		return nil, fmt.Errorf("unknown type %s, must be one of %s", typ,
+			strings.Join([]string{TypeWebhook, TypeNtfy, TypeGotify, TypeSlack, TypeMatrix, TypeCommand, TypeDesktop, TypeMail}, ", "))
+	}
+}
+
+// Route returns a notifier sending to the named notifiers, or nil if names is empty.
+func Route(notifiers map[string]Notifier, names []string) (Notifier, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	m := &Multi{}
+	for _, name := range names {
+		n, found := notifiers[name]
+		if !found {
+			return nil, fmt.Errorf("unknown notifier %s, must be one of %s", name, strings.Join(sortedNames(notifiers), ", "))
+		}
+		m.Names = append(m.Names, name)
+		m.Notifiers = append(m.Notifiers, n)
+	}
+	return m, nil
+}
+
+func sortedNames(notifiers map[string]Notifier) []string {
+	var names []string
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// postJSON posts the body as JSON and fails if the response is not 2xx.
+func postJSON(url string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return send(req)
+}
+
+func send(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("request returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
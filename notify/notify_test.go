@@ -0,0 +1,270 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMessage = &Message{Title: "TODOs for Friday, 4 Jan 2019", Text: "- bar\n", HTML: "<ul>\n<li><b>bar</b></li>\n</ul>\n"}
+
+// received is a request received by the stand-in server.
+type received struct {
+	path    string
+	headers http.Header
+	body    string
+}
+
+// startStandIn starts a local HTTP server that records the requests and responds with the status.
+func startStandIn(status int) (*httptest.Server, *[]received) {
+	var reqs []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		reqs = append(reqs, received{path: r.URL.Path, headers: r.Header, body: string(body)})
+		w.WriteHeader(status)
+	}))
+	return srv, &reqs
+}
+
+func jsonBody(t *testing.T, r received) map[string]interface{} {
+	var res map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(r.body), &res))
+	return res
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+
+	err := (&WebhookNotifier{URL: srv.URL + "/hook", Headers: map[string]string{"X-Token": "abc"}}).Notify(testMessage)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/hook", (*reqs)[0].path)
+	assert.Equal(t, "abc", (*reqs)[0].headers.Get("X-Token"))
+	assert.Equal(t, "application/json", (*reqs)[0].headers.Get("Content-Type"))
+	assert.Equal(t, map[string]interface{}{"title": testMessage.Title, "text": "- bar\n", "html": testMessage.HTML},
+		jsonBody(t, (*reqs)[0]))
+}
+
+func TestWebhookNotifier_Actions(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+	msg := &Message{Title: "foo", Actions: []Action{{Label: "Done", URL: "http://localhost:8082/actions/abc"}}}
+
+	err := (&WebhookNotifier{URL: srv.URL}).Notify(msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"label": "Done", "url": "http://localhost:8082/actions/abc"}},
+		jsonBody(t, (*reqs)[0])["actions"])
+}
+
+func TestWebhookNotifier_Error(t *testing.T) {
+	srv, _ := startStandIn(http.StatusInternalServerError)
+	defer srv.Close()
+
+	err := (&WebhookNotifier{URL: srv.URL}).Notify(testMessage)
+
+	assert.EqualError(t, err, "request returned HTTP 500")
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+
+	err := (&NtfyNotifier{URL: srv.URL + "/my-todos", Token: "tk_123", Priority: "high"}).Notify(testMessage)
+
+	assert.NoError(t, err)
+	r := (*reqs)[0]
+	assert.Equal(t, "/my-todos", r.path)
+	assert.Equal(t, testMessage.Title, r.headers.Get("Title"))
+	assert.Equal(t, "high", r.headers.Get("Priority"))
+	assert.Equal(t, "Bearer tk_123", r.headers.Get("Authorization"))
+	assert.Equal(t, "- bar\n", r.body)
+}
+
+func TestGotifyNotifier(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+
+	err := (&GotifyNotifier{URL: srv.URL + "/", Token: "app-token", Priority: 8}).Notify(testMessage)
+
+	assert.NoError(t, err)
+	r := (*reqs)[0]
+	assert.Equal(t, "/message", r.path)
+	assert.Equal(t, "app-token", r.headers.Get("X-Gotify-Key"))
+	assert.Equal(t, map[string]interface{}{"title": testMessage.Title, "message": "- bar\n", "priority": 8.0}, jsonBody(t, r))
+}
+
+func TestSlackNotifier(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+
+	err := (&SlackNotifier{URL: srv.URL}).Notify(testMessage)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"text": "*TODOs for Friday, 4 Jan 2019*\n- bar\n"}, jsonBody(t, (*reqs)[0]))
+}
+
+func TestMatrixNotifier(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+
+	err := (&MatrixNotifier{URL: srv.URL}).Notify(&Message{Title: "Reminder <1>", Text: "a < b"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"text": "Reminder <1>\na < b", "html": "<b>Reminder &lt;1&gt;</b><br>\na &lt; b"},
+		jsonBody(t, (*reqs)[0]))
+}
+
+func TestCommandNotifier(t *testing.T) {
+	dir := tu.MakeTempDir("sibyl_notify_test")
+	defer tu.DeleteTempDir(dir)
+	out := filepath.Join(dir, "out.txt")
+
+	err := (&CommandNotifier{Command: []string{"sh", "-c", `echo "$SIBYLGO_TITLE" > ` + out + ` && cat >> ` + out}}).Notify(testMessage)
+
+	assert.NoError(t, err)
+	content, _ := util.ReadFile(out)
+	assert.Equal(t, "TODOs for Friday, 4 Jan 2019\n- bar\n", content)
+}
+
+func TestCommandNotifier_Error(t *testing.T) {
+	err := (&CommandNotifier{Command: []string{"sh", "-c", "echo no network; exit 3"}}).Notify(testMessage)
+
+	assert.EqualError(t, err, "sh: exit status 3 no network")
+}
+
+func TestDesktopNotifier(t *testing.T) {
+	var calledMethod string
+	var calledArgs []interface{}
+	n := &DesktopNotifier{call: func(method string, args ...interface{}) error {
+		calledMethod = method
+		calledArgs = args
+		return nil
+	}}
+
+	err := n.Notify(testMessage)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "org.freedesktop.Notifications.Notify", calledMethod)
+	assert.Equal(t, []interface{}{"sibylgo", uint32(0), "", testMessage.Title, "- bar\n"}, calledArgs[:5])
+	assert.Equal(t, int32(-1), calledArgs[7])
+}
+
+func TestMailNotifier_Multipart(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := (&MailNotifier{From: "foo@example.com", To: "bar@example.com"}).newMail(testMessage).WriteTo(&buf)
+
+	assert.NoError(t, err)
+	mail := buf.String()
+	tu.AssertContains(t, "Content-Type: multipart/alternative;", mail)
+	tu.AssertContains(t, "Content-Type: text/plain; charset=UTF-8", mail)
+	tu.AssertContains(t, "Content-Type: text/html; charset=UTF-8", mail)
+	assert.Less(t, strings.Index(mail, "text/plain"), strings.Index(mail, "text/html"), "HTML is preferred")
+}
+
+func TestMailNotifier_SeveralRecipients(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := (&MailNotifier{To: "bar@example.com, baz@example.com,"}).newMail(testMessage).WriteTo(&buf)
+
+	assert.NoError(t, err)
+	tu.AssertContains(t, "To: bar@example.com, baz@example.com\r\n", buf.String())
+}
+
+func TestMailNotifier_TextOnly(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := (&MailNotifier{}).newMail(&Message{Title: "Reminder", Text: "a < b"}).WriteTo(&buf)
+
+	assert.NoError(t, err)
+	tu.AssertContains(t, "Content-Type: text/plain; charset=UTF-8", buf.String())
+	assert.NotContains(t, buf.String(), "multipart")
+}
+
+func TestNewFromConfig(t *testing.T) {
+	cfg, _ := util.LoadConfigString(`
+mailHost: smtp.example.com
+mailPort: 3025
+mailFrom: foo@example.com
+mailTo: bar@example.com
+notifiers:
+  phone:
+    type: ntfy
+    url: https://ntfy.sh/my-todos
+  script:
+    type: command
+    command: [notify.sh, --urgent]
+  desktop:
+    type: desktop
+  boss:
+    type: mail
+    to: boss@example.com
+`)
+
+	notifiers, err := NewFromConfig(cfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Notifier{
+		"mail":    &MailNotifier{Host: "smtp.example.com", Port: 3025, From: "foo@example.com", To: "bar@example.com"},
+		"phone":   &NtfyNotifier{URL: "https://ntfy.sh/my-todos"},
+		"script":  &CommandNotifier{Command: []string{"notify.sh", "--urgent"}},
+		"desktop": &DesktopNotifier{},
+		"boss":    &MailNotifier{Host: "smtp.example.com", Port: 3025, From: "foo@example.com", To: "boss@example.com"},
+	}, notifiers)
+}
+
+func TestNewFromConfig_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"notifiers:\n  x:\n    type: pigeon\n    url: http://x":        "notifier x: unknown type pigeon, must be one of webhook, ntfy, gotify, slack, matrix, command, desktop, mail",
+		"notifiers:\n  x:\n    type: slack":                            "notifier x: url must be set",
+		"notifiers:\n  x:\n    type: gotify\n    url: http://x":        "notifier x: token must be set",
+		"notifiers:\n  x:\n    type: command":                          "notifier x: command must be set",
+		"notifiers:\n  mail:\n    type: desktop":                       "notifier name mail is reserved for the mail* config",
+		"notifiers:\n  x:\n    type: mail":                             "notifier x: to must be set",
+		"notifiers:\n  x:\n    type: mail\n    to: a@b.c":              "notifier x: mailHost must be set",
+		"notifiers:\n  x:\n    type: desktop\n    quiet_hours: 7h":     "notifier x: invalid quiet_hours 7h, must be like 22:00-07:00",
+		"notifiers:\n  x:\n    type: desktop\n    working_days: [mon]": "notifier x: quiet_hours and working_days need todoFile to be set",
+		"notifiers:\n  mail:\n    working_days: [mon]":                 "notifier name mail is reserved for the mail* config",
+	}
+	for cfgStr, expected := range cases {
+		cfg, _ := util.LoadConfigString(cfgStr)
+		_, err := NewFromConfig(cfg)
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	srv, reqs := startStandIn(http.StatusOK)
+	defer srv.Close()
+	failing, _ := startStandIn(http.StatusBadGateway)
+	defer failing.Close()
+	notifiers := map[string]Notifier{
+		"hook":    &WebhookNotifier{URL: srv.URL + "/hook"},
+		"chat":    &SlackNotifier{URL: srv.URL + "/chat"},
+		"failing": &SlackNotifier{URL: failing.URL},
+	}
+
+	n, err := Route(notifiers, []string{"failing", "hook", "chat"})
+	assert.NoError(t, err)
+	err = n.Notify(testMessage)
+
+	assert.EqualError(t, err, "failing: request returned HTTP 502")
+	assert.Equal(t, 2, len(*reqs), "sends to the other notifiers anyway")
+	assert.Equal(t, "/hook", (*reqs)[0].path)
+	assert.Equal(t, "/chat", (*reqs)[1].path)
+
+	n, err = Route(notifiers, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, n)
+
+	_, err = Route(notifiers, []string{"pager"})
+	assert.EqualError(t, err, "unknown notifier pager, must be one of chat, failing, hook")
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Outbox persists the messages held back by Deferring notifiers in a file, so they are not lost on restarts.
+type Outbox struct {
+	path string
+	mu   sync.Mutex
+}
+
+type outboxEntry struct {
+	Notifier string   `json:"notifier"`
+	Message  *Message `json:"message"`
+}
+
+// NewOutbox creates an Outbox persisted in the file at path.
+func NewOutbox(path string) *Outbox {
+	return &Outbox{path: path}
+}
+
+// Add holds back the message for the named notifier.
+func (o *Outbox) Add(notifier string, msg *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entries, err := o.load()
+	if err != nil {
+		return err
+	}
+	log.Infof("Holding back %s for %s\n", msg.Title, notifier)
+	return o.save(append(entries, &outboxEntry{Notifier: notifier, Message: msg}))
+}
+
+// Flush sends the messages held back for the named notifier with send, if deliver is true. Messages that
+// failed to send are kept, expired ones are dropped.
+func (o *Outbox) Flush(notifier string, now time.Time, deliver bool, send func(*Message) error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entries, err := o.load()
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	var kept []*outboxEntry
+	for _, e := range entries {
+		switch {
+		case e.Notifier != notifier:
+			kept = append(kept, e)
+		case !e.Message.Expires.IsZero() && !now.Before(e.Message.Expires):
+			log.Infof("Dropping expired %s for %s\n", e.Message.Title, notifier)
+		case !deliver:
+			kept = append(kept, e)
+		default:
+			err = send(e.Message)
+			if err != nil {
+				kept = append(kept, e)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	if len(kept) == len(entries) {
+		return firstErr
+	}
+	err = o.save(kept)
+	if firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+func (o *Outbox) load() ([]*outboxEntry, error) {
+	content, err := util.ReadFile(o.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*outboxEntry
+	err = json.Unmarshal([]byte(content), &entries)
+	if err != nil {
+		return nil, fmt.Errorf("could not read notification outbox %s: %s", o.path, err)
+	}
+	return entries, nil
+}
+
+// save replaces the file atomically, or removes it if there are no entries left.
+func (o *Outbox) save(entries []*outboxEntry) error {
+	if len(entries) == 0 {
+		err := os.Remove(o.path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := o.path + ".tmp"
+	err = os.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path)
+}
@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/util"
+)
+
+var getNow = func() time.Time {
+	return time.Now()
+}
+
+var quietHoursPattern = regexp.MustCompile(`^(\d{1,2}):(\d{2})\s*-\s*(\d{1,2}):(\d{2})$`)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// DeliveryWindow restricts when a notifier delivers messages: not during the quiet hours and only on working days.
+type DeliveryWindow struct {
+	// QuietFrom and QuietTo are the start and end of the quiet hours as offsets into the day.
+	// QuietTo is before QuietFrom if the quiet hours span midnight. Equal means no quiet hours.
+	QuietFrom time.Duration
+	QuietTo   time.Duration
+	// WorkingDays are the days messages are delivered on. Empty means every day.
+	WorkingDays map[time.Weekday]bool
+}
+
+// ParseDeliveryWindow parses quiet hours like "22:00-07:00" and working days like ["mon-fri", "sun"].
+// Both can be empty.
+func ParseDeliveryWindow(quietHours string, workingDays []string) (*DeliveryWindow, error) {
+	w := &DeliveryWindow{WorkingDays: make(map[time.Weekday]bool)}
+	if quietHours != "" {
+		m := quietHoursPattern.FindStringSubmatch(strings.TrimSpace(quietHours))
+		if m == nil {
+			return nil, fmt.Errorf("invalid quiet_hours %s, must be like 22:00-07:00", quietHours)
+		}
+		var err error
+		w.QuietFrom, err = parseTimeOfDay(m[1], m[2])
+		if err == nil {
+			w.QuietTo, err = parseTimeOfDay(m[3], m[4])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet_hours %s: %s", quietHours, err)
+		}
+	}
+	for _, d := range workingDays {
+		from, to, err := parseWeekdayRange(d)
+		if err != nil {
+			return nil, err
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			w.WorkingDays[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+func parseTimeOfDay(hours string, minutes string) (time.Duration, error) {
+	var h, m int
+	fmt.Sscan(hours, &h)
+	fmt.Sscan(minutes, &m)
+	if h > 24 || m > 59 || (h == 24 && m > 0) {
+		return 0, fmt.Errorf("%s:%s is not a time of day", hours, minutes)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// parseWeekdayRange parses a day like "mon" or "Monday", or a range like "mon-fri".
+func parseWeekdayRange(s string) (time.Weekday, time.Weekday, error) {
+	parts := strings.SplitN(s, "-", 2)
+	from, err := parseWeekday(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(parts) == 1 {
+		return from, from, nil
+	}
+	to, err := parseWeekday(parts[1])
+	return from, to, err
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i := range weekdayNames {
+		if len(s) >= 3 && strings.HasPrefix(strings.ToLower(time.Weekday(i).String()), s) {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid working day %s, must be one of %s", s, strings.Join(weekdayNames, ", "))
+}
+
+// Allows returns true if messages can be delivered at t.
+func (w *DeliveryWindow) Allows(t time.Time) bool {
+	if len(w.WorkingDays) > 0 && !w.WorkingDays[t.Weekday()] {
+		return false
+	}
+	offset := t.Sub(util.SetToStartOfDay(t))
+	switch {
+	case w.QuietFrom < w.QuietTo:
+		return offset < w.QuietFrom || offset >= w.QuietTo
+	case w.QuietFrom > w.QuietTo:
+		return offset < w.QuietFrom && offset >= w.QuietTo
+	}
+	return true
+}
+
+// Flusher is implemented by notifiers that hold back messages, see Deferring.
+type Flusher interface {
+	// Flush delivers the held back messages that can be delivered now.
+	Flush() error
+}
+
+// Flush delivers the held back messages of n, if it holds back any.
+func Flush(n Notifier) error {
+	f, ok := n.(Flusher)
+	if !ok {
+		return nil
+	}
+	return f.Flush()
+}
+
+// Deferring holds back the messages outside of its Window in the Outbox, until Flush is called during
+// the window. Critical messages are delivered right away.
+type Deferring struct {
+	Name     string
+	Notifier Notifier
+	Window   *DeliveryWindow
+	Outbox   *Outbox
+}
+
+// Notify delivers the message, or holds it back outside of the window.
+func (d *Deferring) Notify(msg *Message) error {
+	if msg.Critical || d.Window.Allows(getNow()) {
+		return d.Notifier.Notify(msg)
+	}
+	return d.Outbox.Add(d.Name, msg)
+}
+
+// Flush delivers the held back messages if the window allows it. Expired messages are dropped.
+func (d *Deferring) Flush() error {
+	now := getNow()
+	return d.Outbox.Flush(d.Name, now, d.Window.Allows(now), d.Notifier.Notify)
+}
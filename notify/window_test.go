@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+var testOutboxFile = filepath.Join(os.TempDir(), "notify_test_outbox.json")
+
+type recorder struct {
+	titles []string
+	err    error
+}
+
+func (r *recorder) Notify(msg *Message) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.titles = append(r.titles, msg.Title)
+	return nil
+}
+
+func TestDeliveryWindow(t *testing.T) {
+	w, err := ParseDeliveryWindow("22:00-07:30", []string{"mon-fri"})
+	assert.NoError(t, err)
+
+	assert.True(t, w.Allows(tu.Dtt("04.01.2019 07:30")), "Friday morning")
+	assert.True(t, w.Allows(tu.Dtt("04.01.2019 21:59")))
+	assert.False(t, w.Allows(tu.Dtt("04.01.2019 22:00")))
+	assert.False(t, w.Allows(tu.Dtt("04.01.2019 03:00")))
+	assert.False(t, w.Allows(tu.Dtt("05.01.2019 12:00")), "Saturday")
+
+	w, _ = ParseDeliveryWindow("12:00-13:00", []string{"sat", "Sunday"})
+	assert.False(t, w.Allows(tu.Dtt("05.01.2019 12:30")))
+	assert.True(t, w.Allows(tu.Dtt("06.01.2019 13:00")))
+	assert.False(t, w.Allows(tu.Dtt("07.01.2019 09:00")), "Monday")
+
+	w, _ = ParseDeliveryWindow("", []string{"fri-mon"})
+	assert.True(t, w.Allows(tu.Dtt("06.01.2019 03:00")), "ranges wrap around the week")
+	assert.False(t, w.Allows(tu.Dtt("08.01.2019 03:00")))
+}
+
+func TestParseDeliveryWindow_Invalid(t *testing.T) {
+	_, err := ParseDeliveryWindow("22-07", nil)
+	assert.EqualError(t, err, "invalid quiet_hours 22-07, must be like 22:00-07:00")
+	_, err = ParseDeliveryWindow("22:00-25:00", nil)
+	assert.EqualError(t, err, "invalid quiet_hours 22:00-25:00: 25:00 is not a time of day")
+	_, err = ParseDeliveryWindow("", []string{"mo-fr"})
+	assert.EqualError(t, err, "invalid working day mo, must be one of sun, mon, tue, wed, thu, fri, sat")
+}
+
+func TestDeferring(t *testing.T) {
+	defer os.Remove(testOutboxFile)
+	defer func() { getNow = time.Now }()
+	rec := &recorder{}
+	w, _ := ParseDeliveryWindow("22:00-07:00", nil)
+	d := &Deferring{Name: "phone", Notifier: rec, Window: w, Outbox: NewOutbox(testOutboxFile)}
+
+	getNow = func() time.Time { return tu.Dtt("04.01.2019 23:00") }
+	assert.NoError(t, d.Notify(&Message{Title: "digest"}))
+	assert.NoError(t, d.Notify(&Message{Title: "timed", Expires: tu.Dtt("05.01.2019 06:00")}))
+	assert.NoError(t, d.Notify(&Message{Title: "urgent", Critical: true}))
+	assert.NoError(t, d.Flush())
+	assert.Equal(t, []string{"urgent"}, rec.titles)
+
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 07:00") }
+	rec.err = fmt.Errorf("offline")
+	assert.EqualError(t, d.Flush(), "offline")
+	rec.err = nil
+	assert.NoError(t, d.Flush())
+	assert.NoError(t, d.Flush())
+
+	assert.Equal(t, []string{"urgent", "digest"}, rec.titles, "expired message dropped")
+	assert.False(t, util.Exists(testOutboxFile))
+}
+
+func TestOutbox_KeepsOtherNotifiers(t *testing.T) {
+	defer os.Remove(testOutboxFile)
+	o := NewOutbox(testOutboxFile)
+	o.Add("phone", &Message{Title: "a"})
+	o.Add("mail", &Message{Title: "b"})
+
+	rec := &recorder{}
+	err := NewOutbox(testOutboxFile).Flush("mail", tu.Dt("05.01.2019"), true, rec.Notify)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, rec.titles)
+	content, _ := util.ReadFile(testOutboxFile)
+	tu.AssertContains(t, `"notifier": "phone"`, content)
+}
+
+func TestNewFromConfig_Window(t *testing.T) {
+	cfg, _ := util.LoadConfigString(`
+todoFile: /tmp/todo.txt
+mailHost: smtp.example.com
+mailPort: 3025
+mailFrom: foo@example.com
+mailTo: bar@example.com
+notifiers:
+  mail:
+    working_days: [mon-fri]
+  phone:
+    type: ntfy
+    url: https://ntfy.sh/my-todos
+    quiet_hours: 22:00-07:00
+  desktop:
+    type: desktop
+`)
+
+	notifiers, err := NewFromConfig(cfg)
+
+	assert.NoError(t, err)
+	outbox := NewOutbox("/tmp/todo-outbox.json")
+	assert.Equal(t, &Deferring{Name: "mail", Notifier: NewMailNotifierFromConfig(cfg), Outbox: outbox,
+		Window: &DeliveryWindow{WorkingDays: map[time.Weekday]bool{1: true, 2: true, 3: true, 4: true, 5: true}}},
+		notifiers["mail"])
+	assert.Equal(t, &Deferring{Name: "phone", Notifier: &NtfyNotifier{URL: "https://ntfy.sh/my-todos"}, Outbox: outbox,
+		Window: &DeliveryWindow{QuietFrom: 22 * time.Hour, QuietTo: 7 * time.Hour, WorkingDays: map[time.Weekday]bool{}}},
+		notifiers["phone"])
+	assert.Equal(t, &DesktopNotifier{}, notifiers["desktop"])
+}
@@ -11,41 +11,35 @@ import (
 	"time"
 )
 
-// CheckInfinitely repeatedly checks for changes in the todo file and updates
-// Outlook events.
-func CheckInfinitely(todoFile string, interval time.Duration) {
-	lastMod := time.Unix(0, 0)
-	for {
-		CheckOnce(todoFile, &lastMod)
-		time.Sleep(interval)
-	}
-}
-
 // CheckOnce checks for changes in the todo file and updates
-// Outlook events.
-func CheckOnce(todoFile string, lastMod *time.Time) {
+// Outlook events. onParse, if set, is called after parsing the todo file.
+func CheckOnce(todoFile string, lastMod *time.Time, onParse func(path string, err error)) error {
 	file, err := os.Stat(todoFile)
 	if err != nil {
 		log.Errorf("Could not stat %s: %s\n", todoFile, err)
-		return
+		return err
 	}
 
 	newLastMod := file.ModTime()
 	if newLastMod == *lastMod {
-		return
+		return nil
 	}
 
 	*lastMod = newLastMod
 	todos, err := parse.File(todoFile)
+	if onParse != nil {
+		onParse(todoFile, err)
+	}
 	if err != nil {
 		log.Errorf("Could not read todo file %s: %s\n", todoFile, err)
-		return
+		return err
 	}
 
 	err = UpdateOutlookEvents(todos.Moments)
 	if err != nil {
 		log.Errorf("Had one or more errors updating outlook events: %s\n", err)
 	}
+	return err
 }
 
 // UpdateOutlookEvents syncs single moments with specific date to Outlook as events.
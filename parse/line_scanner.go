@@ -6,6 +6,8 @@ import (
 	"os"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/sandro-h/sibylgo/moment"
 )
 
 // LineScanner reads content line-by-line and allows undoing a single line read
@@ -103,6 +105,12 @@ func (s *LineScanner) Err() error {
 	return s.scanner.Err()
 }
 
+// ErrCoords returns the coordinates of the line at which the error returned by Err() occurred.
+// The length is always 0, since the line could not be read.
+func (s *LineScanner) ErrCoords() moment.DocCoords {
+	return moment.DocCoords{LineNumber: s.lineNumber - 1, Offset: s.offset}
+}
+
 func (s *LineScanner) updateNextLine() {
 	s.lineNumber++
 	s.lastOffset = s.offset
@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -15,6 +16,22 @@ type parserState struct {
 	scanner     *LineScanner
 }
 
+// Error is returned if the content could not be read completely. DocCoords points to the line
+// at which reading failed.
+type Error struct {
+	DocCoords moment.DocCoords
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.DocCoords.LineNumber+1, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // File parses a text file into a Todos object.
 func File(path string) (*moment.Todos, error) {
 	file, err := os.Open(path)
@@ -47,7 +64,7 @@ func parse(scanner *LineScanner) (*moment.Todos, error) {
 	}
 
 	if err := parserState.scanner.Err(); err != nil {
-		return nil, err
+		return nil, &Error{DocCoords: parserState.scanner.ErrCoords(), Err: err}
 	}
 
 	return parserState.todos, nil
@@ -10,8 +10,10 @@ import (
 // and none of the sub moments or comments appear on subsequent lines.
 func parseMoment(line *Line, lineVal string) moment.Moment {
 	id, lineVal := parseID(line, lineVal)
+	leads, lineVal := parseReminders(lineVal)
 	mom, lineVal := parseBaseMoment(line, lineVal)
 	mom.SetID(id)
+	mom.SetReminders(leads)
 
 	state, lineVal := parseStateMark(line, lineVal)
 	if state == nil {
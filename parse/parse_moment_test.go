@@ -2,6 +2,7 @@ package parse
 
 import (
 	"testing"
+	"time"
 
 	"github.com/sandro-h/sibylgo/moment"
 	"github.com/stretchr/testify/assert"
@@ -369,6 +370,78 @@ func TestDifferentBrackets(t *testing.T) {
 	assert.Equal(t, "blabla", mom.GetName())
 }
 
+func TestReminderTokens(t *testing.T) {
+	mom := parseSingleMom("[] call bob remind:1h remind:2d (24.12.2015 13:15)")
+
+	assert.Equal(t, "call bob", mom.GetName())
+	assert.Equal(t, []time.Duration{time.Hour, 48 * time.Hour}, mom.GetReminders())
+	assert.Equal(t, "24.12.2015 00:00", dateStr(mom.Start))
+	assert.Equal(t, "13:15:00", timeStr(mom.TimeOfDay))
+	assert.Equal(t, 44, mom.TimeOfDay.Offset)
+}
+
+func TestReminderInDateSuffix(t *testing.T) {
+	mom := parseSingleMom("[] blabla (24.12.2015 13:15 !remind 30m !remind 1h30m) #abc")
+
+	assert.Equal(t, "blabla", mom.GetName())
+	assert.Equal(t, "abc", mom.GetID().Value)
+	assert.Equal(t, []time.Duration{30 * time.Minute, 90 * time.Minute}, mom.GetReminders())
+	assert.Equal(t, "13:15:00", timeStr(mom.TimeOfDay))
+	assert.Equal(t, 22, mom.TimeOfDay.Offset)
+	assert.Equal(t, 5, mom.TimeOfDay.Length)
+}
+
+func TestReminderInRecurrence(t *testing.T) {
+	mom := parseMom("[] standup (every day 9:00 !remind 10m)")
+
+	assert.IsType(t, &moment.RecurMoment{}, mom)
+	assert.Equal(t, "standup", mom.GetName())
+	assert.Equal(t, []time.Duration{10 * time.Minute}, mom.GetReminders())
+}
+
+func TestReminderOnlySuffix(t *testing.T) {
+	mom := parseSingleMom("[] blabla (!remind 1w)")
+
+	assert.Equal(t, "blabla", mom.GetName())
+	assert.Nil(t, mom.Start)
+	assert.Equal(t, []time.Duration{7 * 24 * time.Hour}, mom.GetReminders())
+}
+
+func TestReminderInvalidLeadTime(t *testing.T) {
+	mom := parseSingleMom("[] blabla remind:soon (24.12.2015 !remind 3y)")
+
+	assert.Equal(t, "blabla remind:soon (24.12.2015 !remind 3y)", mom.GetName())
+	assert.Nil(t, mom.GetReminders())
+}
+
+func TestReminderTooLongLeadTime(t *testing.T) {
+	mom := parseSingleMom("[] blabla remind:53w (24.12.2015 !remind 999999999999w)")
+
+	assert.Equal(t, "blabla remind:53w (24.12.2015 !remind 999999999999w)", mom.GetName())
+	assert.Nil(t, mom.GetReminders())
+}
+
+func TestParseLeadTime(t *testing.T) {
+	cases := map[string]time.Duration{
+		"15m":   15 * time.Minute,
+		"2h":    2 * time.Hour,
+		"1d12h": 36 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"52w":   52 * 7 * 24 * time.Hour,
+		"51w7d": 52 * 7 * 24 * time.Hour,
+	}
+	for s, expected := range cases {
+		lead, ok := ParseLeadTime(s)
+		assert.True(t, ok, s)
+		assert.Equal(t, expected, lead, s)
+	}
+	for _, s := range []string{"", "h", "1x", "1h 2m", "-1h", "1.5h", "53w", "52w1m", "365d",
+		"999999999999w", "99999999999999999999m", "9223372036854775807m"} {
+		_, ok := ParseLeadTime(s)
+		assert.False(t, ok, s)
+	}
+}
+
 func dateStr(dt *moment.Date) string {
 	if dt == nil {
 		return "nil"
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var remindTokenPattern = regexp.MustCompile(`\s+remind:(\S+)`)
+var remindSuffixPattern = regexp.MustCompile(`\s*!remind\s+(\S+)`)
+var leadTimePartPattern = regexp.MustCompile(`(\d+)([wdhm])`)
+
+// maxLeadTime is the longest lead time. Longer ones are invalid, which also keeps them from overflowing.
+const maxLeadTime = 52 * 7 * 24 * time.Hour
+
+var leadTimeUnits = map[string]time.Duration{
+	"w": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+}
+
+// expected lineVal: .* remind:<lead>.* (.* !remind <lead>)
+// Both forms can appear several times. Tokens with an invalid lead time are left as they are.
+func parseReminders(lineVal string) ([]time.Duration, string) {
+	var leads []time.Duration
+	collect := func(pattern *regexp.Regexp, s string) string {
+		return pattern.ReplaceAllStringFunc(s, func(match string) string {
+			lead, ok := ParseLeadTime(pattern.FindStringSubmatch(match)[1])
+			if !ok {
+				return match
+			}
+			leads = append(leads, lead)
+			return ""
+		})
+	}
+
+	// Inside the date suffix. Removing the marks only shifts text after them, so the doc coords of the
+	// date and time are unaffected as long as the marks come last.
+	if strings.HasSuffix(lineVal, ")") {
+		if p := strings.LastIndex(lineVal, "("); p >= 0 {
+			inner := strings.TrimRight(collect(remindSuffixPattern, lineVal[p+1:len(lineVal)-1]), " \t")
+			if len(leads) > 0 && strings.TrimSpace(inner) == "" {
+				// The suffix only had reminders, e.g. (!remind 1h)
+				lineVal = strings.TrimSpace(lineVal[:p])
+			} else if len(leads) > 0 {
+				lineVal = lineVal[:p+1] + inner + ")"
+			}
+		}
+	}
+	lineVal = collect(remindTokenPattern, lineVal)
+	return leads, lineVal
+}
+
+// ParseLeadTime parses a reminder lead time such as 30m, 1h, 2d, 1w or 1h30m, up to 52w.
+func ParseLeadTime(s string) (time.Duration, bool) {
+	parts := leadTimePartPattern.FindAllStringSubmatch(s, -1)
+	var lead time.Duration
+	matched := 0
+	for _, p := range parts {
+		n, err := strconv.Atoi(p[1])
+		unit := leadTimeUnits[p[2]]
+		if err != nil || time.Duration(n) > (maxLeadTime-lead)/unit {
+			return 0, false
+		}
+		lead += time.Duration(n) * unit
+		matched += len(p[0])
+	}
+	if len(parts) == 0 || matched != len(s) {
+		return 0, false
+	}
+	return lead, true
+}
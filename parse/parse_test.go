@@ -1,6 +1,8 @@
 package parse
 
 import (
+	"encoding/base64"
+	"errors"
 	"strings"
 	"testing"
 
@@ -310,3 +312,16 @@ func navigateToMoment(moms []moment.Moment, parts *[]string, index int) moment.M
 	}
 	return nil
 }
+
+func TestReadErrorHasDocCoords(t *testing.T) {
+	// "[] 1\n[] 2\n" followed by invalid base64
+	reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader("W10gMQpbXSAyCg==!!!!"))
+
+	_, err := Reader(reader)
+
+	var parseErr *Error
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, 2, parseErr.DocCoords.LineNumber)
+	assert.Equal(t, 10, parseErr.DocCoords.Offset)
+	assert.Equal(t, "line 3: illegal base64 data at input byte 16", err.Error())
+}
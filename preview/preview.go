@@ -6,6 +6,7 @@ import (
 	"github.com/sandro-h/sibylgo/calendar"
 	"github.com/sandro-h/sibylgo/instances"
 	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/query"
 	"github.com/sandro-h/sibylgo/reminder"
 	"github.com/sandro-h/sibylgo/util"
 )
@@ -18,8 +19,9 @@ var getNow = func() time.Time {
 // * Moments due today / due this week
 // * All top-level moments by category
 // * Week's calendar
+// * Saved views, i.e. the moments matching a query
 // The preview is displayed as HTML in the VSCode extension.
-func Create(todos *moment.Todos) Preview {
+func Create(todos *moment.Todos, views ...View) Preview {
 	now := getNow()
 
 	overview := compileTopLevelMomentsOverview(todos)
@@ -30,7 +32,26 @@ func Create(todos *moment.Todos) Preview {
 		Today:    todays,
 		Week:     weeks,
 		Overview: overview,
-		Calendar: entries}
+		Calendar: entries,
+		Views:    compileViews(todos, views, now)}
+}
+
+// View is a saved query whose matching moments are shown in the preview.
+type View struct {
+	Name  string
+	Query *query.Query
+}
+
+func compileViews(todos *moment.Todos, views []View, now time.Time) []jsonView {
+	var res []jsonView
+	for _, v := range views {
+		jv := jsonView{Name: v.Name, Query: v.Query.Raw, Moments: make([]jsonMoment, 0)}
+		for _, r := range query.Search(todos, v.Query, now) {
+			jv.Moments = append(jv.Moments, toJSONMoment(r.Moment))
+		}
+		res = append(res, jv)
+	}
+	return res
 }
 
 func compileTopLevelMomentsOverview(todos *moment.Todos) jsonTodos {
@@ -79,6 +100,7 @@ type Preview struct {
 	Week     []*instances.Instance `json:"week"`
 	Overview jsonTodos             `json:"overview"`
 	Calendar []calendar.Entry      `json:"calendar"`
+	Views    []jsonView            `json:"views,omitempty"`
 }
 
 type jsonTodos struct {
@@ -90,6 +112,12 @@ type jsonCategory struct {
 	Moments []jsonMoment `json:"moments"`
 }
 
+type jsonView struct {
+	Name    string       `json:"name"`
+	Query   string       `json:"query"`
+	Moments []jsonMoment `json:"moments"`
+}
+
 type jsonMoment struct {
 	Name      string           `json:"name"`
 	WorkState moment.WorkState `json:"workState"`
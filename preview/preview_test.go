@@ -6,7 +6,9 @@ import (
 
 	"github.com/sandro-h/sibylgo/instances"
 	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/query"
 	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCompileOverview(t *testing.T) {
@@ -47,3 +49,23 @@ func (i *NormalizedTimeInst) MarshalJSON() ([]byte, error) {
 		End:   i.End.Format("2006-01-02 15:04:05"),
 	})
 }
+
+func TestCompileViews(t *testing.T) {
+	todos, _ := parse.String(`
+[] call boss @phone
+[x] call mom @phone
+[] buy milk
+	[] call the shop @phone
+`)
+	q, _ := query.Parse("state:open @phone")
+
+	views := compileViews(todos, []View{{Name: "Phone calls", Query: q}}, tu.Dt("17.04.2021"))
+
+	assert.Len(t, views, 1)
+	assert.Equal(t, "Phone calls", views[0].Name)
+	assert.Equal(t, "state:open @phone", views[0].Query)
+	assert.Len(t, views[0].Moments, 2)
+	assert.Equal(t, "call boss @phone", views[0].Moments[0].Name)
+	assert.Equal(t, "call the shop @phone", views[0].Moments[1].Name)
+	assert.Equal(t, 4, views[0].Moments[1].DocCoords.LineNumber)
+}
@@ -0,0 +1,335 @@
+// Package query implements a small filter language for moments, e.g.
+//
+//	state:open cat:Work prio>=1 due<=7d text:"release" @phone
+//
+// All terms must match. A term prefixed with - is negated.
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sandro-h/sibylgo/instances"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// recurLookahead is how far ahead the next occurrence of a recurring moment is searched.
+const recurLookahead = 400
+
+// SyntaxError is returned if a query cannot be parsed. Pos is the byte offset of the invalid term.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// Query is a parsed query.
+type Query struct {
+	Raw   string
+	terms []term
+}
+
+type term struct {
+	negate bool
+	match  func(c *context) bool
+}
+
+// context holds the moment being matched and lazily computed properties.
+type context struct {
+	mom      moment.Moment
+	today    time.Time
+	due      *time.Time
+	dueKnown bool
+}
+
+// Parse parses the query string. An empty query matches everything.
+func Parse(q string) (*Query, error) {
+	tokens, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+	query := &Query{Raw: q}
+	for _, t := range tokens {
+		term, err := parseTerm(t)
+		if err != nil {
+			return nil, err
+		}
+		query.terms = append(query.terms, term)
+	}
+	return query, nil
+}
+
+// Matches returns true if the moment matches all terms of the query. today is used to
+// evaluate relative dates like due<7d.
+func (q *Query) Matches(mom moment.Moment, today time.Time) bool {
+	return q.matches(newContext(mom, today))
+}
+
+func newContext(mom moment.Moment, today time.Time) *context {
+	return &context{mom: mom, today: util.SetToStartOfDay(today)}
+}
+
+func (q *Query) matches(c *context) bool {
+	for _, t := range q.terms {
+		if t.match(c) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+type token struct {
+	pos   int
+	text  string
+	value string
+}
+
+// tokenize splits the query at whitespace. Double quotes group text containing whitespace,
+// e.g. text:"foo bar". The value of a token is its text with the quotes removed.
+func tokenize(q string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(q) {
+		if unicode.IsSpace(rune(q[i])) {
+			i++
+			continue
+		}
+		start := i
+		var value strings.Builder
+		for i < len(q) && !unicode.IsSpace(rune(q[i])) {
+			if q[i] == '"' {
+				end := strings.IndexByte(q[i+1:], '"')
+				if end < 0 {
+					return nil, &SyntaxError{Pos: i, Msg: "unterminated quote"}
+				}
+				value.WriteString(q[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				value.WriteByte(q[i])
+				i++
+			}
+		}
+		tokens = append(tokens, token{pos: start, text: q[start:i], value: value.String()})
+	}
+	return tokens, nil
+}
+
+var termPattern = regexp.MustCompile(`^([a-z]+)(:|>=|<=|>|<|=)(.*)$`)
+
+func parseTerm(t token) (term, error) {
+	res := term{}
+	value := t.value
+	if strings.HasPrefix(value, "-") && len(value) > 1 {
+		res.negate = true
+		value = value[1:]
+	}
+
+	if strings.HasPrefix(value, "@") {
+		res.match = tagMatcher(value[1:])
+		return res, nil
+	}
+
+	m := termPattern.FindStringSubmatch(value)
+	if m == nil {
+		res.match = textMatcher(value)
+		return res, nil
+	}
+
+	key, op, arg := m[1], m[2], m[3]
+	var err error
+	switch key {
+	case "state":
+		res.match, err = stateMatcher(op, arg)
+	case "cat", "category":
+		res.match, err = categoryMatcher(op, arg)
+	case "prio", "priority":
+		res.match, err = prioMatcher(op, arg)
+	case "due":
+		res.match, err = dueMatcher(op, arg)
+	case "text":
+		res.match, err = equalityOnly(op, textMatcher(arg))
+	case "tag":
+		res.match, err = equalityOnly(op, tagMatcher(arg))
+	case "id":
+		res.match, err = equalityOnly(op, idMatcher(arg))
+	default:
+		err = fmt.Errorf("unknown key %s", key)
+	}
+	if err != nil {
+		return res, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid term %s: %s", t.text, err)}
+	}
+	return res, nil
+}
+
+func equalityOnly(op string, match func(c *context) bool) (func(c *context) bool, error) {
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("only : is supported")
+	}
+	return match, nil
+}
+
+func stateMatcher(op string, arg string) (func(c *context) bool, error) {
+	var match func(c *context) bool
+	switch strings.ToLower(arg) {
+	case "open":
+		match = func(c *context) bool { return !c.mom.IsDone() }
+	case "done":
+		match = func(c *context) bool { return c.mom.IsDone() }
+	case "new":
+		match = func(c *context) bool { return c.mom.GetWorkState() == moment.NewState }
+	case "waiting":
+		match = func(c *context) bool { return c.mom.GetWorkState() == moment.WaitingState }
+	case "inprogress", "progress":
+		match = func(c *context) bool { return c.mom.GetWorkState() == moment.InProgressState }
+	default:
+		return nil, fmt.Errorf("state must be one of open, done, new, waiting, inprogress")
+	}
+	return equalityOnly(op, match)
+}
+
+func categoryMatcher(op string, arg string) (func(c *context) bool, error) {
+	return equalityOnly(op, func(c *context) bool {
+		if c.mom.GetCategory() == nil {
+			return strings.EqualFold(arg, "none")
+		}
+		return strings.EqualFold(c.mom.GetCategory().Name, arg)
+	})
+}
+
+func prioMatcher(op string, arg string) (func(c *context) bool, error) {
+	prio, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("priority must be a number")
+	}
+	return func(c *context) bool {
+		return compare(c.mom.GetPriority()-prio, op)
+	}, nil
+}
+
+func dueMatcher(op string, arg string) (func(c *context) bool, error) {
+	offset, abs, err := parseDay(arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *context) bool {
+		due := c.dueDate()
+		if due == nil {
+			return false
+		}
+		target := c.today.AddDate(0, 0, offset)
+		if abs != nil {
+			target = *abs
+		}
+		// Round, since days are not 24h long across daylight saving time changes.
+		days := math.Round(util.SetToStartOfDay(*due).Sub(target).Hours() / 24)
+		return compare(int(days), op)
+	}, nil
+}
+
+// parseDay parses today, tomorrow, yesterday, a relative number of days (7d) or weeks (2w),
+// or an absolute date (2019-01-31).
+func parseDay(arg string) (int, *time.Time, error) {
+	switch strings.ToLower(arg) {
+	case "today":
+		return 0, nil, nil
+	case "tomorrow":
+		return 1, nil, nil
+	case "yesterday":
+		return -1, nil, nil
+	}
+	if len(arg) > 1 && (strings.HasSuffix(arg, "d") || strings.HasSuffix(arg, "w")) {
+		n, err := strconv.Atoi(arg[:len(arg)-1])
+		if err == nil {
+			if strings.HasSuffix(arg, "w") {
+				n *= 7
+			}
+			return n, nil, nil
+		}
+	}
+	date, err := util.ParseISODate(arg)
+	if err != nil {
+		return 0, nil, fmt.Errorf("date must be today, tomorrow, yesterday, <n>d, <n>w or yyyy-mm-dd")
+	}
+	return 0, &date, nil
+}
+
+func compare(diff int, op string) bool {
+	switch op {
+	case ">":
+		return diff > 0
+	case ">=":
+		return diff >= 0
+	case "<":
+		return diff < 0
+	case "<=":
+		return diff <= 0
+	default:
+		return diff == 0
+	}
+}
+
+func textMatcher(text string) func(c *context) bool {
+	lower := strings.ToLower(text)
+	return func(c *context) bool {
+		if strings.Contains(strings.ToLower(c.mom.GetName()), lower) {
+			return true
+		}
+		for _, com := range c.mom.GetComments() {
+			if strings.Contains(strings.ToLower(com.Content), lower) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func tagMatcher(tag string) func(c *context) bool {
+	pattern := regexp.MustCompile(`(?i)(^|\s)@` + regexp.QuoteMeta(tag) + `(\s|$)`)
+	return func(c *context) bool {
+		if pattern.MatchString(c.mom.GetName()) {
+			return true
+		}
+		for _, com := range c.mom.GetComments() {
+			if pattern.MatchString(com.Content) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func idMatcher(id string) func(c *context) bool {
+	return func(c *context) bool {
+		return c.mom.GetID() != nil && c.mom.GetID().Value == id
+	}
+}
+
+// dueDate returns the end date of single moments and the next occurrence (from today) of
+// recurring moments, or nil if the moment has no date.
+func (c *context) dueDate() *time.Time {
+	if c.dueKnown {
+		return c.due
+	}
+	c.dueKnown = true
+	switch m := c.mom.(type) {
+	case *moment.SingleMoment:
+		if m.End != nil {
+			c.due = &m.End.Time
+		}
+	case *moment.RecurMoment:
+		insts := instances.GenerateWithoutSubs(m, c.today, c.today.AddDate(0, 0, recurLookahead))
+		if len(insts) > 0 {
+			c.due = &insts[0].Start
+		}
+	}
+	return c.due
+}
@@ -0,0 +1,93 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/sandro-h/sibylgo/parse"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const todoContent = `
+------------------
+ Work
+------------------
+[] call boss @phone (5.1.19)
+[p] release v2! (-10.1.19)
+	remember the changelog
+	[] write release notes (8.1.19)
+[x] old release (1.1.19)
+[w] waiting for review #rev1
+[] standup (every day)
+------------------
+ Home
+------------------
+[] buy milk!! (4.1.19)
+[] call mom @phone
+`
+
+func TestQueries(t *testing.T) {
+	cases := map[string][]string{
+		"":                                    {"call boss @phone", "release v2", "release v2/write release notes", "old release", "waiting for review", "standup", "buy milk", "call mom @phone"},
+		"state:open cat:Work prio>=1 due<=7d": {"release v2"},
+		"state:done":                          {"old release"},
+		"state:inprogress":                    {"release v2"},
+		"state:waiting":                       {"waiting for review"},
+		"-state:open":                         {"old release"},
+		"cat:home":                            {"buy milk", "call mom @phone"},
+		"prio:2":                              {"buy milk"},
+		"prio>0 -prio>1":                      {"release v2"},
+		"@phone":                              {"call boss @phone", "call mom @phone"},
+		"tag:phone cat:Work":                  {"call boss @phone"},
+		"@pho":                                {},
+		`text:"the changelog"`:                {"release v2"},
+		"release state:open":                  {"release v2", "release v2/write release notes"},
+		"due:today":                           {"standup", "buy milk"},
+		"due<today":                           {"old release"},
+		"due:tomorrow state:open":             {"call boss @phone"},
+		"due>5d":                              {"release v2"},
+		"due<1w state:open cat:work":          {"call boss @phone", "release v2", "release v2/write release notes", "standup"},
+		"due<=2019-01-05 -due<today":          {"call boss @phone", "standup", "buy milk"},
+		"id:rev1":                             {"waiting for review"},
+	}
+
+	todos, _ := parse.String(todoContent)
+	for q, expected := range cases {
+		query, err := Parse(q)
+		assert.Nil(t, err, q)
+
+		names := make([]string, 0)
+		for _, r := range Search(todos, query, tu.Dtt("04.01.2019 13:00")) {
+			names = append(names, r.Path)
+		}
+		assert.Equal(t, expected, names, q)
+	}
+}
+
+func TestResult(t *testing.T) {
+	todos, _ := parse.String(todoContent)
+	query, _ := Parse("standup")
+
+	res := Search(todos, query, tu.Dtt("04.01.2019 13:00"))
+
+	assert.Len(t, res, 1)
+	assert.Equal(t, "Work", res[0].Category)
+	assert.Equal(t, "04.01.2019", tu.Dts(*res[0].Due))
+	assert.Equal(t, 10, res[0].DocCoords.LineNumber)
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	cases := map[string]string{
+		"prio>x":             "position 0: invalid term prio>x: priority must be a number",
+		"state:open foo:1":   "position 11: invalid term foo:1: unknown key foo",
+		"state:blocked":      "position 0: invalid term state:blocked: state must be one of open, done, new, waiting, inprogress",
+		"cat>Work":           "position 0: invalid term cat>Work: only : is supported",
+		"due<soon":           "position 0: invalid term due<soon: date must be today, tomorrow, yesterday, <n>d, <n>w or yyyy-mm-dd",
+		`text:"unterminated`: "position 5: unterminated quote",
+	}
+
+	for q, expected := range cases {
+		_, err := Parse(q)
+		assert.EqualError(t, err, expected, q)
+	}
+}
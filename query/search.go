@@ -0,0 +1,63 @@
+package query
+
+import (
+	"time"
+
+	"github.com/sandro-h/sibylgo/moment"
+)
+
+// Result is a moment matching a query.
+type Result struct {
+	Name string `json:"name"`
+	// Path contains the names of the parent moments and the moment, separated by /.
+	Path      string           `json:"path"`
+	Category  string           `json:"category,omitempty"`
+	Priority  int              `json:"priority"`
+	WorkState moment.WorkState `json:"workState"`
+	Done      bool             `json:"done"`
+	Due       *time.Time       `json:"due,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	DocCoords moment.DocCoords `json:"docCoords"`
+	Moment    moment.Moment    `json:"-"`
+}
+
+// Search returns all moments and sub moments matching the query, in document order.
+func Search(todos *moment.Todos, q *Query, today time.Time) []Result {
+	res := make([]Result, 0)
+	for _, m := range todos.Moments {
+		res = search(m, "", q, today, res)
+	}
+	return res
+}
+
+func search(mom moment.Moment, parentPath string, q *Query, today time.Time, res []Result) []Result {
+	path := parentPath + mom.GetName()
+	c := newContext(mom, today)
+	if q.matches(c) {
+		res = append(res, toResult(mom, path, c))
+	}
+	for _, sub := range mom.GetSubMoments() {
+		res = search(sub, path+"/", q, today, res)
+	}
+	return res
+}
+
+func toResult(mom moment.Moment, path string, c *context) Result {
+	r := Result{
+		Name:      mom.GetName(),
+		Path:      path,
+		Priority:  mom.GetPriority(),
+		WorkState: mom.GetWorkState(),
+		Done:      mom.IsDone(),
+		Due:       c.dueDate(),
+		DocCoords: mom.GetDocCoords(),
+		Moment:    mom,
+	}
+	if mom.GetCategory() != nil {
+		r.Category = mom.GetCategory().Name
+	}
+	if mom.GetID() != nil {
+		r.ID = mom.GetID().Value
+	}
+	return r
+}
@@ -0,0 +1,113 @@
+package reminder
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/notify"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultEscalateAfterDays is how many days a moment can be overdue before it is escalated.
+const DefaultEscalateAfterDays = 7
+
+// SendWeeklyDigest sends the moments due today and this week, and the overdue moments, to the Weekly notifier.
+// It is skipped during vacations.
+func (p *MailReminderProcess) SendWeeklyDigest() error {
+	if p.Weekly == nil {
+		return nil
+	}
+	today := util.SetToStartOfDay(getNow())
+	todos, err := p.parseTodoFile()
+	if err != nil {
+		log.Errorf("Could not load moments for weekly digest: %s\n", err.Error())
+		return err
+	}
+	keep := p.Filter.matching(todos, today)
+	vacations, err := p.loadVacations(todos, keep)
+	if err != nil {
+		log.Errorf("%s\n", err.Error())
+		return err
+	}
+	if activeVacation(vacations, today) != nil {
+		log.Infof("Skipping weekly digest for %s during vacation\n", today)
+		return nil
+	}
+	todos = withoutVacationMoments(todos)
+
+	todays, weeks := CompileRemindersForTodayAndThisWeek(todos, today)
+	todays, weeks = filterInstances(todays, keep), filterInstances(weeks, keep)
+	digest := &Digest{
+		Title: fmt.Sprintf("TODOs for the week of %s", util.SetToStartOfWeek(today).Format("2 Jan 2006")),
+		Sections: []*DigestSection{
+			p.newDigestSection("Today", todays, false),
+			p.newDigestSection("This week", weeks, true),
+		},
+		Overdue: p.newOverdueDigestMoments(filterOverdue(FindOverdueMoments(todos, today), keep)),
+	}
+
+	log.Infof("Sending weekly digest for %s\n", today)
+	err = p.sendDigest(p.Weekly, digest, util.SetToEndOfWeek(today))
+	if err != nil {
+		log.Errorf("Could not send weekly digest: %s\n", err.Error())
+	}
+	return err
+}
+
+func formatDaysLate(days int) string {
+	if days == 1 {
+		return "1 day late"
+	}
+	return fmt.Sprintf("%d days late", days)
+}
+
+// checkEscalations sends an escalation once for every moment overdue by more than EscalateAfterDays.
+// Moments that are no longer overdue are forgotten, so they are escalated again if they become overdue again.
+// During vacations, only critical moments are escalated, the others are marked as escalated without sending.
+func (p *MailReminderProcess) checkEscalations(st *StateStore, overdue []*OverdueMoment, onVacation bool) error {
+	var firstErr error
+	current := make(map[string]bool)
+	for _, o := range overdue {
+		key := overdueKey(o)
+		current[key] = true
+		if o.DaysLate <= p.EscalateAfterDays || st.WasEscalated(key) {
+			continue
+		}
+		name := o.Moment.GetName()
+		critical := o.Moment.GetPriority() > 0
+		if onVacation && !critical {
+			log.Infof("Skipping escalation for %s during vacation\n", name)
+			st.MarkEscalated(key)
+			continue
+		}
+		subject := fmt.Sprintf("Overdue: %s is %s", name, formatDaysLate(o.DaysLate))
+		content := fmt.Sprintf("%s was due on %s and is still not done.", name, o.End.Format("Monday, 2 Jan 2006"))
+		msg := &notify.Message{Title: subject, Text: content, HTML: html.EscapeString(content), Critical: critical}
+		err := p.send(p.Escalation, p.withActions(msg, o.Moment))
+		if err != nil {
+			log.Errorf("Could not send escalation for %s: %s\n", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		st.MarkEscalated(key)
+	}
+	st.RetainEscalated(current)
+	return firstErr
+}
+
+// overdueKey identifies an overdue moment by its ID or name, and its end date.
+func overdueKey(o *OverdueMoment) string {
+	return momentKey(o.Moment) + "@" + o.End.Format("2006-01-02")
+}
+
+func momentKey(m moment.Moment) string {
+	if m.GetID() != nil {
+		return "#" + m.GetID().Value
+	}
+	return strings.TrimSpace(m.GetName())
+}
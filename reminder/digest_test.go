@@ -0,0 +1,130 @@
+package reminder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendWeeklyDigest(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("07.01.2019 08:00") }
+	todoFile := writeTodoFile(`
+[] dentist (7.1.19 9:00)
+[] taxes (-10.1.19)
+[] project
+	[] review (9.1.19)
+[] late (-2.1.19)
+[] next week (15.1.19)
+`)
+	weekly := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, nil, nil)
+	p.Weekly = weekly
+
+	err := p.SendWeeklyDigest()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(weekly.msgs))
+	assert.Equal(t, "TODOs for the week of 7 Jan 2019", weekly.msgs[0].Title)
+	assert.Equal(t, `Today:
+- dentist 09:00
+
+This week:
+- Mon 7 Jan: dentist 09:00
+- Thu 10 Jan: taxes
+- project
+  - Wed 9 Jan: review
+
+Overdue:
+- late (5 days late)
+`, weekly.msgs[0].Text)
+	tu.AssertContains(t, "<h3>Overdue</h3>\n<ul>\n<li>"+todoLink(6)+"<b>late</b></a> (5 days late)</li>\n</ul>\n",
+		weekly.msgs[0].HTML)
+}
+
+func TestDailyReminder_Overdue(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 08:00") }
+	todoFile := writeTodoFile(`
+[] foo (5.1.19)
+[] bar (-4.1.19)
+[x] done (1.1.19)
+`)
+	daily := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, nil)
+	p.StateFile = testStateFile
+
+	p.CheckOnce()
+
+	assert.Equal(t, "- foo\n\nOverdue:\n- bar (1 day late)\n", daily.msgs[0].Text)
+	assert.Equal(t, `<ul>
+<li>`+todoLink(2)+`<b>foo</b></a></li>
+</ul>
+<h3>Overdue</h3>
+<ul>
+<li>`+todoLink(3)+`<b>bar</b></a> (1 day late)</li>
+</ul>
+`, daily.msgs[0].HTML)
+}
+
+func TestEscalation(t *testing.T) {
+	defer startup()
+	todoFile := writeTodoFile(`
+[] very late (-28.12.18)
+[] a bit late (-3.1.19)
+[] late too (-20.12.18) #t1
+`)
+	escalation := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, nil, nil)
+	p.StateFile = testStateFile
+	p.Escalation = escalation
+
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 08:00") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 08:05") }
+	p.CheckOnce()
+
+	assert.Equal(t, 2, len(escalation.msgs), "each only once")
+	assert.Equal(t, "Overdue: very late is 8 days late", escalation.msgs[0].Title)
+	assert.Equal(t, "very late was due on Friday, 28 Dec 2018 and is still not done.", escalation.msgs[0].Text)
+	assert.Equal(t, "Overdue: late too is 16 days late", escalation.msgs[1].Title)
+
+	// Done, then reopened: escalated again
+	writeTodoFile(`
+[x] very late (-28.12.18)
+`)
+	p.CheckOnce()
+	writeTodoFile(`
+[] very late (-28.12.18)
+`)
+	p.CheckOnce()
+
+	assert.Equal(t, 3, len(escalation.msgs))
+	assert.Equal(t, "Overdue: very late is 8 days late", escalation.msgs[2].Title)
+}
+
+func TestEscalation_Threshold(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 08:00") }
+	todoFile := writeTodoFile(`
+[] late (-3.1.19)
+`)
+	escalation := &recordingNotifier{err: fmt.Errorf("offline")}
+	p := NewReminderProcess(todoFile, nil, nil)
+	p.StateFile = testStateFile
+	p.Escalation = escalation
+	p.EscalateAfterDays = 1
+
+	err := p.CheckOnce()
+	assert.EqualError(t, err, "offline")
+
+	escalation.err = nil
+	err = p.CheckOnce()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(escalation.msgs), "retried after the error")
+	assert.Equal(t, "Overdue: late is 2 days late", escalation.msgs[1].Title)
+}
@@ -1,47 +1,96 @@
 package reminder
 
 import (
-	"bufio"
 	"fmt"
-	"os"
-	"path/filepath"
+	"html"
+	"strings"
 	"time"
 
+	"github.com/sandro-h/sibylgo/actions"
 	"github.com/sandro-h/sibylgo/instances"
+	"github.com/sandro-h/sibylgo/metrics"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/notify"
 	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/status"
 	"github.com/sandro-h/sibylgo/util"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/gomail.v2"
 )
 
 var getNow = func() time.Time {
 	return time.Now()
 }
 
-const defaultLastSentFile = "sibylgo_lastsent.txt"
+var reminderMailsTotal = metrics.NewCounterVec("sibylgo_reminder_mails_total",
+	"Number of sent reminder mails.", "result")
 
 // SendMailFunction takes an e-mail subject and content and sends
 // it to a predefined recipient.
 type SendMailFunction func(string, string) error
 
+// mailFuncNotifier sends notifications with a SendMailFunction.
+type mailFuncNotifier SendMailFunction
+
+func (f mailFuncNotifier) Notify(msg *notify.Message) error {
+	return f(msg.Title, msg.HTML)
+}
+
 // MailReminderProcess checks the moments in the given todo file
-// and sends a reminder mail for those moments that are due on the current day
+// and sends a reminder for those moments that are due on the current day
 // or due within a couple of minutes (if they have a TimeOfDay set).
 type MailReminderProcess struct {
-	todoFilePath  string
-	sendMailFunc  SendMailFunction
-	LastSentFile  string
-	checkInterval time.Duration
-	reminderTime  time.Duration
+	todoFilePath string
+	daily        notify.Notifier
+	timed        notify.Notifier
+	// StateFile is where the sent reminders are recorded, by default next to the todo file.
+	StateFile string
+	// TemplateDir can contain templates overriding the default digest templates, see LoadTemplates.
+	TemplateDir string
+	// Weekly gets the digest sent by SendWeeklyDigest.
+	Weekly notify.Notifier
+	// Escalation, if set, gets a notification for every moment overdue by more than EscalateAfterDays.
+	Escalation        notify.Notifier
+	EscalateAfterDays int
+	// Vacation, if set, is a vacation from the config. Vacations can also be set with SetVacation and with
+	// vacation moments, see VacationID.
+	Vacation *Vacation
+	// VacationStateFile, if set, is the state file the vacation set with SetVacation is read from instead of the
+	// StateFile, so subscriptions share the vacation of the reminders.
+	VacationStateFile string
+	// Filter, if set, selects the todos to send reminders for, e.g. for a subscription.
+	Filter *Filter
+	// Actions, if set, signs links to complete or snooze the moments, which are added to the reminders.
+	Actions *actions.Signer
+	// OnParse, if set, is called after every parse of the todo file, e.g. to record it.
+	OnParse      func(path string, err error)
+	reminderTime time.Duration
+}
+
+func (p *MailReminderProcess) parseTodoFile() (*moment.Todos, error) {
+	todos, err := parse.File(p.todoFilePath)
+	if p.OnParse != nil {
+		p.OnParse(p.todoFilePath, err)
+	}
+	return todos, err
 }
 
 // NewMailReminderProcess creates a MailReminderProcess that uses the given sendMailFunc to send the
 // reminder mails.
 func NewMailReminderProcess(todoFilePath string, sendMailFunc SendMailFunction) *MailReminderProcess {
-	return &MailReminderProcess{todoFilePath, sendMailFunc,
-		filepath.Join(os.TempDir(), defaultLastSentFile),
-		5 * time.Minute,
-		15 * time.Minute}
+	return NewReminderProcess(todoFilePath, mailFuncNotifier(sendMailFunc), mailFuncNotifier(sendMailFunc))
+}
+
+// NewReminderProcess creates a MailReminderProcess that sends the daily reminders to the daily notifier and
+// the timed reminders to the timed notifier. Either can be nil to not send those reminders.
+func NewReminderProcess(todoFilePath string, daily notify.Notifier, timed notify.Notifier) *MailReminderProcess {
+	return &MailReminderProcess{
+		todoFilePath:      todoFilePath,
+		daily:             daily,
+		timed:             timed,
+		StateFile:         util.NewFileConfigFromTodoFile(todoFilePath).ReminderStateFile,
+		EscalateAfterDays: DefaultEscalateAfterDays,
+		reminderTime:      15 * time.Minute,
+	}
 }
 
 // NewMailReminderProcessForSMTP creates a MailReminderProjcess that uses SMTP to send reminder mails to the given
@@ -49,151 +98,347 @@ func NewMailReminderProcess(todoFilePath string, sendMailFunc SendMailFunction)
 func NewMailReminderProcessForSMTP(todoFilePath string, host MailHostProperties, from string, to string) *MailReminderProcess {
 	return NewMailReminderProcess(todoFilePath,
 		func(subject string, body string) error {
-			return sendMail(host, from, to, subject, body)
+			return SendMail(host, from, to, subject, body)
 		})
 }
 
-// CheckInfinitely repeatedly checks for reminders in the check interval.
-// This method blocks indefinitely and should be run as a go routine.
-func (p *MailReminderProcess) CheckInfinitely() {
-	for {
-		p.CheckOnce()
-		time.Sleep(p.checkInterval)
-	}
-}
-
 // CheckOnce does a single check for reminders and sends them if found.
-func (p *MailReminderProcess) CheckOnce() {
+// Reminders whose time passed without being sent, e.g. because the backend was down, are sent as long as
+// the moment is still upcoming. The sent reminders are recorded in the StateFile so none is sent twice.
+// During vacations, only critical reminders are sent, and the first daily digest afterwards welcomes back.
+func (p *MailReminderProcess) CheckOnce() error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
 	now := getNow()
 	today := util.SetToStartOfDay(now)
 
-	insts, err := p.loadTodaysMoments(today)
+	todos, err := p.parseTodoFile()
 	if err != nil {
 		log.Errorf("Could not load moments for reminders: %s\n", err.Error())
-		return
+		return err
+	}
+	st := p.newStateStore()
+	err = st.Load()
+	if err != nil {
+		log.Errorf("%s\n", err.Error())
+		return err
 	}
+	err = p.flush()
 
-	p.checkDailyReminder(today, insts)
-	p.checkTimedReminders(now, insts)
+	keep := p.Filter.matching(todos, today)
+	vacations := p.vacations(todos, st, keep)
+	onVacation := activeVacation(vacations, today) != nil
+	todos = withoutVacationMoments(todos)
+	overdue := filterOverdue(FindOverdueMoments(todos, today), keep)
+	if p.daily != nil {
+		dailyErr := p.checkDailyReminder(st, today, todos, keep, overdue, vacations)
+		if err == nil {
+			err = dailyErr
+		}
+	}
+	if p.timed != nil {
+		// Look ahead far enough to find the moments with the longest lead time.
+		horizon := util.SetToEndOfDay(now.Add(p.maxLeadTime(todos.Moments)))
+		timedErr := p.checkTimedReminders(st, now, generateOpen(todos, today, horizon, keep), onVacation)
+		if err == nil {
+			err = timedErr
+		}
+	}
+	if p.Escalation != nil {
+		escalationErr := p.checkEscalations(st, overdue, onVacation)
+		if err == nil {
+			err = escalationErr
+		}
+	}
+
+	st.Prune(today)
+	saveErr := st.Save()
+	if saveErr != nil {
+		log.Errorf("Could not save reminder state: %s\n", saveErr.Error())
+		if err == nil {
+			err = saveErr
+		}
+	}
+	return err
 }
 
-func (p *MailReminderProcess) loadLastDaySent() time.Time {
-	errDt := getNow().AddDate(0, 0, -1)
-	path := p.LastSentFile
-	file, err := os.Open(path)
-	if err != nil {
-		log.Errorf("%s\n", err.Error())
-		return errDt
+// flush delivers the reminders held back by the notifiers, e.g. during quiet hours.
+func (p *MailReminderProcess) flush() error {
+	var firstErr error
+	for _, n := range []notify.Notifier{p.daily, p.timed, p.Weekly, p.Escalation} {
+		if n == nil {
+			continue
+		}
+		err := notify.Flush(n)
+		if err != nil {
+			log.Errorf("Could not send held back reminders: %s\n", err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
 	}
-	defer file.Close()
-	sc := bufio.NewScanner(file)
-	if !sc.Scan() || sc.Err() != nil {
-		return errDt
+	return firstErr
+}
+
+// generateOpen generates the instances of the open moments in the set.
+func generateOpen(todos *moment.Todos, from time.Time, to time.Time, keep momentSet) []*instances.Instance {
+	return instances.GenerateFiltered(todos, from, to,
+		func(mom *instances.Instance) bool { return !mom.Done && keep.has(mom.Moment) })
+}
+
+func (p *MailReminderProcess) maxLeadTime(moms []moment.Moment) time.Duration {
+	max := p.reminderTime
+	for _, m := range moms {
+		for _, lead := range m.GetReminders() {
+			if lead > max {
+				max = lead
+			}
+		}
+		if sub := p.maxLeadTime(m.GetSubMoments()); sub > max {
+			max = sub
+		}
+	}
+	return max
+}
+
+// checkDailyReminder sends the daily digest once a day. It is skipped during vacations, and the first one after
+// a vacation is the welcome back digest.
+func (p *MailReminderProcess) checkDailyReminder(st *StateStore, today time.Time, todos *moment.Todos, keep momentSet,
+	overdue []*OverdueMoment, vacations []*Vacation) error {
+	if !today.After(st.LastDaily()) {
+		return nil
+	}
+	if activeVacation(vacations, today) != nil {
+		log.Infof("Skipping daily reminder for %s during vacation\n", today)
+		st.SetLastDaily(today)
+		return nil
+	}
+
+	var err error
+	back := welcomeBackVacation(st, vacations, today)
+	if back != nil {
+		log.Infof("Sending welcome back digest for %s\n", today)
+		err = p.sendWelcomeBack(today, todos, keep, overdue)
+	} else {
+		log.Infof("Sending daily reminder for %s\n", today)
+		err = p.sendDailyReminder(today, generateOpen(todos, today, util.SetToEndOfDay(today), keep), overdue)
 	}
-	dt, err := time.ParseInLocation("2006-01-02", sc.Text(), time.Local)
 	if err != nil {
-		log.Errorf("%s\n", err.Error())
-		return errDt
+		log.Errorf("Could not send reminder: %s\n", err.Error())
+		return err
+	}
+	if back != nil {
+		st.SetWelcomedBack(back.To)
+	}
+	st.SetLastDaily(today)
+	return nil
+}
+
+func (p *MailReminderProcess) sendDailyReminder(today time.Time, insts []*instances.Instance, overdue []*OverdueMoment) error {
+	digest := &Digest{
+		Title:    fmt.Sprintf("TODOs for %s", today.Format("Monday, 2 Jan 2006")),
+		Sections: []*DigestSection{p.newDigestSection("", FilterMomentsEndingInRange(insts), false)},
+		Overdue:  p.newOverdueDigestMoments(overdue),
+	}
+	return p.sendDigest(p.daily, digest, util.SetToEndOfDay(today))
+}
+
+// sendWelcomeBack sends the catch-up digest after a vacation: the moments due today and this week, and all
+// overdue moments, including the ones that were due during the vacation.
+func (p *MailReminderProcess) sendWelcomeBack(today time.Time, todos *moment.Todos, keep momentSet,
+	overdue []*OverdueMoment) error {
+	todays, weeks := CompileRemindersForTodayAndThisWeek(todos, today)
+	todays, weeks = filterInstances(todays, keep), filterInstances(weeks, keep)
+	digest := &Digest{
+		Title: fmt.Sprintf("Welcome back! TODOs for %s", today.Format("Monday, 2 Jan 2006")),
+		Sections: []*DigestSection{
+			p.newDigestSection("Today", todays, false),
+			p.newDigestSection("This week", weeks, true),
+		},
+		Overdue: p.newOverdueDigestMoments(overdue),
 	}
-	return dt
+	return p.sendDigest(p.daily, digest, util.SetToEndOfDay(today))
 }
 
-func (p *MailReminderProcess) saveLastDaySent(dt time.Time) {
-	path := p.LastSentFile
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+// sendDigest renders and sends the digest. If the notifier holds it back, it is dropped after expires.
+func (p *MailReminderProcess) sendDigest(n notify.Notifier, digest *Digest, expires time.Time) error {
+	tmpl, err := LoadTemplates(p.TemplateDir)
 	if err != nil {
-		log.Errorf("%s\n", err.Error())
+		return err
 	}
-	defer file.Close()
-	_, err = fmt.Fprintf(file, "%s\n", dt.Format("2006-01-02"))
+	content, text, err := tmpl.Render(digest)
 	if err != nil {
-		log.Errorf("%s\n", err.Error())
+		return err
 	}
+	return p.send(n, &notify.Message{Title: digest.Title, Text: text, HTML: content, Expires: expires,
+		Actions: digest.allActions()})
 }
 
-func (p *MailReminderProcess) loadTodaysMoments(today time.Time) ([]*instances.Instance, error) {
-	todos, err := parse.File(p.todoFilePath)
+func (p *MailReminderProcess) send(n notify.Notifier, msg *notify.Message) error {
+	err := n.Notify(msg)
+	status.RecordReminderMail(msg.Title, err)
 	if err != nil {
-		return nil, err
+		reminderMailsTotal.Inc("error")
+	} else {
+		reminderMailsTotal.Inc("ok")
 	}
-	insts := instances.GenerateFiltered(todos, today, util.SetToEndOfDay(today),
-		func(mom *instances.Instance) bool { return !mom.Done })
-	return insts, nil
+	return err
 }
 
-func (p *MailReminderProcess) checkDailyReminder(today time.Time, insts []*instances.Instance) {
-	lastDaySent := p.loadLastDaySent()
-	if today.After(lastDaySent) {
-		log.Infof("Sending daily reminder for %s\n", today)
-		err := p.sendDailyReminder(today, insts)
+// checkTimedReminders sends the reminders whose lead time passed. During vacations, only the ones of critical
+// moments are sent, the others are dropped.
+func (p *MailReminderProcess) checkTimedReminders(st *StateStore, now time.Time, insts []*instances.Instance,
+	onVacation bool) error {
+	var firstErr error
+	for _, m := range p.findUpcomingTimedMoments(st, now, insts, "") {
+		var err error
+		if onVacation && !m.Critical {
+			log.Infof("Skipping reminder for %s during vacation\n", m.Name)
+		} else {
+			err = p.send(p.timed, p.withActions(reminderMessage(now, m), m.Moment))
+		}
 		if err != nil {
-			log.Errorf("Could not send reminder: %s\n", err.Error())
-			return
+			log.Errorf("Could not send reminder for %s: %s\n", m.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, k := range m.Keys {
+			st.MarkSent(k, m.Due)
 		}
-		p.saveLastDaySent(today)
 	}
+	return firstErr
 }
 
-func (p *MailReminderProcess) sendDailyReminder(today time.Time, insts []*instances.Instance) error {
-	subject := fmt.Sprintf("TODOs for %s", today.Format("Monday, 2 Jan 2006"))
-	content := ""
-	ending := FilterMomentsEndingInRange(insts)
-	addMomentHTML(&content, ending)
-	return p.sendMailFunc(subject, content)
-}
-
-func addMomentHTML(content *string, insts []*instances.Instance) {
-	*content += "<ul>\n"
-	for _, m := range insts {
-		*content += "<li>"
-		if m.EndsInRange {
-			*content += "<b>"
-		}
-		*content += m.Name
-		if m.EndsInRange {
-			*content += "</b>"
-		}
-		if len(m.SubInstances) > 0 {
-			addMomentHTML(content, m.SubInstances)
+func reminderMessage(now time.Time, m upcoming) *notify.Message {
+	var subject, content string
+	if m.HasTime {
+		subject = fmt.Sprintf("Reminder for %s in %s", m.Name, formatDelta(m.Delta))
+		content = fmt.Sprintf("%s starts at %s", m.Name, m.Due.Format("15:04"))
+		if !util.SetToStartOfDay(m.Due).Equal(util.SetToStartOfDay(now)) {
+			content = fmt.Sprintf("%s starts on %s at %s", m.Name, m.Due.Format("Monday, 2 Jan 2006"), m.Due.Format("15:04"))
 		}
-		*content += "</li>\n"
+	} else {
+		subject = fmt.Sprintf("Reminder for %s due %s", m.Name, formatDueDays(now, m.Due))
+		content = fmt.Sprintf("%s is due on %s", m.Name, m.Due.Format("Monday, 2 Jan 2006"))
 	}
-	if len(insts) == 0 {
-		*content += "<li>None</li>\n"
+	return &notify.Message{Title: subject, Text: content, HTML: html.EscapeString(content),
+		Critical: m.Critical, Expires: m.Over}
+}
+
+// actionLinks returns the action links of the moment, or nil if action links are not configured.
+func (p *MailReminderProcess) actionLinks(m moment.Moment) []notify.Action {
+	if p.Actions == nil || m == nil {
+		return nil
 	}
-	*content += "</ul>\n"
+	return p.Actions.Links(m)
 }
 
-func (p *MailReminderProcess) checkTimedReminders(now time.Time, insts []*instances.Instance) {
-	upcoming := p.findUpcomingTimedMoments(now, p.reminderTime, p.checkInterval, insts)
-	for _, m := range upcoming {
-		subject := fmt.Sprintf("Reminder for %s in %.0fmin", m.Name, m.Delta.Minutes())
-		content := fmt.Sprintf("%s starts at %s", m.Name, m.TimeOfDay.Format("15:04"))
-		p.sendMailFunc(subject, content)
+// withActions adds the action links of the moment to the message.
+func (p *MailReminderProcess) withActions(msg *notify.Message, m moment.Moment) *notify.Message {
+	msg.Actions = p.actionLinks(m)
+	if len(msg.Actions) == 0 {
+		return msg
 	}
+	var text, links []string
+	for _, a := range msg.Actions {
+		text = append(text, fmt.Sprintf("%s: %s", a.Label, a.URL))
+		links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(a.URL), html.EscapeString(a.Label)))
+	}
+	msg.Text += "\n\n" + strings.Join(text, "\n")
+	msg.HTML += "<p>" + strings.Join(links, " | ") + "</p>"
+	return msg
 }
 
 type upcoming struct {
-	Name      string
-	TimeOfDay time.Time
-	Delta     time.Duration
+	Name string
+	// Due is the time of day of timed moments, or the start of the due day otherwise.
+	Due time.Time
+	// Over is when the reminder is pointless, i.e. when the moment starts or the due day ends.
+	Over    time.Time
+	HasTime bool
+	Delta   time.Duration
+	// Critical is true for moments with a priority. They are reminded of even during quiet hours and vacations.
+	Critical bool
+	// Keys identify the reminders of the moment occurrence that are covered by this one.
+	Keys   []string
+	Moment moment.Moment
 }
 
-func (p *MailReminderProcess) findUpcomingTimedMoments(now time.Time, dur time.Duration,
-	checkInterval time.Duration, insts []*instances.Instance) []upcoming {
+// findUpcomingTimedMoments finds the moments with a reminder time that passed but which were not
+// reminded of yet. Moments with a time of day are reminded at their lead times before that time
+// (by default reminderTime), moments with only a due date at their lead times before the start of the
+// due day. Once the moment started or the due day is over, missed reminders are dropped.
+// If several reminders of a moment are pending, only one is sent.
+func (p *MailReminderProcess) findUpcomingTimedMoments(st *StateStore, now time.Time,
+	insts []*instances.Instance, parentKey string) []upcoming {
 	var res []upcoming
 	for _, i := range insts {
+		key := i.Name
+		if parentKey != "" {
+			key = parentKey + "/" + i.Name
+		}
+		leads := i.Reminders
+		var due, over time.Time
 		if i.TimeOfDay != nil {
-			delta := i.TimeOfDay.Sub(now)
-			if delta <= dur && delta+checkInterval > dur {
-				res = append(res, upcoming{i.Name, *i.TimeOfDay, delta})
+			due = *i.TimeOfDay
+			over = due
+			if len(leads) == 0 {
+				leads = []time.Duration{p.reminderTime}
+			}
+		} else if i.EndsInRange {
+			due = util.SetToStartOfDay(i.End)
+			over = i.End
+		}
+		if !due.IsZero() && now.Before(over) {
+			var keys []string
+			pending := false
+			for _, lead := range leads {
+				if due.Add(-lead).After(now) {
+					continue
+				}
+				k := fmt.Sprintf("%s@%s-%s", key, due.Format(time.RFC3339), lead)
+				keys = append(keys, k)
+				pending = pending || !st.WasSent(k)
+			}
+			if pending {
+				res = append(res, upcoming{i.Name, due, over, i.TimeOfDay != nil, due.Sub(now), i.Priority > 0, keys, i.Moment})
 			}
 		}
-		res = append(res, p.findUpcomingTimedMoments(now, dur, checkInterval, i.SubInstances)...)
+		res = append(res, p.findUpcomingTimedMoments(st, now, i.SubInstances, key)...)
 	}
 	return res
 }
 
+func formatDelta(d time.Duration) string {
+	d = d.Round(time.Minute)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%.0fmin", d.Minutes())
+	case d < 24*time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dmin", int(d.Hours()), int(d.Minutes())%60)
+	}
+	days := int(d.Hours()/24 + 0.5)
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+func formatDueDays(now time.Time, due time.Time) string {
+	days := util.SetToStartOfDay(due).Sub(util.SetToStartOfDay(now)).Hours() / 24
+	switch {
+	case days < 0.5:
+		return "today"
+	case days < 1.5:
+		return "tomorrow"
+	}
+	return fmt.Sprintf("in %.0f days", days)
+}
+
 // MailHostProperties defines the mail host used for SMTP.
 type MailHostProperties struct {
 	Host     string
@@ -202,15 +447,8 @@ type MailHostProperties struct {
 	Password string
 }
 
-func sendMail(host MailHostProperties, from string, to string, subject string, body string) error {
-
-	m := gomail.NewMessage()
-	m.SetHeader("From", from)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", subject)
-	m.SetBody("text/html", body)
-
-	d := gomail.NewDialer(host.Host, host.Port, host.User, host.Password)
-
-	return d.DialAndSend(m)
+// SendMail sends an HTML mail over SMTP.
+func SendMail(host MailHostProperties, from string, to string, subject string, body string) error {
+	n := &notify.MailNotifier{Host: host.Host, Port: host.Port, User: host.User, Password: host.Password, From: from, To: to}
+	return n.Notify(&notify.Message{Title: subject, HTML: body})
 }
@@ -2,7 +2,9 @@ package reminder
 
 import (
 	"fmt"
+	"github.com/sandro-h/sibylgo/notify"
 	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path/filepath"
@@ -10,7 +12,7 @@ import (
 	"time"
 )
 
-var testLastSentFile = filepath.Join(os.TempDir(), "mail_reminder_test_lastsent.txt")
+var testStateFile = filepath.Join(os.TempDir(), "mail_reminder_test_state.json")
 
 func TestMain(m *testing.M) {
 	startup()
@@ -20,11 +22,12 @@ func TestMain(m *testing.M) {
 
 func startup() {
 	getNow = func() time.Time { return tu.Dt("04.01.2019") }
-	os.Remove(testLastSentFile)
+	legacyLastSentFile = filepath.Join(os.TempDir(), "mail_reminder_test_lastsent.txt")
+	os.Remove(testStateFile)
 }
 
 func TestEmptyDailyReminder(t *testing.T) {
-	defer os.Remove(testLastSentFile)
+	defer os.Remove(testStateFile)
 	todoFile := writeTodoFile("")
 	var rcvTitle string
 	var rcvContent string
@@ -32,14 +35,27 @@ func TestEmptyDailyReminder(t *testing.T) {
 	p.CheckOnce()
 
 	assert.Equal(t, "TODOs for Friday, 4 Jan 2019", rcvTitle)
-	assert.Equal(t, `<ul>
-<li>None</li>
-</ul>
-`, rcvContent)
+	assert.Equal(t, "<p>None</p>\n", rcvContent)
+}
+
+func TestOnParse(t *testing.T) {
+	defer os.Remove(testStateFile)
+	todoFile := writeTodoFile("[] foo (4.1.19)\n")
+	var rcvTitle string
+	var rcvContent string
+	p := createTestReminderProcess(todoFile, &rcvTitle, &rcvContent)
+	var parsed []string
+	p.OnParse = func(path string, err error) {
+		assert.Nil(t, err)
+		parsed = append(parsed, path)
+	}
+	p.CheckOnce()
+
+	assert.Equal(t, []string{todoFile}, parsed)
 }
 
 func TestDailyReminder(t *testing.T) {
-	defer os.Remove(testLastSentFile)
+	defer os.Remove(testStateFile)
 	todoFile := writeTodoFile(`
 [] foo (5.1.19)
 [] bar (4.1.19)
@@ -54,9 +70,9 @@ func TestDailyReminder(t *testing.T) {
 
 	assert.Equal(t, "TODOs for Friday, 4 Jan 2019", rcvTitle)
 	assert.Equal(t, `<ul>
-<li><b>bar</b></li>
-<li>zon<ul>
-<li><b>ran</b></li>
+<li>`+todoLink(3)+`<b>bar</b></a></li>
+<li>`+todoLink(4)+`zon</a><ul>
+<li>`+todoLink(5)+`<b>ran</b></a></li>
 </ul>
 </li>
 </ul>
@@ -64,7 +80,7 @@ func TestDailyReminder(t *testing.T) {
 }
 
 func TestNoRepeatOnSameDay(t *testing.T) {
-	defer os.Remove(testLastSentFile)
+	defer os.Remove(testStateFile)
 	todoFile := writeTodoFile("")
 	var rcvTitle string
 	var rcvContent string
@@ -78,7 +94,7 @@ func TestNoRepeatOnSameDay(t *testing.T) {
 }
 
 func TestRepeatOnNextDay(t *testing.T) {
-	defer os.Remove(testLastSentFile)
+	defer os.Remove(testStateFile)
 	todoFile := writeTodoFile("")
 	var rcvTitle string
 	var rcvContent string
@@ -94,9 +110,9 @@ func TestRepeatOnNextDay(t *testing.T) {
 }
 
 func TestTimedReminder(t *testing.T) {
-	defer os.Remove(testLastSentFile)
+	defer os.Remove(testStateFile)
 	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
-	setLastSentFileToToday()
+	setDailySentToday()
 
 	todoFile := writeTodoFile(`
 [] foo (5.1.19 13:15)
@@ -111,9 +127,9 @@ func TestTimedReminder(t *testing.T) {
 }
 
 func TestTimedReminderTooEarly(t *testing.T) {
-	defer os.Remove(testLastSentFile)
+	defer os.Remove(testStateFile)
 	getNow = func() time.Time { return tu.Dtt("05.01.2019 12:59") }
-	setLastSentFileToToday()
+	setDailySentToday()
 
 	todoFile := writeTodoFile(`
 [] foo (5.1.19 13:15)
@@ -128,11 +144,10 @@ func TestTimedReminderTooEarly(t *testing.T) {
 }
 
 func TestTimedReminderTooLate(t *testing.T) {
-	defer os.Remove(testLastSentFile)
-	// 13:12 means with check interval of 5min, reminder would've already been sent
-	// in a previous check
-	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:12") }
-	setLastSentFileToToday()
+	defer os.Remove(testStateFile)
+	// The moment already started, so a missed reminder is pointless
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:15") }
+	setDailySentToday()
 
 	todoFile := writeTodoFile(`
 [] foo (5.1.19 13:15)
@@ -146,6 +161,231 @@ func TestTimedReminderTooLate(t *testing.T) {
 	assert.Equal(t, "", rcvContent)
 }
 
+func TestTimedReminderSinceLastCheck(t *testing.T) {
+	defer os.Remove(testStateFile)
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 12:55") }
+	setDailySentToday()
+
+	todoFile := writeTodoFile(`
+[] foo (5.1.19 13:22)
+`)
+	var rcvTitle string
+	var rcvContent string
+	p := createTestReminderProcess(todoFile, &rcvTitle, &rcvContent)
+	p.CheckOnce()
+	assert.Equal(t, "", rcvTitle)
+
+	// The reminder at 13:07 passed since the last check
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:05") }
+	p.CheckOnce()
+	assert.Equal(t, "", rcvTitle)
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:15") }
+	p.CheckOnce()
+
+	assert.Equal(t, "Reminder for foo in 7min", rcvTitle)
+}
+
+func TestTimedReminderCatchUp(t *testing.T) {
+	defer os.Remove(testStateFile)
+	todoFile := writeTodoFile(`
+[] foo remind:1d remind:1h (5.1.19 13:15)
+`)
+	timed := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+
+	// Down since before both reminder times
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 12:40") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 12:45") }
+	p.CheckOnce()
+
+	assert.Equal(t, []*notify.Message{
+		{Title: "Reminder for foo in 35min", Text: "foo starts at 13:15", HTML: "foo starts at 13:15",
+			Expires: tu.Dtt("05.01.2019 13:15")},
+	}, timed.msgs, "only once for both missed reminders")
+}
+
+func TestTimedReminderNoDuplicateAfterRestart(t *testing.T) {
+	defer os.Remove(testStateFile)
+	todoFile := writeTodoFile(`
+[] foo (5.1.19 13:15)
+	[] bar (5.1.19 13:15)
+`)
+	timed := &recordingNotifier{}
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	p := NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+	p.CheckOnce()
+
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:07") }
+	p = NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+	p.CheckOnce()
+
+	assert.Equal(t, 2, len(timed.msgs))
+	assert.Equal(t, "Reminder for foo in 13min", timed.msgs[0].Title)
+	assert.Equal(t, "Reminder for bar in 13min", timed.msgs[1].Title)
+}
+
+func TestTimedReminderRetryAfterError(t *testing.T) {
+	defer os.Remove(testStateFile)
+	todoFile := writeTodoFile(`
+[] foo (5.1.19 13:15)
+`)
+	timed := &recordingNotifier{err: fmt.Errorf("offline")}
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	p := NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+
+	err := p.CheckOnce()
+	assert.EqualError(t, err, "offline")
+
+	timed.err = nil
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:07") }
+	err = p.CheckOnce()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(timed.msgs))
+	assert.Equal(t, "Reminder for foo in 8min", timed.msgs[1].Title)
+}
+
+func TestStateStore(t *testing.T) {
+	defer os.Remove(testStateFile)
+	st := NewStateStore(testStateFile)
+	assert.NoError(t, st.Load())
+	assert.True(t, st.LastDaily().IsZero())
+
+	st.SetLastDaily(tu.Dt("05.01.2019"))
+	st.MarkSent("foo@1", tu.Dtt("05.01.2019 13:15"))
+	st.MarkSent("bar@1", tu.Dtt("07.01.2019 09:00"))
+	assert.NoError(t, st.Save())
+
+	st = NewStateStore(testStateFile)
+	assert.NoError(t, st.Load())
+	st.Prune(tu.Dt("06.01.2019"))
+
+	assert.Equal(t, tu.Dt("05.01.2019"), st.LastDaily())
+	assert.False(t, st.WasSent("foo@1"))
+	assert.True(t, st.WasSent("bar@1"))
+}
+
+func TestStateStore_Corrupt(t *testing.T) {
+	defer os.Remove(testStateFile)
+	os.WriteFile(testStateFile, []byte("{nope"), 0600)
+
+	err := NewStateStore(testStateFile).Load()
+
+	tu.AssertContains(t, "could not read reminder state", err.Error())
+}
+
+func TestStateStore_LegacyLastSent(t *testing.T) {
+	defer os.Remove(testStateFile)
+	defer os.Remove(legacyLastSentFile)
+	os.WriteFile(legacyLastSentFile, []byte("2019-01-04\n"), 0644)
+
+	st := NewStateStore(testStateFile)
+	assert.NoError(t, st.Load())
+
+	assert.Equal(t, tu.Dt("04.01.2019"), st.LastDaily())
+}
+
+func TestReminderProcess_SeparateNotifiers(t *testing.T) {
+	defer os.Remove(testStateFile)
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(`
+[] foo (5.1.19 13:15)
+[] zon
+	[] ran (every saturday)
+`)
+	daily := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, nil)
+	p.StateFile = testStateFile
+
+	p.CheckOnce()
+
+	assert.Equal(t, 1, len(daily.msgs), "no timed reminder without notifier")
+	assert.Equal(t, "TODOs for Saturday, 5 Jan 2019", daily.msgs[0].Title)
+	assert.Equal(t, "- foo 13:15\n- zon\n  - ran\n", daily.msgs[0].Text)
+
+	timed := &recordingNotifier{}
+	p = NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+	p.CheckOnce()
+
+	assert.Equal(t, 1, len(timed.msgs))
+	assert.Equal(t, &notify.Message{Title: "Reminder for foo in 13min", Text: "foo starts at 13:15", HTML: "foo starts at 13:15",
+		Expires: tu.Dtt("05.01.2019 13:15")}, timed.msgs[0])
+}
+
+func TestTimedReminder_LeadTimes(t *testing.T) {
+	defer os.Remove(testStateFile)
+	todoFile := writeTodoFile(`
+[] foo remind:1h remind:2d (7.1.19 13:15)
+[] bar (5.1.19 14:15 !remind 1h30m)
+`)
+	timed := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 12:47") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:16") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("07.01.2019 12:17") }
+	p.CheckOnce()
+
+	assert.Equal(t, []*notify.Message{
+		{Title: "Reminder for bar in 1h28min", Text: "bar starts at 14:15", HTML: "bar starts at 14:15",
+			Expires: tu.Dtt("05.01.2019 14:15")},
+		{Title: "Reminder for foo in 2 days", Text: "foo starts on Monday, 7 Jan 2019 at 13:15",
+			HTML: "foo starts on Monday, 7 Jan 2019 at 13:15", Expires: tu.Dtt("07.01.2019 13:15")},
+		{Title: "Reminder for foo in 58min", Text: "foo starts at 13:15", HTML: "foo starts at 13:15",
+			Expires: tu.Dtt("07.01.2019 13:15")},
+	}, timed.msgs)
+}
+
+func TestTimedReminder_DueDateLeadTimes(t *testing.T) {
+	defer os.Remove(testStateFile)
+	todoFile := writeTodoFile(`
+[] taxes (-8.1.19 !remind 3d)
+[] dentist (every monday !remind 1d)
+[x] done already (8.1.19 !remind 3d)
+[] no lead time (6.1.19)
+`)
+	timed := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 00:02") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("06.01.2019 00:03") }
+	p.CheckOnce()
+
+	assert.Equal(t, []*notify.Message{
+		{Title: "Reminder for taxes due in 3 days", Text: "taxes is due on Tuesday, 8 Jan 2019",
+			HTML: "taxes is due on Tuesday, 8 Jan 2019", Expires: util.SetToEndOfDay(tu.Dt("08.01.2019"))},
+		{Title: "Reminder for dentist due tomorrow", Text: "dentist is due on Monday, 7 Jan 2019",
+			HTML: "dentist is due on Monday, 7 Jan 2019", Expires: util.SetToEndOfDay(tu.Dt("07.01.2019"))},
+	}, timed.msgs)
+}
+
+type recordingNotifier struct {
+	msgs []*notify.Message
+	err  error
+}
+
+func (n *recordingNotifier) Notify(msg *notify.Message) error {
+	n.msgs = append(n.msgs, msg)
+	return n.err
+}
+
+// todoLink returns the start of the link to the line in the test todo file.
+func todoLink(line int) string {
+	return fmt.Sprintf(`<a href="vscode://file%s:%d" style="color: inherit; text-decoration: none">`,
+		filepath.ToSlash(filepath.Join(os.TempDir(), "mail_reminder_test_todo.txt")), line)
+}
+
 func writeTodoFile(todos string) string {
 	path := filepath.Join(os.TempDir(), "mail_reminder_test_todo.txt")
 	file, _ := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
@@ -161,11 +401,11 @@ func createTestReminderProcess(todoFile string, rcvTitle *string, rcvContent *st
 			*rcvContent = content
 			return nil
 		})
-	p.LastSentFile = testLastSentFile
+	p.StateFile = testStateFile
 	return p
 }
 
-func setLastSentFileToToday() {
+func setDailySentToday() {
 	todoFile := writeTodoFile("")
 	var rcvTitle string
 	var rcvContent string
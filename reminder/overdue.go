@@ -0,0 +1,40 @@
+package reminder
+
+import (
+	"time"
+
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// OverdueMoment is an undone moment whose end date has passed.
+type OverdueMoment struct {
+	Moment   moment.Moment
+	End      time.Time
+	DaysLate int
+}
+
+// FindOverdueMoments returns all undone moments and sub moments whose end date lies before today.
+// Recurring moments are never overdue, since they simply occur again.
+func FindOverdueMoments(todos *moment.Todos, today time.Time) []*OverdueMoment {
+	return findOverdueMoments(todos.Moments, util.SetToStartOfDay(today))
+}
+
+func findOverdueMoments(moms []moment.Moment, today time.Time) []*OverdueMoment {
+	var res []*OverdueMoment
+	for _, m := range moms {
+		if m.IsDone() {
+			continue
+		}
+		single, ok := m.(*moment.SingleMoment)
+		if ok && single.End != nil {
+			end := util.SetToStartOfDay(single.End.Time)
+			if end.Before(today) {
+				daysLate := int(today.Sub(end).Hours()/24 + 0.5)
+				res = append(res, &OverdueMoment{Moment: m, End: single.End.Time, DaysLate: daysLate})
+			}
+		}
+		res = append(res, findOverdueMoments(m.GetSubMoments(), today)...)
+	}
+	return res
+}
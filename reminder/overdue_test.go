@@ -0,0 +1,33 @@
+package reminder
+
+import (
+	"testing"
+
+	"github.com/sandro-h/sibylgo/parse"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindOverdueMoments(t *testing.T) {
+	todos, _ := parse.String(`
+[] due yesterday (-3.1.19)
+[] due today (-4.1.19)
+[] ended a week ago (20.12.18-28.12.18)
+[x] done and late (1.1.19)
+[] undated
+	[] late sub (2.1.19)
+[] recurring (every monday)
+[] future (10.1.19)
+`)
+
+	overdue := FindOverdueMoments(todos, tu.Dtt("04.01.2019 13:00"))
+
+	var names []string
+	var daysLate []int
+	for _, o := range overdue {
+		names = append(names, o.Moment.GetName())
+		daysLate = append(daysLate, o.DaysLate)
+	}
+	assert.Equal(t, []string{"due yesterday", "ended a week ago", "late sub"}, names)
+	assert.Equal(t, []int{1, 7, 2}, daysLate)
+}
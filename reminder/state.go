@@ -0,0 +1,186 @@
+package reminder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// legacyLastSentFile is where earlier versions stored the day of the last daily reminder.
+var legacyLastSentFile = filepath.Join(os.TempDir(), "sibylgo_lastsent.txt")
+
+// reminderState is the persisted part of the StateStore.
+type reminderState struct {
+	// LastDaily is the day (2006-01-02) of the last sent daily reminder.
+	LastDaily string `json:"lastDaily"`
+	// Sent maps the key of every sent reminder to the due time of the reminded occurrence.
+	Sent map[string]time.Time `json:"sent"`
+	// Escalated contains the keys of the overdue moments that were escalated.
+	Escalated map[string]bool `json:"escalated,omitempty"`
+	// Vacation is the vacation set with SetVacation.
+	Vacation *Vacation `json:"vacation,omitempty"`
+	// WelcomedBack is the last day (2006-01-02) of the last vacation a welcome back digest was sent for.
+	WelcomedBack string `json:"welcomedBack,omitempty"`
+}
+
+// StateStore records the sent reminders in a file, so that reminders missed while the backend
+// was down can be caught up and no reminder is sent twice, even across restarts.
+type StateStore struct {
+	path  string
+	state reminderState
+	dirty bool
+	// noLegacy skips reading the legacyLastSentFile for a missing file.
+	noLegacy bool
+}
+
+// NewStateStore creates a StateStore persisted in the file at path.
+func NewStateStore(path string) *StateStore {
+	return &StateStore{path: path, state: reminderState{Sent: map[string]time.Time{}, Escalated: map[string]bool{}}}
+}
+
+// Load reads the state from the file. A missing file is an empty state.
+func (s *StateStore) Load() error {
+	s.state = reminderState{Sent: map[string]time.Time{}, Escalated: map[string]bool{}}
+	content, err := util.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		if !s.noLegacy {
+			s.state.LastDaily = readLegacyLastDaily()
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal([]byte(content), &s.state)
+	if err != nil {
+		return fmt.Errorf("could not read reminder state %s: %s", s.path, err)
+	}
+	if s.state.Sent == nil {
+		s.state.Sent = map[string]time.Time{}
+	}
+	if s.state.Escalated == nil {
+		s.state.Escalated = map[string]bool{}
+	}
+	return nil
+}
+
+// Save writes the state to the file if it changed. The file is replaced atomically so a crash cannot leave
+// a half-written state behind.
+func (s *StateStore) Save() error {
+	if !s.dirty {
+		return nil
+	}
+	content, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// LastDaily returns the day of the last sent daily reminder, or the zero time if none was sent yet.
+func (s *StateStore) LastDaily() time.Time {
+	dt, err := time.ParseInLocation("2006-01-02", s.state.LastDaily, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return dt
+}
+
+// SetLastDaily records that the daily reminder for the day was sent.
+func (s *StateStore) SetLastDaily(day time.Time) {
+	s.state.LastDaily = day.Format("2006-01-02")
+	s.dirty = true
+}
+
+// WasSent returns true if the reminder with the key was sent.
+func (s *StateStore) WasSent(key string) bool {
+	_, found := s.state.Sent[key]
+	return found
+}
+
+// MarkSent records that the reminder with the key for an occurrence due at the given time was sent.
+func (s *StateStore) MarkSent(key string, due time.Time) {
+	s.state.Sent[key] = due
+	s.dirty = true
+}
+
+// Prune forgets the reminders of occurrences that were due before the given time. They are never
+// sent again anyway.
+func (s *StateStore) Prune(before time.Time) {
+	for k, due := range s.state.Sent {
+		if due.Before(before) {
+			delete(s.state.Sent, k)
+			s.dirty = true
+		}
+	}
+}
+
+// WasEscalated returns true if the overdue moment with the key was escalated.
+func (s *StateStore) WasEscalated(key string) bool {
+	return s.state.Escalated[key]
+}
+
+// MarkEscalated records that the overdue moment with the key was escalated.
+func (s *StateStore) MarkEscalated(key string) {
+	s.state.Escalated[key] = true
+	s.dirty = true
+}
+
+// RetainEscalated forgets the escalations of all moments not in keys, e.g. because they were done.
+func (s *StateStore) RetainEscalated(keys map[string]bool) {
+	for k := range s.state.Escalated {
+		if !keys[k] {
+			delete(s.state.Escalated, k)
+			s.dirty = true
+		}
+	}
+}
+
+// Vacation returns the vacation set with SetVacation, or nil.
+func (s *StateStore) Vacation() *Vacation {
+	return s.state.Vacation
+}
+
+// SetVacation sets the vacation, nil clears it.
+func (s *StateStore) SetVacation(v *Vacation) {
+	s.state.Vacation = v
+	s.dirty = true
+}
+
+// WelcomedBack returns the last day of the last vacation a welcome back digest was sent for, or the zero time.
+func (s *StateStore) WelcomedBack() time.Time {
+	dt, err := time.ParseInLocation("2006-01-02", s.state.WelcomedBack, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return dt
+}
+
+// SetWelcomedBack records that the welcome back digest for the vacation ending on the day was sent.
+func (s *StateStore) SetWelcomedBack(day time.Time) {
+	s.state.WelcomedBack = day.Format("2006-01-02")
+	s.dirty = true
+}
+
+func readLegacyLastDaily() string {
+	content, err := util.ReadFile(legacyLastSentFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,132 @@
+package reminder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/instances"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/query"
+)
+
+// Filter selects the todos a subscription gets reminders for, by category and tag (e.g. @alice).
+// A todo matches if it is in one of the categories and it, one of its parents or one of its sub todos
+// has one of the tags. Empty lists match all todos.
+type Filter struct {
+	categories []*query.Query
+	tags       []*query.Query
+}
+
+// NewFilter creates a filter for the categories and tags. Tags are given without the @.
+func NewFilter(categories []string, tags []string) (*Filter, error) {
+	f := &Filter{}
+	for _, c := range categories {
+		q, err := query.Parse(`cat:"` + c + `"`)
+		if err != nil || strings.ContainsAny(c, `"`) {
+			return nil, fmt.Errorf("invalid category %s", c)
+		}
+		f.categories = append(f.categories, q)
+	}
+	for _, t := range tags {
+		t = strings.TrimPrefix(t, "@")
+		q, err := query.Parse("tag:" + t)
+		if err != nil || t == "" || strings.ContainsAny(t, " \t\"") {
+			return nil, fmt.Errorf("invalid tag %s", t)
+		}
+		f.tags = append(f.tags, q)
+	}
+	return f, nil
+}
+
+// momentSet is a set of moments. A nil set contains all moments.
+type momentSet map[moment.Moment]bool
+
+func (s momentSet) has(m moment.Moment) bool {
+	return s == nil || s[m]
+}
+
+// matching returns the moments and sub moments matching the filter, or nil (all moments) if f is nil.
+func (f *Filter) matching(todos *moment.Todos, today time.Time) momentSet {
+	if f == nil {
+		return nil
+	}
+	res := make(momentSet)
+	for _, m := range todos.Moments {
+		if matchesAny(f.categories, m, today) {
+			f.addTagged(res, m, len(f.tags) == 0, today)
+		}
+	}
+	return res
+}
+
+// addTagged adds the moment if it or one of its sub moments is tagged, or if a parent is tagged. Returns true
+// if the moment was added.
+func (f *Filter) addTagged(res momentSet, m moment.Moment, parentTagged bool, today time.Time) bool {
+	tagged := parentTagged || (len(f.tags) > 0 && matchesAny(f.tags, m, today))
+	added := tagged
+	for _, sub := range m.GetSubMoments() {
+		if f.addTagged(res, sub, tagged, today) {
+			added = true
+		}
+	}
+	if added {
+		res[m] = true
+	}
+	return added
+}
+
+func matchesAny(queries []*query.Query, m moment.Moment, today time.Time) bool {
+	if len(queries) == 0 {
+		return true
+	}
+	for _, q := range queries {
+		if q.Matches(m, today) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterInstances keeps the instances of the moments in the set, and their sub instances in the set.
+func filterInstances(insts []*instances.Instance, keep momentSet) []*instances.Instance {
+	if keep == nil {
+		return insts
+	}
+	var res []*instances.Instance
+	for _, inst := range insts {
+		if keep.has(inst.Moment) {
+			c := inst.CloneShallow()
+			c.SubInstances = filterInstances(inst.SubInstances, keep)
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func filterOverdue(overdue []*OverdueMoment, keep momentSet) []*OverdueMoment {
+	if keep == nil {
+		return overdue
+	}
+	var res []*OverdueMoment
+	for _, o := range overdue {
+		if keep.has(o.Moment) {
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// newStateStore creates the store of the StateFile. The legacy file was written by the unfiltered reminders of
+// earlier versions, so it does not apply to filtered ones.
+func (p *MailReminderProcess) newStateStore() *StateStore {
+	st := NewStateStore(p.StateFile)
+	st.noLegacy = p.Filter != nil
+	return st
+}
+
+// SubscriptionStateFile returns the file recording the sent reminders of a subscription, next to the state file
+// of the reminders.
+func SubscriptionStateFile(stateFile string, name string) string {
+	return strings.TrimSuffix(stateFile, ".json") + "-" + name + ".json"
+}
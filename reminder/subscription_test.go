@@ -0,0 +1,123 @@
+package reminder
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const subscriptionTodos = `------------------
+ Work
+------------------
+[] deploy (5.1.19 13:15)
+[] release @alice (5.1.19)
+	[] changelog (5.1.19)
+[] planning (5.1.19)
+	[] slides @alice (5.1.19)
+	[] room (5.1.19)
+[] report (-1.1.19)
+------------------
+ Home
+------------------
+[] groceries @alice (5.1.19 13:10)
+[] vacation (5.1.19) #vacation-bob
+`
+
+func TestSubscription_Category(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(subscriptionTodos)
+	util.WriteFile(legacyLastSentFile, "2019-01-05")
+	defer os.Remove(legacyLastSentFile)
+	n := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, n, n)
+	p.StateFile = testStateFile
+	p.Filter, _ = NewFilter([]string{"work"}, nil)
+
+	p.CheckOnce()
+
+	assert.Equal(t, 2, len(n.msgs), "legacy daily reminder does not apply")
+	assert.Equal(t, "TODOs for Saturday, 5 Jan 2019", n.msgs[0].Title)
+	assert.Equal(t, `[Work]
+- deploy 13:15
+- release @alice
+  - changelog
+- planning
+  - slides @alice
+  - room
+
+Overdue:
+- report (4 days late)
+`, n.msgs[0].Text)
+	assert.Equal(t, "Reminder for deploy in 13min", n.msgs[1].Title)
+}
+
+func TestSubscription_Tags(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(subscriptionTodos)
+	n := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, n, n)
+	p.StateFile = testStateFile
+	p.Filter, _ = NewFilter(nil, []string{"@Alice"})
+
+	p.CheckOnce()
+
+	assert.Equal(t, 2, len(n.msgs), "not paused by the vacation of another subscription")
+	assert.Equal(t, `[Work]
+- release @alice
+  - changelog
+- planning
+  - slides @alice
+[Home]
+- groceries @alice 13:10
+`, n.msgs[0].Text)
+	assert.Equal(t, "Reminder for groceries @alice in 8min", n.msgs[1].Title)
+}
+
+func TestSubscription_Vacation(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(subscriptionTodos)
+	n := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, n, n)
+	p.StateFile = testStateFile
+	p.Filter, _ = NewFilter([]string{"Home"}, nil)
+
+	p.CheckOnce()
+
+	assert.Equal(t, 0, len(n.msgs))
+}
+
+func TestSubscription_SharedVacation(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(subscriptionTodos)
+	v, _ := ParseVacation("2019-01-04", "2019-01-06")
+	SetVacation(testStateFile, v)
+	n := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, n, n)
+	p.StateFile = SubscriptionStateFile(testStateFile, "alice")
+	defer os.Remove(p.StateFile)
+	p.VacationStateFile = testStateFile
+	p.Filter, _ = NewFilter(nil, []string{"alice"})
+
+	p.CheckOnce()
+
+	assert.Equal(t, 0, len(n.msgs), "paused by the vacation set for the reminders")
+}
+
+func TestNewFilter_Invalid(t *testing.T) {
+	_, err := NewFilter(nil, []string{"two words"})
+	assert.EqualError(t, err, "invalid tag two words")
+	_, err = NewFilter([]string{`"quoted"`}, nil)
+	assert.EqualError(t, err, `invalid category "quoted"`)
+}
+
+func TestSubscriptionStateFile(t *testing.T) {
+	assert.Equal(t, "/tmp/todo-reminders-alice.json", SubscriptionStateFile("/tmp/todo-reminders.json", "alice"))
+}
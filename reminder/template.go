@@ -0,0 +1,258 @@
+package reminder
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/sandro-h/sibylgo/instances"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/notify"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// Template files of the digests. They can be overridden by files with the same name in the template dir.
+const (
+	DigestHTMLTemplate = "digest.html.tmpl"
+	DigestTextTemplate = "digest.txt.tmpl"
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+var templateFuncs = map[string]interface{}{
+	"indent": func(depth int) string { return strings.Repeat("  ", depth) },
+}
+
+// Digest is the data the digest templates are rendered with.
+type Digest struct {
+	Title    string
+	Sections []*DigestSection
+	Overdue  []*DigestMoment
+}
+
+// DigestSection is a list of moments, e.g. the ones due today.
+type DigestSection struct {
+	// Title is empty if the digest has only one section.
+	Title  string
+	Groups []*DigestGroup
+}
+
+// DigestGroup are the moments of a section in the same category.
+type DigestGroup struct {
+	// Category is empty for moments without category.
+	Category string
+	Color    string
+	Moments  []*DigestMoment
+}
+
+// DigestMoment is a moment in a digest.
+type DigestMoment struct {
+	Name string
+	// Day is the due day, only set in sections spanning several days.
+	Day string
+	// Time is the time of day, if set.
+	Time     string
+	Priority int
+	// Due is true if the moment is due in the section, not only ongoing.
+	Due      bool
+	DaysLate int
+	Comments []string
+	// Link opens the moment's line in the todo file in VSCode.
+	Link htmltemplate.URL
+	// Actions are the links to complete or snooze the moment, if action links are configured.
+	Actions []notify.Action
+	Depth   int
+	Subs    []*DigestMoment
+}
+
+// allActions returns the action links of all moments in the digest, labeled with the moment name, e.g.
+// "report: Done".
+func (d *Digest) allActions() []notify.Action {
+	var res []notify.Action
+	for _, s := range d.Sections {
+		for _, g := range s.Groups {
+			res = appendActions(res, g.Moments)
+		}
+	}
+	return appendActions(res, d.Overdue)
+}
+
+func appendActions(res []notify.Action, moms []*DigestMoment) []notify.Action {
+	for _, m := range moms {
+		for _, a := range m.Actions {
+			res = append(res, notify.Action{Label: m.Name + ": " + a.Label, URL: a.URL})
+		}
+		res = appendActions(res, m.Subs)
+	}
+	return res
+}
+
+// PriorityMarks returns the priority as exclamation marks, like in the todo file.
+func (m *DigestMoment) PriorityMarks() string {
+	return strings.Repeat("!", m.Priority)
+}
+
+// DaysLateText returns e.g. "3 days late".
+func (m *DigestMoment) DaysLateText() string {
+	return formatDaysLate(m.DaysLate)
+}
+
+// Templates renders digests to HTML and plain text.
+type Templates struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// LoadTemplates loads the digest templates. Templates in dir override the default ones, dir can be empty.
+func LoadTemplates(dir string) (*Templates, error) {
+	if dir != "" {
+		st, err := os.Stat(util.ExpandHome(dir))
+		if err != nil || !st.IsDir() {
+			return nil, fmt.Errorf("reminder template dir %s does not exist", dir)
+		}
+	}
+	htmlSrc, err := readTemplate(dir, DigestHTMLTemplate)
+	if err != nil {
+		return nil, err
+	}
+	textSrc, err := readTemplate(dir, DigestTextTemplate)
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{}
+	t.html, err = htmltemplate.New(DigestHTMLTemplate).Funcs(templateFuncs).Parse(htmlSrc)
+	if err != nil {
+		return nil, fmt.Errorf("reminder templates: %s", err)
+	}
+	t.text, err = texttemplate.New(DigestTextTemplate).Funcs(templateFuncs).Parse(textSrc)
+	if err != nil {
+		return nil, fmt.Errorf("reminder templates: %s", err)
+	}
+	return t, nil
+}
+
+func readTemplate(dir string, name string) (string, error) {
+	if dir != "" {
+		path := filepath.Join(util.ExpandHome(dir), name)
+		if util.Exists(path) {
+			content, err := util.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("reminder template %s: %s", path, err)
+			}
+			return content, nil
+		}
+	}
+	content, err := defaultTemplates.ReadFile("templates/" + name)
+	return string(content), err
+}
+
+// Render renders the digest as HTML and plain text.
+func (t *Templates) Render(d *Digest) (string, string, error) {
+	var html, text strings.Builder
+	err := t.html.Execute(&html, d)
+	if err != nil {
+		return "", "", err
+	}
+	err = t.text.Execute(&text, d)
+	if err != nil {
+		return "", "", err
+	}
+	return html.String(), text.String(), nil
+}
+
+// newDigestSection groups the moment instances by category.
+func (p *MailReminderProcess) newDigestSection(title string, insts []*instances.Instance, withDay bool) *DigestSection {
+	section := &DigestSection{Title: title}
+	groups := make(map[string]*DigestGroup)
+	for _, inst := range insts {
+		cat := ""
+		if inst.Category != nil {
+			cat = inst.Category.Name
+		}
+		g, found := groups[cat]
+		if !found {
+			g = &DigestGroup{Category: cat}
+			if inst.Category != nil {
+				g.Color = inst.Category.Color
+			}
+			groups[cat] = g
+			section.Groups = append(section.Groups, g)
+		}
+		g.Moments = append(g.Moments, p.newDigestMoment(inst, withDay, 0))
+	}
+	return section
+}
+
+func (p *MailReminderProcess) newDigestMoment(inst *instances.Instance, withDay bool, depth int) *DigestMoment {
+	m := &DigestMoment{
+		Name:     inst.Name,
+		Priority: inst.Priority,
+		Due:      inst.EndsInRange,
+		Comments: nonEmpty(inst.Comments),
+		Link:     lineLink(p.todoFilePath, inst.OriginDocCoords),
+		Actions:  p.actionLinks(inst.Moment),
+		Depth:    depth,
+	}
+	if withDay && inst.EndsInRange {
+		m.Day = inst.End.Format("Mon 2 Jan")
+	}
+	if inst.TimeOfDay != nil {
+		m.Time = inst.TimeOfDay.Format("15:04")
+	}
+	for _, sub := range inst.SubInstances {
+		m.Subs = append(m.Subs, p.newDigestMoment(sub, withDay, depth+1))
+	}
+	return m
+}
+
+func (p *MailReminderProcess) newOverdueDigestMoments(overdue []*OverdueMoment) []*DigestMoment {
+	var res []*DigestMoment
+	for _, o := range overdue {
+		var comments []string
+		for _, c := range o.Moment.GetComments() {
+			comments = append(comments, c.Content)
+		}
+		res = append(res, &DigestMoment{
+			Name:     o.Moment.GetName(),
+			Priority: o.Moment.GetPriority(),
+			Due:      true,
+			DaysLate: o.DaysLate,
+			Comments: nonEmpty(comments),
+			Link:     lineLink(p.todoFilePath, o.Moment.GetDocCoords()),
+			Actions:  p.actionLinks(o.Moment),
+		})
+	}
+	return res
+}
+
+// lineLink returns a link opening the line in VSCode, e.g. vscode://file/home/me/todo.txt:12.
+func lineLink(todoFilePath string, coords moment.DocCoords) htmltemplate.URL {
+	if todoFilePath == "" {
+		return ""
+	}
+	path, err := filepath.Abs(todoFilePath)
+	if err != nil {
+		return ""
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths, e.g. vscode://file/C:/todo.txt
+		path = "/" + path
+	}
+	return htmltemplate.URL(fmt.Sprintf("vscode://file%s:%d", path, coords.LineNumber+1))
+}
+
+func nonEmpty(lines []string) []string {
+	var res []string
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			res = append(res, strings.TrimSpace(l))
+		}
+	}
+	return res
+}
@@ -0,0 +1,125 @@
+package reminder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sandro-h/sibylgo/actions"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyReminder_Template(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 08:00") }
+	todoFile := writeTodoFile(`------------------
+ Work [Coral]
+------------------
+[] deploy <script>!! (5.1.19 14:00)
+	check the <b>logs</b>
+------------------
+ Home
+------------------
+[] groceries (5.1.19)
+`)
+	daily := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, nil)
+	p.StateFile = testStateFile
+
+	p.CheckOnce()
+
+	assert.Equal(t, `<h4 style="color: Coral">Work</h4>
+<ul>
+<li>`+todoLink(4)+`<b>deploy &lt;script&gt;</b></a> <i>14:00</i> <span style="color: red">!!</span><br>
+<small style="color: gray">check the &lt;b&gt;logs&lt;/b&gt;</small></li>
+</ul>
+<h4>Home</h4>
+<ul>
+<li>`+todoLink(9)+`<b>groceries</b></a></li>
+</ul>
+`, daily.msgs[0].HTML)
+	assert.Equal(t, `[Work]
+- deploy <script> 14:00 !!
+    check the <b>logs</b>
+[Home]
+- groceries
+`, daily.msgs[0].Text)
+}
+
+func TestLoadTemplates_Override(t *testing.T) {
+	dir := tu.MakeTempDir("sibyl_reminder_templates")
+	defer tu.DeleteTempDir(dir)
+	util.WriteFile(filepath.Join(dir, DigestTextTemplate),
+		`{{.Title}}:{{range .Sections}}{{range .Groups}}{{range .Moments}} {{.Name}}{{end}}{{end}}{{end}}`)
+
+	tmpl, err := LoadTemplates(dir)
+	assert.NoError(t, err)
+	html, text, err := tmpl.Render(&Digest{Title: "Today", Sections: []*DigestSection{
+		{Groups: []*DigestGroup{{Moments: []*DigestMoment{{Name: "foo"}, {Name: "bar"}}}}},
+	}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Today: foo bar\n", text)
+	assert.Equal(t, "<ul>\n<li>foo</li>\n<li>bar</li>\n</ul>\n", html, "default HTML template")
+}
+
+func TestLoadTemplates_Invalid(t *testing.T) {
+	dir := tu.MakeTempDir("sibyl_reminder_templates")
+	defer tu.DeleteTempDir(dir)
+	util.WriteFile(filepath.Join(dir, DigestHTMLTemplate), "{{range .Sections}")
+
+	_, err := LoadTemplates(dir)
+	tu.AssertContains(t, "reminder templates: template: digest.html.tmpl:1:", err.Error())
+
+	_, err = LoadTemplates(filepath.Join(os.TempDir(), "sibyl_no_such_dir"))
+	tu.AssertContains(t, "sibyl_no_such_dir does not exist", err.Error())
+}
+
+func TestTimedReminder_Escaped(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(`
+[] <b>foo</b> (5.1.19 13:15)
+`)
+	timed := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, nil, timed)
+	p.StateFile = testStateFile
+
+	p.CheckOnce()
+
+	assert.Equal(t, "<b>foo</b> starts at 13:15", timed.msgs[0].Text)
+	assert.Equal(t, "&lt;b&gt;foo&lt;/b&gt; starts at 13:15", timed.msgs[0].HTML)
+}
+
+func TestReminders_ActionLinks(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(`
+[] foo (5.1.19 13:15)
+[] weekly (every saturday)
+`)
+	daily := &recordingNotifier{}
+	timed := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, timed)
+	p.StateFile = testStateFile
+	p.Actions = &actions.Signer{Key: []byte("0123456789abcdef"), BaseURL: "http://localhost:8082", Expiry: actions.DefaultExpiry}
+
+	p.CheckOnce()
+
+	msg := timed.msgs[0]
+	assert.Equal(t, 3, len(msg.Actions))
+	assert.Equal(t, "Done", msg.Actions[0].Label)
+	tu.AssertContains(t, "foo starts at 13:15\n\nDone: http://localhost:8082/actions/", msg.Text)
+	tu.AssertContains(t, `<p><a href="http://localhost:8082/actions/`, msg.HTML)
+	tu.AssertContains(t, `<br>
+<small><a href="http://localhost:8082/actions/`, daily.msgs[0].HTML)
+	assert.Equal(t, 3, strings.Count(daily.msgs[0].HTML, "/actions/"), "no actions for recurring moments")
+	tu.AssertContains(t, "- foo 13:15\n    Done: http://localhost:8082/actions/", daily.msgs[0].Text)
+	assert.Equal(t, 3, strings.Count(daily.msgs[0].Text, "/actions/"))
+	assert.Equal(t, 3, len(daily.msgs[0].Actions))
+	assert.Equal(t, "foo: Done", daily.msgs[0].Actions[0].Label)
+}
@@ -0,0 +1,209 @@
+package reminder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// VacationID is the ID of moments marking a vacation, e.g. "[] vacation (10.11.20-15.11.20) #vacation".
+// IDs starting with "vacation-" mark vacations too, so several can be planned.
+const VacationID = "vacation"
+
+// welcomeBackDays is how long after a vacation the welcome back digest is still sent, e.g. if the backend was down.
+const welcomeBackDays = 7
+
+// stateMu guards the state file against concurrent checks and vacation changes.
+var stateMu sync.Mutex
+
+// Vacation is a range of days, inclusive, during which only critical reminders are sent.
+// In JSON, it is {"from": "2020-11-10", "to": "2020-11-15"}.
+type Vacation struct {
+	From time.Time
+	To   time.Time
+}
+
+type vacationJSON struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// NewVacation creates a vacation from the start of the from day to the end of the to day.
+func NewVacation(from time.Time, to time.Time) (*Vacation, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("vacation ends on %s before it starts on %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+	return &Vacation{From: util.SetToStartOfDay(from), To: util.SetToEndOfDay(to)}, nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v Vacation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vacationJSON{From: v.From.Format("2006-01-02"), To: v.To.Format("2006-01-02")})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *Vacation) UnmarshalJSON(data []byte) error {
+	var raw vacationJSON
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseVacation(raw.From, raw.To)
+	if err != nil {
+		return err
+	}
+	*v = *parsed
+	return nil
+}
+
+// ParseVacation creates a vacation from ISO dates like 2020-11-10.
+func ParseVacation(from string, to string) (*Vacation, error) {
+	fromDay, err := util.ParseISODate(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vacation start %s, must be like 2020-11-10", from)
+	}
+	toDay, err := util.ParseISODate(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vacation end %s, must be like 2020-11-15", to)
+	}
+	return NewVacation(fromDay, toDay)
+}
+
+// Contains returns true if t is during the vacation.
+func (v *Vacation) Contains(t time.Time) bool {
+	return !t.Before(v.From) && !t.After(v.To)
+}
+
+// IsVacationMoment returns true if the moment marks a vacation, see VacationID.
+func IsVacationMoment(m moment.Moment) bool {
+	id := m.GetID()
+	return id != nil && (id.Value == VacationID || strings.HasPrefix(id.Value, VacationID+"-"))
+}
+
+// GetVacation returns the vacation recorded in the reminder state file with SetVacation, or nil.
+func GetVacation(stateFile string) (*Vacation, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := NewStateStore(stateFile)
+	err := st.Load()
+	if err != nil {
+		return nil, err
+	}
+	return st.Vacation(), nil
+}
+
+// SetVacation records the vacation in the reminder state file, e.g. when set over the REST API.
+// Nil clears it.
+func SetVacation(stateFile string, v *Vacation) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := NewStateStore(stateFile)
+	err := st.Load()
+	if err != nil {
+		return err
+	}
+	st.SetVacation(v)
+	return st.Save()
+}
+
+// vacations returns the vacations from the config, the state and the vacation moments in the set.
+func (p *MailReminderProcess) vacations(todos *moment.Todos, st *StateStore, keep momentSet) []*Vacation {
+	var res []*Vacation
+	if p.Vacation != nil {
+		res = append(res, p.Vacation)
+	}
+	if v := p.stateVacation(st); v != nil {
+		res = append(res, v)
+	}
+	for _, m := range todos.Moments {
+		single, ok := m.(*moment.SingleMoment)
+		if !ok || !IsVacationMoment(m) || !keep.has(m) {
+			continue
+		}
+		from, to := single.Start, single.End
+		if from == nil {
+			from = to
+		}
+		if to == nil {
+			to = from
+		}
+		if from == nil {
+			continue
+		}
+		v, err := NewVacation(from.Time, to.Time)
+		if err == nil {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// stateVacation returns the vacation set with SetVacation, from the VacationStateFile if set. The caller holds
+// stateMu.
+func (p *MailReminderProcess) stateVacation(st *StateStore) *Vacation {
+	if p.VacationStateFile == "" || p.VacationStateFile == p.StateFile {
+		return st.Vacation()
+	}
+	shared := NewStateStore(p.VacationStateFile)
+	err := shared.Load()
+	if err != nil {
+		log.Errorf("Could not load vacation: %s\n", err)
+		return nil
+	}
+	return shared.Vacation()
+}
+
+// loadVacations returns the vacations, reading the ones set with SetVacation from the StateFile.
+func (p *MailReminderProcess) loadVacations(todos *moment.Todos, keep momentSet) ([]*Vacation, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := p.newStateStore()
+	err := st.Load()
+	if err != nil {
+		return nil, err
+	}
+	return p.vacations(todos, st, keep), nil
+}
+
+// activeVacation returns the vacation t is in, or nil.
+func activeVacation(vacations []*Vacation, t time.Time) *Vacation {
+	for _, v := range vacations {
+		if v.Contains(t) {
+			return v
+		}
+	}
+	return nil
+}
+
+// welcomeBackVacation returns the vacation that ended last before today if no welcome back digest was sent for
+// it yet, or nil.
+func welcomeBackVacation(st *StateStore, vacations []*Vacation, today time.Time) *Vacation {
+	var last *Vacation
+	for _, v := range vacations {
+		if v.To.Before(today) && (last == nil || v.To.After(last.To)) {
+			last = v
+		}
+	}
+	if last == nil || last.To.Before(today.AddDate(0, 0, -welcomeBackDays)) ||
+		!st.WelcomedBack().Before(util.SetToStartOfDay(last.To)) {
+		return nil
+	}
+	return last
+}
+
+// withoutVacationMoments returns the todos without the vacation moments, so they are not reminded of.
+func withoutVacationMoments(todos *moment.Todos) *moment.Todos {
+	res := &moment.Todos{Categories: todos.Categories, MomentsByID: todos.MomentsByID}
+	for _, m := range todos.Moments {
+		if !IsVacationMoment(m) {
+			res.Moments = append(res.Moments, m)
+		}
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+package reminder
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVacation_SuppressesReminders(t *testing.T) {
+	defer startup()
+	getNow = func() time.Time { return tu.Dtt("05.01.2019 13:02") }
+	todoFile := writeTodoFile(`
+[] vacation (5.1.19-6.1.19) #vacation
+[] foo (5.1.19 13:15)
+[] urgent!! (5.1.19 13:15)
+[] late (-20.12.18)
+[] dentist (9.1.19)
+`)
+	daily := &recordingNotifier{}
+	timed := &recordingNotifier{}
+	escalation := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, timed)
+	p.StateFile = testStateFile
+	p.Escalation = escalation
+
+	p.CheckOnce()
+
+	assert.Equal(t, 0, len(daily.msgs))
+	assert.Equal(t, 1, len(timed.msgs), "only critical reminders")
+	assert.Equal(t, "Reminder for urgent in 13min", timed.msgs[0].Title)
+	assert.True(t, timed.msgs[0].Critical)
+	assert.Equal(t, 0, len(escalation.msgs))
+
+	getNow = func() time.Time { return tu.Dtt("07.01.2019 08:00") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("07.01.2019 08:05") }
+	p.CheckOnce()
+
+	assert.Equal(t, 1, len(daily.msgs))
+	assert.Equal(t, "Welcome back! TODOs for Monday, 7 Jan 2019", daily.msgs[0].Title)
+	assert.Equal(t, `Today:
+None
+
+This week:
+- Wed 9 Jan: dentist
+
+Overdue:
+- foo (2 days late)
+- urgent !! (2 days late)
+- late (18 days late)
+`, daily.msgs[0].Text)
+	assert.Equal(t, 0, len(escalation.msgs), "not escalated after the vacation")
+
+	getNow = func() time.Time { return tu.Dtt("08.01.2019 08:00") }
+	p.CheckOnce()
+
+	assert.Equal(t, "TODOs for Tuesday, 8 Jan 2019", daily.msgs[1].Title)
+}
+
+func TestVacation_FromState(t *testing.T) {
+	defer startup()
+	todoFile := writeTodoFile(`
+[] foo (7.1.19)
+`)
+	daily := &recordingNotifier{}
+	weekly := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, nil)
+	p.StateFile = testStateFile
+	p.Weekly = weekly
+	v, _ := ParseVacation("2019-01-07", "2019-01-08")
+
+	assert.NoError(t, SetVacation(testStateFile, v))
+	getNow = func() time.Time { return tu.Dtt("07.01.2019 08:00") }
+	p.CheckOnce()
+	p.SendWeeklyDigest()
+
+	assert.Equal(t, 0, len(daily.msgs))
+	assert.Equal(t, 0, len(weekly.msgs))
+	stored, err := GetVacation(testStateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, v, stored)
+
+	assert.NoError(t, SetVacation(testStateFile, nil))
+	getNow = func() time.Time { return tu.Dtt("08.01.2019 08:00") }
+	p.CheckOnce()
+
+	assert.Equal(t, "TODOs for Tuesday, 8 Jan 2019", daily.msgs[0].Title, "no welcome back once cleared")
+}
+
+func TestVacation_FromConfig(t *testing.T) {
+	defer startup()
+	todoFile := writeTodoFile(`
+[] foo (7.1.19)
+`)
+	daily := &recordingNotifier{}
+	p := NewReminderProcess(todoFile, daily, nil)
+	p.StateFile = testStateFile
+	p.Vacation, _ = ParseVacation("2018-12-24", "2019-01-06")
+
+	getNow = func() time.Time { return tu.Dtt("06.01.2019 08:00") }
+	p.CheckOnce()
+	getNow = func() time.Time { return tu.Dtt("07.01.2019 08:00") }
+	p.CheckOnce()
+
+	assert.Equal(t, 1, len(daily.msgs))
+	assert.Equal(t, "Welcome back! TODOs for Monday, 7 Jan 2019", daily.msgs[0].Title)
+	assert.Equal(t, util.SetToEndOfDay(tu.Dt("07.01.2019")), daily.msgs[0].Expires)
+}
+
+func TestVacation_JSON(t *testing.T) {
+	v, err := ParseVacation("2020-11-10", "2020-11-15")
+	assert.NoError(t, err)
+	assert.Equal(t, tu.Dt("10.11.2020"), v.From)
+	assert.True(t, v.Contains(tu.Dtt("15.11.2020 23:59")))
+	assert.False(t, v.Contains(tu.Dt("16.11.2020")))
+
+	data, _ := json.Marshal(v)
+	assert.Equal(t, `{"from":"2020-11-10","to":"2020-11-15"}`, string(data))
+	var parsed Vacation
+	assert.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, *v, parsed)
+
+	_, err = ParseVacation("2020-11-15", "2020-11-10")
+	assert.EqualError(t, err, "vacation ends on 2020-11-10 before it starts on 2020-11-15")
+	_, err = ParseVacation("10.11.20", "2020-11-15")
+	assert.EqualError(t, err, "invalid vacation start 10.11.20, must be like 2020-11-10")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sandro-h/sibylgo/actions"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// actionPage is shown for action links opened in the browser. The action is only applied by the form POST,
+// so mail scanners following links do not apply it.
+var actionPage = template.Must(template.New("action").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>sibylgo</title></head>
+<body style="font-family: sans-serif">
+<p>{{.Message}}</p>
+{{if .Confirm}}<form method="POST"><button type="submit">{{.Confirm}}</button></form>
+{{end}}</body>
+</html>
+`))
+
+// getAction shows what the action link does, with a button to apply it. Like postAction, it answers with JSON
+// instead of a page if the client accepts it.
+func getAction(w http.ResponseWriter, r *http.Request) {
+	signer := currentActionSigner()
+	if !requireActions(w, r, signer, currentFiles()) {
+		return
+	}
+	c, err := signer.Verify(mux.Vars(r)["token"])
+	if err != nil {
+		writeActionResult(w, r, actionErrorStatus(err), err.Error(), "")
+		return
+	}
+	if acceptsJSON(r) {
+		writeActionResult(w, r, http.StatusOK, c.Describe(), "")
+		return
+	}
+	writeActionResult(w, r, http.StatusOK, c.Describe()+"?", "Confirm")
+}
+
+// postAction applies the action link to the todo file.
+func postAction(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	signer := currentActionSigner()
+	if !requireActions(w, r, signer, files) {
+		return
+	}
+	result, err := actions.Apply(files, signer, mux.Vars(r)["token"])
+	if err != nil {
+		status := actionErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			reqLog(r).Errorf("Could not apply action: %s\n", err)
+		}
+		writeActionResult(w, r, status, err.Error(), "")
+		return
+	}
+	reqLog(r).Infof("Applied action link: %s\n", result)
+	writeActionResult(w, r, http.StatusOK, result+".", "")
+}
+
+func requireActions(w http.ResponseWriter, r *http.Request, signer *actions.Signer, files *util.FileConfig) bool {
+	if signer == nil || files.TodoFile == "" {
+		writeActionResult(w, r, http.StatusServiceUnavailable, "Action links are not configured.", "")
+		return false
+	}
+	return true
+}
+
+func actionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, actions.ErrInvalidToken):
+		return http.StatusForbidden
+	case errors.Is(err, actions.ErrExpired), errors.Is(err, actions.ErrUsed), errors.Is(err, actions.ErrAlreadyDone):
+		return http.StatusGone
+	case errors.Is(err, actions.ErrMomentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, util.ErrWriteConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+var actionErrorCodes = map[int]string{
+	http.StatusForbidden:           errCodeUnauthorized,
+	http.StatusGone:                errCodeGone,
+	http.StatusNotFound:            errCodeNotFound,
+	http.StatusConflict:            errCodeWriteConflict,
+	http.StatusServiceUnavailable:  errCodeNotConfigured,
+	http.StatusInternalServerError: errCodeInternal,
+}
+
+// writeActionResult writes the page with the message and a confirm button if confirm is set, or the message as
+// JSON if the client accepts it.
+func writeActionResult(w http.ResponseWriter, r *http.Request, status int, message string, confirm string) {
+	if acceptsJSON(r) {
+		if status != http.StatusOK {
+			writeError(w, r, status, actionErrorCodes[status], message)
+			return
+		}
+		setJSONContentType(w)
+		json.NewEncoder(w).Encode(map[string]string{"message": message})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	actionPage.Execute(w, map[string]string{"Message": message, "Confirm": confirm})
+}
+
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
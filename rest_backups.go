@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sandro-h/sibylgo/backup"
+)
+
+var errNoRetentionPolicy = errors.New("no backup retention policy configured")
+
+func getBackups(w http.ResponseWriter, r *http.Request) {
+	if !requireTodoFile(w, r) {
+		return
+	}
+	backups, err := listBackups()
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(backups)
+}
+
+func getBackup(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	b, err := backup.GetBackup(files, id)
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	content, err := backup.Content(files, b.Identifier)
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+
+	res := struct {
+		*backup.Backup
+		Content string `json:"content"`
+	}{b, content}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(res)
+}
+
+func getBackupDiff(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	diff, err := backup.Diff(files, mux.Vars(r)["id"], r.FormValue("against"))
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	fmt.Fprint(w, diff)
+}
+
+func restoreBackup(w http.ResponseWriter, r *http.Request) {
+	if !requireTodoFile(w, r) {
+		return
+	}
+	restored, err := doRestoreBackup(mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	reqLog(r).Infof("%s\n", restored.Message)
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(restored)
+}
+
+func pruneBackupsNow(w http.ResponseWriter, r *http.Request) {
+	if !requireTodoFile(w, r) {
+		return
+	}
+	report, err := pruneBackups(r.FormValue("dryRun") == "true")
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(report)
+}
+
+// listBackups returns all backups, newest first. It returns an empty list if no backup was made yet.
+func listBackups() ([]*backup.Backup, error) {
+	files := currentFiles()
+	backups, err := backup.ListBackups(files)
+	if err != nil {
+		return nil, err
+	}
+	if backups == nil {
+		backups = make([]*backup.Backup, 0)
+	}
+	return backups, nil
+}
+
+// doRestoreBackup backs up the current state and then restores the backup with the id.
+func doRestoreBackup(id string) (*backup.Backup, error) {
+	files := currentFiles()
+	b, err := backup.GetBackup(files, id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = backup.Save(files, "Backup before restoring")
+	if err != nil {
+		return nil, err
+	}
+	return backup.Restore(files, b)
+}
+
+// pruneBackups applies the configured retention policy to the backups.
+func pruneBackups(dryRun bool) (*backup.PruneReport, error) {
+	files := currentFiles()
+	configMutex.Lock()
+	backupCfg := currentCfg.GetSubConfig("backup")
+	configMutex.Unlock()
+	if !backupCfg.HasKey("retention") {
+		return nil, errNoRetentionPolicy
+	}
+	policy, err := backup.ParseRetentionPolicy(backupCfg.GetSubConfig("retention"))
+	if err != nil {
+		return nil, err
+	}
+	return doPruneBackups(backupCfg, files, policy, dryRun)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/history"
+	"github.com/sandro-h/sibylgo/modify"
+	"github.com/sandro-h/sibylgo/moment"
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/util"
+	log "github.com/sirupsen/logrus"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Error codes returned in the error envelope, so clients can react without parsing messages.
+const (
+	errCodeBadRequest       = "bad_request"
+	errCodeInvalidBody      = "invalid_body"
+	errCodeParse            = "parse_error"
+	errCodeMissingCategory  = "missing_category"
+	errCodeWriteConflict    = "write_conflict"
+	errCodeNotFound         = "not_found"
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeConflict         = "conflict"
+	errCodeNotConfigured    = "not_configured"
+	errCodeGone             = "gone"
+	errCodeInternal         = "internal_error"
+)
+
+type requestIDKey struct{}
+
+// apiError is the body of every error response, wrapped as {"error": ...}.
+type apiError struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Details   interface{}       `json:"details,omitempty"`
+	DocCoords *moment.DocCoords `json:"docCoords,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+// withRequestID assigns every request an ID (or reuses the one sent by the client), which is
+// returned in the X-Request-ID header and error bodies and included in log messages.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// reqLog returns a logger that includes the request ID in its messages.
+func reqLog(r *http.Request) *log.Entry {
+	return log.WithField("request_id", requestID(r))
+}
+
+// writeError writes an error envelope with the given status and code.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	writeAPIError(w, r, status, apiError{Code: code, Message: message})
+}
+
+// writeErrorFor maps err to the matching status and code and writes the error envelope.
+// Parse errors of the request body are reported as 422, parse errors of the todo file as 500.
+func writeErrorFor(w http.ResponseWriter, r *http.Request, err error, fromRequestBody bool) {
+	status := http.StatusInternalServerError
+	apiErr := apiError{Code: errCodeInternal, Message: err.Error()}
+
+	var corruptErr base64.CorruptInputError
+	var parseErr *parse.Error
+	if errors.As(err, &parseErr) {
+		apiErr.DocCoords = &parseErr.DocCoords
+	}
+	if errors.As(err, &corruptErr) {
+		status = http.StatusBadRequest
+		apiErr.Code = errCodeInvalidBody
+		apiErr.Details = map[string]int64{"byteOffset": int64(corruptErr)}
+	} else if parseErr != nil {
+		if fromRequestBody {
+			status = http.StatusUnprocessableEntity
+		}
+		apiErr.Code = errCodeParse
+	} else if errors.Is(err, util.ErrWriteConflict) {
+		status = http.StatusConflict
+		apiErr.Code = errCodeWriteConflict
+		apiErr.Message = "the todo file was modified while processing the request, please retry"
+	} else if errors.Is(err, backup.ErrBackupNotFound) || errors.Is(err, history.ErrMomentNotFound) {
+		status = http.StatusNotFound
+		apiErr.Code = errCodeNotFound
+	} else if errors.Is(err, history.ErrMomentExists) || errors.Is(err, backup.ErrRemoteChanged) {
+		status = http.StatusConflict
+		apiErr.Code = errCodeConflict
+	} else if errors.Is(err, errNoRetentionPolicy) {
+		status = http.StatusServiceUnavailable
+		apiErr.Code = errCodeNotConfigured
+	} else if errors.Is(err, modify.ErrMissingCategories) {
+		status = http.StatusUnprocessableEntity
+		apiErr.Code = errCodeMissingCategory
+	}
+	writeAPIError(w, r, status, apiErr)
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, apiErr apiError) {
+	apiErr.RequestID = requestID(r)
+	if status >= 500 {
+		reqLog(r).Errorf("%s %s failed: %s\n", r.Method, r.URL.Path, apiErr.Message)
+	} else {
+		reqLog(r).Debugf("%s %s rejected: %s\n", r.Method, r.URL.Path, apiErr.Message)
+	}
+
+	setJSONContentType(w)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]apiError{"error": apiErr})
+}
+
+// requireTodoFile writes an error and returns false if no todo file is configured.
+func requireTodoFile(w http.ResponseWriter, r *http.Request) bool {
+	if currentFiles().TodoFile == "" {
+		writeError(w, r, http.StatusServiceUnavailable, errCodeNotConfigured, "todoFile is not set")
+		return false
+	}
+	return true
+}
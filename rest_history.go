@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/history"
+)
+
+func getMomentHistory(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	entries, err := history.Get(files, mux.Vars(r)["id"])
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(entries)
+}
+
+func restoreMoment(w http.ResponseWriter, r *http.Request) {
+	if !requireTodoFile(w, r) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	restored, err := doRestoreMoment(id, r.FormValue("backup"))
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	reqLog(r).Infof("Restored moment %s\n", id)
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(map[string]string{"text": restored})
+}
+
+// doRestoreMoment backs up the current state and then copies the deleted moment from a backup into the todo file.
+func doRestoreMoment(id string, backupID string) (string, error) {
+	files := currentFiles()
+	_, err := backup.Save(files, "Backup before restoring moment")
+	if err != nil {
+		return "", err
+	}
+	return history.Restore(files, id, backupID)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sandro-h/sibylgo/reminder"
+)
+
+func getVacation(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	v, err := reminder.GetVacation(files.ReminderStateFile)
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	writeVacation(w, v)
+}
+
+func putVacation(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	v, err := reminder.ParseVacation(r.FormValue("from"), r.FormValue("to"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+		return
+	}
+	err = reminder.SetVacation(files.ReminderStateFile, v)
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	reqLog(r).Infof("Set vacation from %s to %s\n", r.FormValue("from"), r.FormValue("to"))
+	writeVacation(w, v)
+}
+
+func deleteVacation(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	err := reminder.SetVacation(files.ReminderStateFile, nil)
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+	reqLog(r).Infof("Cleared vacation\n")
+	writeVacation(w, nil)
+}
+
+func writeVacation(w http.ResponseWriter, v *reminder.Vacation) {
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(map[string]*reminder.Vacation{"vacation": v})
+}
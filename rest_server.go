@@ -1,38 +1,180 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/sandro-h/sibylgo/api"
+	"github.com/sandro-h/sibylgo/auth"
 	"github.com/sandro-h/sibylgo/backup"
 	"github.com/sandro-h/sibylgo/calendar"
 	"github.com/sandro-h/sibylgo/cleanup"
 	"github.com/sandro-h/sibylgo/format"
 	"github.com/sandro-h/sibylgo/instances"
+	"github.com/sandro-h/sibylgo/metrics"
 	"github.com/sandro-h/sibylgo/modify"
 	"github.com/sandro-h/sibylgo/moment"
 	"github.com/sandro-h/sibylgo/parse"
 	"github.com/sandro-h/sibylgo/preview"
+	"github.com/sandro-h/sibylgo/query"
 	"github.com/sandro-h/sibylgo/reminder"
+	"github.com/sandro-h/sibylgo/scheduler"
+	"github.com/sandro-h/sibylgo/status"
 	"github.com/sandro-h/sibylgo/util"
 	log "github.com/sirupsen/logrus"
 )
 
+const restShutdownTimeout = 5 * time.Second
+
+// restMutex guards restServer and restStopped, since reloads restart the server in their own go routine.
+var restMutex sync.Mutex
+var restServer *http.Server
+
+// restStopped is set when the server is stopped for the shutdown, after which it is not started again.
+var restStopped bool
+
+// allowedOrigins returns whether an origin is in cors_origins.
+func allowedOrigins(restCfg *util.Config) func(string) bool {
+	origins := restCfg.GetStringList("cors_origins", nil)
+	return func(origin string) bool {
+		for _, o := range origins {
+			if o == origin || o == "*" {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// withCORS allows browsers to call the server from the origins in cors_origins. By default, no cross-origin
+// requests are allowed.
+func withCORS(restCfg *util.Config) func(http.Handler) http.Handler {
+	return handlers.CORS(
+		handlers.AllowedOriginValidator(allowedOrigins(restCfg)),
+		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", auth.SignatureHeader, requestIDHeader}),
+		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}),
+		handlers.ExposedHeaders([]string{requestIDHeader}))
+}
+
+// rejectForeignOrigins rejects state-changing requests sent by browsers from other origins than the server and
+// cors_origins. CORS only hides the responses from them, simple requests like form POSTs are still handled.
+func rejectForeignOrigins(restCfg *util.Config) func(http.Handler) http.Handler {
+	allowed := allowedOrigins(restCfg)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin != "" && !isSafeMethod(r.Method) && !isSameOrigin(r, origin) && !allowed(origin) {
+				writeError(w, r, http.StatusForbidden, errCodeUnauthorized, fmt.Sprintf("origin %s is not allowed", origin))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// isSameOrigin returns whether the origin is the host the request was sent to, e.g. by the confirm form of
+// the action links.
+func isSameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+// newRestHandler wraps the router with authentication, the origin checks and request IDs.
+func newRestHandler(restCfg *util.Config, authOpts auth.Options, router http.Handler) http.Handler {
+	handler := auth.Middleware(authOpts)(router)
+	return withRequestID(withCORS(restCfg)(rejectForeignOrigins(restCfg)(handler)))
+}
+
 func startRestServer(cfg *util.Config) {
+	restMutex.Lock()
+	defer restMutex.Unlock()
+	if restStopped {
+		return
+	}
+	serveRest(cfg)
+}
+
+// serveRest starts the server. Must be called with restMutex held.
+func serveRest(cfg *util.Config) {
 	host := cfg.GetString("host", "localhost")
 	port := cfg.GetInt("port", 8082)
 	optimizedFormat := cfg.GetBool("optimized_format", true)
+	restCfg := cfg.GetSubConfig("rest")
+
+	router := newRouter(optimizedFormat)
+
+	authOpts := auth.Options{
+		Token:       restCfg.GetString("auth_token", ""),
+		HMACSecret:  restCfg.GetString("hmac_secret", ""),
+		PublicPaths: []string{"/health", "/openapi.json", "/actions/"},
+		OnUnauthorized: func(w http.ResponseWriter, r *http.Request, message string) {
+			writeError(w, r, http.StatusUnauthorized, errCodeUnauthorized, message)
+		},
+	}
+	srv := &http.Server{
+		Handler:      newRestHandler(restCfg, authOpts, router),
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
 
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type"})
-	originsOk := handlers.AllowedOrigins([]string{"*"})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"})
+	tlsCfg := restCfg.GetSubConfig("tls")
+	useTLS := tlsCfg.HasKey("cert_file") || tlsCfg.GetBool("self_signed", false)
+	if useTLS {
+		cert, err := auth.LoadOrGenerateCertificate(
+			util.ExpandHome(tlsCfg.GetString("cert_file", "")),
+			util.ExpandHome(tlsCfg.GetString("key_file", "")),
+			tlsCfg.GetBool("self_signed", false),
+			[]string{host, "localhost", "127.0.0.1"})
+		if err != nil {
+			log.Errorf("Could not load TLS certificate, not starting REST server: %s\n", err)
+			return
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		log.Infof("REST server certificate SHA-256 fingerprint: %s\n", auth.Fingerprint(cert))
+	}
 
+	listener, addr, err := listenRest(restCfg, host, port)
+	if err != nil {
+		log.Errorf("Could not start REST server on %s: %s\n", addr, err)
+		return
+	}
+	restServer = srv
+	go func() {
+		var err error
+		if useTLS {
+			err = srv.ServeTLS(listener, "", "")
+		} else {
+			err = srv.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("REST server on %s failed: %s\n", addr, err)
+		}
+	}()
+	if !authOpts.Enabled() && host != "localhost" && host != "127.0.0.1" && !restCfg.HasKey("socket") {
+		log.Warnf("REST server on %s is reachable from the network without authentication\n", addr)
+	}
+	log.Infof("Started REST server on %s\n", addr)
+}
+
+// newRouter registers all REST endpoints. Every endpoint must also be documented in api/openapi.json.
+func newRouter(optimizedFormat bool) *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/format", func(w http.ResponseWriter, r *http.Request) {
 		if optimizedFormat {
@@ -46,26 +188,105 @@ func startRestServer(cfg *util.Config) {
 	router.HandleFunc("/trash", trash).Methods("POST")
 	router.HandleFunc("/moments", getCalendarEntries).Methods("GET")
 	router.HandleFunc("/moments", insertMoment).Methods("POST")
+	router.HandleFunc("/moments/{id}/history", getMomentHistory).Methods("GET")
+	router.HandleFunc("/moments/{id}/restore", restoreMoment).Methods("POST")
 	router.HandleFunc("/reminders/{date}/weekly", getWeeklyReminders).Methods("GET")
+	router.HandleFunc("/reminders/vacation", getVacation).Methods("GET")
+	router.HandleFunc("/reminders/vacation", putVacation).Methods("PUT")
+	router.HandleFunc("/reminders/vacation", deleteVacation).Methods("DELETE")
+	router.HandleFunc("/actions/{token}", getAction).Methods("GET")
+	router.HandleFunc("/actions/{token}", postAction).Methods("POST")
 	router.HandleFunc("/preview", getPreview).Methods("GET")
 	router.HandleFunc("/preview", postPreview).Methods("POST")
+	router.HandleFunc("/search", searchMoments).Methods("GET")
+	router.HandleFunc("/backups", getBackups).Methods("GET")
+	router.HandleFunc("/backups/prune", pruneBackupsNow).Methods("POST")
+	router.HandleFunc("/backups/{id}", getBackup).Methods("GET")
+	router.HandleFunc("/backups/{id}/diff", getBackupDiff).Methods("GET")
+	router.HandleFunc("/backups/{id}/restore", restoreBackup).Methods("POST")
+	router.HandleFunc("/admin/reload", postReload).Methods("POST")
+	router.HandleFunc("/jobs", getJobs).Methods("GET")
+	router.HandleFunc("/jobs/{name}/run", runJob).Methods("POST")
+	router.HandleFunc("/health", getHealth).Methods("GET")
+	router.HandleFunc("/status", getStatus).Methods("GET")
+	router.HandleFunc("/metrics", getMetrics).Methods("GET")
+	router.HandleFunc("/openapi.json", getOpenAPISpec).Methods("GET")
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed,
+			fmt.Sprintf("method %s not allowed for %s", r.Method, r.URL.Path))
+	})
+	router.Use(measureRequests)
+	return router
+}
 
-	srv := &http.Server{
-		Handler:      handlers.CORS(originsOk, headersOk, methodsOk)(router),
-		Addr:         fmt.Sprintf("%s:%d", host, port),
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+// listenRest listens on the Unix domain socket if one is configured, otherwise on host:port.
+func listenRest(restCfg *util.Config, host string, port int) (net.Listener, string, error) {
+	if restCfg.HasKey("socket") {
+		socket := util.ExpandHome(restCfg.GetString("socket", ""))
+		// Remove a stale socket from a previous run.
+		if util.Exists(socket) {
+			os.Remove(socket)
+		}
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			return nil, socket, err
+		}
+		// Only the current user may connect.
+		err = os.Chmod(socket, 0600)
+		if err != nil {
+			listener.Close()
+			return nil, socket, err
+		}
+		return listener, socket, nil
+	}
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+	listener, err := net.Listen("tcp", addr)
+	return listener, addr, err
+}
+
+// stopRestServer stops the server for the shutdown. Later restarts by reloads do nothing.
+func stopRestServer() {
+	restMutex.Lock()
+	defer restMutex.Unlock()
+	restStopped = true
+	closeRest()
+}
+
+// closeRest stops the running server, if any. Must be called with restMutex held.
+func closeRest() {
+	if restServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), restShutdownTimeout)
+	defer cancel()
+	err := restServer.Shutdown(ctx)
+	if err != nil {
+		log.Errorf("Error stopping REST server: %s\n", err)
+	}
+	restServer = nil
+	log.Info("Stopped REST server\n")
+}
+
+func restartRestServer(cfg *util.Config) {
+	restMutex.Lock()
+	defer restMutex.Unlock()
+	if restStopped {
+		return
 	}
-	go srv.ListenAndServe()
-	log.Infof("Started REST server on %s:%d\n", host, port)
+	closeRest()
+	serveRest(cfg)
 }
 
 func formatMoments(w http.ResponseWriter, r *http.Request) {
 	reader := base64.NewDecoder(base64.StdEncoding, r.Body)
-	todos, err := parse.Reader(reader)
-
+	todos, err := parseContent(reader)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeErrorFor(w, r, err, true)
+		return
 	}
 
 	formats := format.ForVSCode(todos)
@@ -77,14 +298,16 @@ func formatMomentsOptimized(w http.ResponseWriter, r *http.Request) {
 
 	data, err := ioutil.ReadAll(reader)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeErrorFor(w, r, err, true)
+		return
 	}
 
 	raw := string(data)
 	todos, err := parse.String(raw)
-
+	recordParse("content", err)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeErrorFor(w, r, err, true)
+		return
 	}
 
 	formats := format.ForVSCodeOptimized(todos, raw)
@@ -93,28 +316,33 @@ func formatMomentsOptimized(w http.ResponseWriter, r *http.Request) {
 
 func foldMoments(w http.ResponseWriter, r *http.Request) {
 	reader := base64.NewDecoder(base64.StdEncoding, r.Body)
-	todos, err := parse.Reader(reader)
+	todos, err := parseContent(reader)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeErrorFor(w, r, err, true)
+		return
 	}
 	res := format.FoldForVSCode(todos)
 	fmt.Fprint(w, res)
 }
 
 func getCalendarEntries(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
 	start, err := util.ParseISODate(r.FormValue("start"))
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "invalid start date: "+err.Error())
 		return
 	}
 	end, err := util.ParseISODate(r.FormValue("end"))
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "invalid end date: "+err.Error())
+		return
+	}
+	if !requireTodoFile(w, r) {
 		return
 	}
-	todos, err := parse.File(files.TodoFile)
+	todos, err := parseTodoFile(files.TodoFile)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeErrorFor(w, r, err, false)
 		return
 	}
 
@@ -124,9 +352,13 @@ func getCalendarEntries(w http.ResponseWriter, r *http.Request) {
 }
 
 func insertMoment(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
 	name := r.FormValue("name")
 	if name == "" {
-		http.Error(w, "name parameter not set", 400)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "name parameter not set")
+		return
+	}
+	if !requireTodoFile(w, r) {
 		return
 	}
 	category := r.FormValue("category")
@@ -135,29 +367,33 @@ func insertMoment(w http.ResponseWriter, r *http.Request) {
 		mom.SetCategory(&moment.Category{Name: category})
 	}
 
-	log.Infof("Inserting '%s' into category '%s'\n", name, category)
+	reqLog(r).Infof("Inserting '%s' into category '%s'\n", name, category)
 	backup.Save(files, "Backup before programmatically inserting moment")
 	err := modify.PrependInFile(files.TodoFile, []moment.Moment{mom})
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeErrorFor(w, r, err, false)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
 	setJSONContentType(w)
+	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("{\"message\": \"Inserted moment\"}"))
 }
 
 func getWeeklyReminders(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
 	vars := mux.Vars(r)
 	date, err := util.ParseISODate(vars["date"])
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, "invalid date: "+err.Error())
+		return
+	}
+	if !requireTodoFile(w, r) {
 		return
 	}
-	todos, err := parse.File(files.TodoFile)
+	todos, err := parseTodoFile(files.TodoFile)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeErrorFor(w, r, err, false)
 		return
 	}
 
@@ -170,23 +406,26 @@ func getWeeklyReminders(w http.ResponseWriter, r *http.Request) {
 }
 
 func clean(w http.ResponseWriter, r *http.Request) {
-	if files.TodoFile == "" {
-		log.Errorf("Cannot clean without todoFile set\n")
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
 		return
 	}
 
 	backup.Save(files, "Backup before cleaning")
 	err := cleanup.MoveDoneToEndOfFile(files.TodoFile, true)
 	if err != nil {
-		log.Infof("Error cleaning up: %s\n", err)
-	} else {
-		log.Infof("Moved done to end of: %s\n", files.TodoFile)
+		writeErrorFor(w, r, err, false)
+		return
 	}
+
+	reqLog(r).Infof("Moved done to end of: %s\n", files.TodoFile)
+	setJSONContentType(w)
+	w.Write([]byte("{\"message\": \"Moved done moments to end of file\"}"))
 }
 
 func trash(w http.ResponseWriter, r *http.Request) {
-	if files.TodoFile == "" {
-		log.Error("Cannot clean without todoFile set\n")
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
 		return
 	}
 
@@ -195,37 +434,157 @@ func trash(w http.ResponseWriter, r *http.Request) {
 	backup.Save(files, "Backup before trashing")
 	err := cleanup.MoveDoneToTrashFile(files.TodoFile, trashFile, true)
 	if err != nil {
-		log.Errorf("Error trashing: %s", err)
-	} else {
-		log.Infof("Trashed: %s\n", files.TodoFile)
-		log.Infof("Moved done moments to: %s\n", trashFile)
+		writeErrorFor(w, r, err, false)
+		return
 	}
+
+	reqLog(r).Infof("Trashed: %s\n", files.TodoFile)
+	reqLog(r).Infof("Moved done moments to: %s\n", trashFile)
+	setJSONContentType(w)
+	w.Write([]byte("{\"message\": \"Moved done moments to trash file\"}"))
 }
 
 func getPreview(w http.ResponseWriter, r *http.Request) {
-	todos, err := parse.File(files.TodoFile)
+	files := currentFiles()
+	if !requireTodoFile(w, r) {
+		return
+	}
+	todos, err := parseTodoFile(files.TodoFile)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeErrorFor(w, r, err, false)
 		return
 	}
 
-	previewResp := preview.Create(todos)
+	previewResp := preview.Create(todos, currentViews()...)
 	setJSONContentType(w)
 	json.NewEncoder(w).Encode(previewResp)
 }
 
 func postPreview(w http.ResponseWriter, r *http.Request) {
 	reader := base64.NewDecoder(base64.StdEncoding, r.Body)
-	todos, err := parse.Reader(reader)
+	todos, err := parseContent(reader)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeErrorFor(w, r, err, true)
+		return
 	}
 
-	previewResp := preview.Create(todos)
+	previewResp := preview.Create(todos, currentViews()...)
 	setJSONContentType(w)
 	json.NewEncoder(w).Encode(previewResp)
 }
 
+func searchMoments(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	q, err := query.Parse(r.FormValue("q"))
+	if err != nil {
+		var syntaxErr *query.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			writeAPIError(w, r, http.StatusBadRequest, apiError{Code: errCodeBadRequest, Message: err.Error(),
+				Details: map[string]int{"position": syntaxErr.Pos}})
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, errCodeBadRequest, err.Error())
+		return
+	}
+	if !requireTodoFile(w, r) {
+		return
+	}
+	todos, err := parseTodoFile(files.TodoFile)
+	if err != nil {
+		writeErrorFor(w, r, err, false)
+		return
+	}
+
+	res := struct {
+		Query   string         `json:"query"`
+		Results []query.Result `json:"results"`
+	}{q.Raw, query.Search(todos, q, time.Now())}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(res)
+}
+
+func postReload(w http.ResponseWriter, r *http.Request) {
+	changes, err := reloadConfig()
+	var invalid *invalidConfigError
+	if errors.As(err, &invalid) {
+		writeError(w, r, http.StatusUnprocessableEntity, errCodeBadRequest, "could not reload config: "+err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusInternalServerError, errCodeInternal, "could not reload config: "+err.Error())
+		return
+	}
+
+	res := make([]string, 0)
+	for _, c := range changes {
+		res = append(res, c.String())
+	}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(map[string][]string{"changes": res})
+}
+
+func getJobs(w http.ResponseWriter, r *http.Request) {
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(jobs.Jobs())
+}
+
+func runJob(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	err := jobs.RunNow(name)
+	if err == scheduler.ErrJobNotFound {
+		writeError(w, r, http.StatusNotFound, errCodeNotFound, fmt.Sprintf("job %s not found", name))
+		return
+	} else if err == scheduler.ErrJobRunning {
+		writeError(w, r, http.StatusConflict, errCodeConflict, fmt.Sprintf("job %s is already running", name))
+		return
+	}
+
+	reqLog(r).Infof("Triggered job %s\n", name)
+	setJSONContentType(w)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("{\"message\": \"Triggered job\"}"))
+}
+
+func getHealth(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	if files.TodoFile != "" && !util.Exists(files.TodoFile) {
+		writeError(w, r, http.StatusServiceUnavailable, errCodeNotConfigured,
+			fmt.Sprintf("todo file %s does not exist", files.TodoFile))
+		return
+	}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func getStatus(w http.ResponseWriter, r *http.Request) {
+	files := currentFiles()
+	res := struct {
+		status.Status
+		Version   string                `json:"version"`
+		StartedAt time.Time             `json:"startedAt"`
+		TodoFile  string                `json:"todoFile"`
+		Jobs      []scheduler.JobStatus `json:"jobs"`
+	}{
+		Status:    status.Get(),
+		Version:   fmt.Sprintf("%s.%s (%s)", buildVersion, buildNumber, buildRevision),
+		StartedAt: startTime,
+		TodoFile:  files.TodoFile,
+		Jobs:      jobs.Jobs(),
+	}
+	setJSONContentType(w)
+	json.NewEncoder(w).Encode(res)
+}
+
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	updateMomentMetrics()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteText(w)
+}
+
+func getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	setJSONContentType(w)
+	w.Write(api.OpenAPISpec)
+}
+
 func setJSONContentType(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sandro-h/sibylgo/api"
+	"github.com/sandro-h/sibylgo/auth"
+	"github.com/sandro-h/sibylgo/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPISpecMatchesRouter(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	err := json.Unmarshal(api.OpenAPISpec, &spec)
+	assert.Nil(t, err)
+
+	var documented []string
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(documented)
+
+	var routed []string
+	newRouter(true).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		for _, m := range methods {
+			routed = append(routed, m+" "+path)
+		}
+		return nil
+	})
+	sort.Strings(routed)
+
+	assert.Equal(t, routed, documented)
+}
+
+func TestServeOpenAPISpec(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newRouter(true).ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, api.OpenAPISpec, rec.Body.Bytes())
+}
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cases := []struct {
+		cfg     string
+		origin  string
+		allowed string
+	}{
+		{"", "http://evil.example.com", ""},
+		{"", "null", ""},
+		{`cors_origins: ["null"]`, "null", "null"},
+		{`cors_origins: ["null"]`, "http://evil.example.com", ""},
+		{`cors_origins: ["*"]`, "http://localhost:3000", "http://localhost:3000"},
+	}
+	for _, c := range cases {
+		restCfg, _ := util.LoadConfigString(c.cfg)
+		req := httptest.NewRequest("OPTIONS", "/preview", nil)
+		req.Header.Set("Origin", c.origin)
+		req.Header.Set("Access-Control-Request-Method", "DELETE")
+		rec := httptest.NewRecorder()
+
+		withCORS(restCfg)(ok).ServeHTTP(rec, req)
+
+		assert.Equal(t, c.allowed, rec.Header().Get("Access-Control-Allow-Origin"), "%s %s", c.cfg, c.origin)
+	}
+}
+
+func TestRejectForeignOrigins(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sibylgo-rest")
+	defer os.RemoveAll(dir)
+	todoFile := filepath.Join(dir, "todo.txt")
+	content := "[x] done\n[] open\n"
+	util.WriteFile(todoFile, content)
+	oldFiles := currentFiles()
+	setFiles(util.NewFileConfigFromTodoFile(todoFile))
+	defer setFiles(oldFiles)
+	restCfg, _ := util.LoadConfigString(`cors_origins: ["null"]`)
+	handler := newRestHandler(restCfg, auth.Options{}, newRouter(true))
+
+	cases := []struct {
+		method string
+		origin string
+		code   int
+	}{
+		{"POST", "http://evil.example.com", http.StatusForbidden},
+		{"POST", "http://example.com.evil.example.com", http.StatusForbidden},
+		{"GET", "http://evil.example.com", http.StatusOK},
+		{"POST", "null", http.StatusOK},
+		{"POST", "", http.StatusOK},
+		{"POST", "http://example.com", http.StatusOK},
+	}
+	for _, c := range cases {
+		util.WriteFile(todoFile, content)
+		req := httptest.NewRequest(c.method, "/preview", nil)
+		if c.method == "POST" {
+			req = httptest.NewRequest(c.method, "/trash", nil)
+		}
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, c.code, rec.Code, "%s %s", c.method, c.origin)
+		if c.code == http.StatusForbidden {
+			after, _ := ioutil.ReadFile(todoFile)
+			assert.Equal(t, content, string(after), "todo file unchanged for %s", c.origin)
+		}
+	}
+}
+
+func TestPostReload_Errors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sibylgo-reload")
+	defer os.RemoveAll(dir)
+	invalidCfg := filepath.Join(dir, "sibylgo.yml")
+	util.WriteFile(invalidCfg, "reminders:\n  template_dir: /tmp\n")
+	oldPath := configPath
+	defer func() { configPath = oldPath }()
+
+	cases := []struct {
+		path string
+		code int
+	}{
+		{invalidCfg, http.StatusUnprocessableEntity},
+		// A directory cannot be read
+		{dir, http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		configPath = c.path
+		rec := httptest.NewRecorder()
+
+		postReload(rec, httptest.NewRequest("POST", "/admin/reload", nil))
+
+		assert.Equal(t, c.code, rec.Code, c.path)
+	}
+}
+
+func TestGetMetrics_NotRecordedAsParse(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sibylgo-metrics")
+	defer os.RemoveAll(dir)
+	todoFile := filepath.Join(dir, "todo.txt")
+	util.WriteFile(todoFile, "[] open\n")
+	oldFiles := currentFiles()
+	setFiles(util.NewFileConfigFromTodoFile(todoFile))
+	defer setFiles(oldFiles)
+	before := parsesTotal.Get("file", "ok")
+	rec := httptest.NewRecorder()
+
+	newRouter(true).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `sibylgo_open_moments{category="_none"} 1`)
+	assert.Equal(t, before, parsesTotal.Get("file", "ok"))
+}
@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes when a job runs next.
+type Schedule interface {
+	// Next returns the next activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+var shorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// ParseSchedule parses a cron expression with the five fields minute, hour, day of month,
+// month and day of week. Fields support *, lists (1,2), ranges (1-5) and steps (*/15, 1-30/5).
+// Day of week is 0-6 with 0 being Sunday (7 is also accepted for Sunday).
+// Also supported are the shorthands @hourly, @daily, @weekly, @monthly, @yearly and
+// @every <duration> (e.g. @every 5s) for fixed intervals.
+func ParseSchedule(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %s", expr, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid schedule '%s': interval must be positive", expr)
+		}
+		return &intervalSchedule{d}, nil
+	}
+	if full, found := shorthands[expr]; found {
+		expr = full
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule '%s': expected 5 fields but got %d", expr, len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+	ranges := []struct {
+		target *uint64
+		min    int
+		max    int
+	}{
+		{&s.minutes, 0, 59},
+		{&s.hours, 0, 23},
+		{&s.doms, 1, 31},
+		{&s.months, 1, 12},
+		{&s.dows, 0, 7},
+	}
+	for i, r := range ranges {
+		*r.target, err = parseField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %s", expr, err)
+		}
+	}
+	// Sunday can be 0 or 7
+	if s.dows&(1<<7) != 0 {
+		s.dows |= 1
+	}
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	if !s.activates() {
+		return nil, fmt.Errorf("invalid schedule '%s': day of month never occurs in the months", expr)
+	}
+	return &s, nil
+}
+
+func parseField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			if i := strings.Index(part, "-"); i >= 0 {
+				lo, err = strconv.Atoi(part[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(part[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(part)
+				hi = lo
+			}
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", part)
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value '%s' out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+type cronSchedule struct {
+	minutes uint64
+	hours   uint64
+	doms    uint64
+	months  uint64
+	dows    uint64
+	domStar bool
+	dowStar bool
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Give up after 9 years, the longest gap between two 29th of February
+	limit := t.AddDate(9, 0, 0)
+	for t.Before(limit) {
+		if !has(s.months, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hours, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minutes, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// daysInMonth is the maximum number of days of each month.
+var daysInMonth = [13]int{0, 31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// activates returns false if the schedule has no next activation, e.g. for the 30th of February.
+func (s *cronSchedule) activates() bool {
+	// If the day of week is restricted too, a day matching either is enough.
+	if s.domStar || !s.dowStar {
+		return true
+	}
+	for m := 1; m <= 12; m++ {
+		if !has(s.months, m) {
+			continue
+		}
+		for d := 1; d <= daysInMonth[m]; d++ {
+			if has(s.doms, d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dayMatches follows the cron convention: if both day of month and day of week are restricted,
+// a day matching either of them is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.doms, t.Day())
+	dowMatch := has(s.dows, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (s *intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
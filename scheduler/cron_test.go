@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"testing"
+
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	type test struct {
+		expr     string
+		from     string
+		expected string
+	}
+
+	tests := []test{
+		{"*/5 * * * *", "04.01.2019 12:02", "04.01.2019 12:05:00"},
+		{"*/5 * * * *", "04.01.2019 12:05", "04.01.2019 12:10:00"},
+		{"0 3 * * *", "04.01.2019 12:02", "05.01.2019 03:00:00"},
+		{"0 3 * * *", "04.01.2019 02:59", "04.01.2019 03:00:00"},
+		{"30 8 * * 1-5", "04.01.2019 12:00", "07.01.2019 08:30:00"},
+		{"0 9 * * 0", "04.01.2019 12:00", "06.01.2019 09:00:00"},
+		{"0 9 * * 7", "04.01.2019 12:00", "06.01.2019 09:00:00"},
+		{"0 0 1 * *", "04.01.2019 12:00", "01.02.2019 00:00:00"},
+		{"15,45 10-11 * * *", "04.01.2019 10:20", "04.01.2019 10:45:00"},
+		{"15,45 10-11 * * *", "04.01.2019 11:50", "05.01.2019 10:15:00"},
+		{"0 0 29 2 *", "04.01.2019 12:00", "29.02.2020 00:00:00"},
+		{"0 0 29 2 *", "01.03.2096 00:00", "29.02.2104 00:00:00"},
+		// Both day of month and day of week restricted: either matches
+		{"0 0 13 * 5", "01.01.2019 12:00", "04.01.2019 00:00:00"},
+		{"@daily", "04.01.2019 12:00", "05.01.2019 00:00:00"},
+		{"@hourly", "04.01.2019 12:00", "04.01.2019 13:00:00"},
+		{"@every 5s", "04.01.2019 12:00", "04.01.2019 12:00:05"},
+		{"@every 90m", "04.01.2019 12:00", "04.01.2019 13:30:00"},
+	}
+
+	for _, tc := range tests {
+		s, err := ParseSchedule(tc.expr)
+		assert.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expected, tu.Dtts(s.Next(tu.Dtt(tc.from))), "%s from %s", tc.expr, tc.from)
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"a * * * *",
+		"5-1 * * * *",
+		"@every",
+		"@every -5s",
+		"@every abc",
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	}
+
+	for _, tc := range tests {
+		_, err := ParseSchedule(tc)
+		assert.Error(t, err, tc)
+	}
+}
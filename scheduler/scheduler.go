@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sandro-h/sibylgo/clock"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrJobNotFound is returned when a job name is not registered.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobRunning is returned when a job is triggered manually while it is still running.
+var ErrJobRunning = errors.New("job is already running")
+
+// JobFunc does the work of a job. A returned error is recorded in the job's status.
+type JobFunc func() error
+
+// JobStatus describes the state of a scheduled job.
+type JobStatus struct {
+	Name      string     `json:"name"`
+	Schedule  string     `json:"schedule"`
+	Running   bool       `json:"running"`
+	LastRun   *time.Time `json:"lastRun"`
+	NextRun   time.Time  `json:"nextRun"`
+	LastError string     `json:"lastError"`
+}
+
+type job struct {
+	name     string
+	expr     string
+	schedule Schedule
+	fn       JobFunc
+	next     time.Time
+	lastRun  *time.Time
+	lastErr  error
+	running  bool
+	// done is closed when the current run completes.
+	done chan struct{}
+}
+
+// Scheduler runs named jobs according to their cron schedules. A job never runs
+// concurrently with itself: if it is still running when it is due again, that activation is skipped.
+type Scheduler struct {
+	clock  clock.Clock
+	mutex  sync.Mutex
+	jobs   map[string]*job
+	wakeup chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New creates a Scheduler using the passed clock.
+func New(clk clock.Clock) *Scheduler {
+	return &Scheduler{
+		clock:  clk,
+		jobs:   make(map[string]*job),
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// Add registers a job with a cron expression (see ParseSchedule). An existing job
+// with the same name is removed first, see Remove, so the two never run at the same time.
+func (s *Scheduler) Add(name string, expr string, fn JobFunc) error {
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		return fmt.Errorf("job %s: %s", name, err)
+	}
+
+	s.Remove(name)
+	s.mutex.Lock()
+	s.jobs[name] = &job{
+		name:     name,
+		expr:     expr,
+		schedule: schedule,
+		fn:       fn,
+		next:     schedule.Next(s.clock.Now()),
+	}
+	s.mutex.Unlock()
+	s.wake()
+	return nil
+}
+
+// Remove unregisters the job. If it is currently running, it waits for that run to complete.
+// It returns false if no job with the name was registered.
+func (s *Scheduler) Remove(name string) bool {
+	s.mutex.Lock()
+	j, found := s.jobs[name]
+	delete(s.jobs, name)
+	var done chan struct{}
+	if found && j.running {
+		done = j.done
+	}
+	s.mutex.Unlock()
+	s.wake()
+	if done != nil {
+		<-done
+	}
+	return found
+}
+
+// RunNow triggers the job immediately, independent of its schedule. It does not wait for the job to finish.
+func (s *Scheduler) RunNow(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	j, found := s.jobs[name]
+	if !found {
+		return ErrJobNotFound
+	}
+	if j.running {
+		return ErrJobRunning
+	}
+	s.startJob(j)
+	return nil
+}
+
+// Jobs returns the status of all jobs, sorted by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := JobStatus{
+			Name:     j.name,
+			Schedule: j.expr,
+			Running:  j.running,
+			LastRun:  j.lastRun,
+			NextRun:  j.next,
+		}
+		if j.lastErr != nil {
+			status.LastError = j.lastErr.Error()
+		}
+		res = append(res, status)
+	}
+	sort.Slice(res, func(i, k int) bool { return res[i].Name < res[k].Name })
+	return res
+}
+
+// Run starts due jobs until the context is cancelled. It then waits for running
+// jobs to finish before returning.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		s.mutex.Lock()
+		now := s.clock.Now()
+		var nextWake time.Time
+		for _, j := range s.jobs {
+			// The schedule has no next activation.
+			if j.next.IsZero() {
+				continue
+			}
+			if !j.next.After(now) {
+				j.next = j.schedule.Next(now)
+				if j.running {
+					log.Warnf("Skipping job %s, it is still running\n", j.name)
+				} else {
+					s.startJob(j)
+				}
+				if j.next.IsZero() {
+					log.Warnf("Job %s has no next activation, it only runs when triggered\n", j.name)
+					continue
+				}
+			}
+			if nextWake.IsZero() || j.next.Before(nextWake) {
+				nextWake = j.next
+			}
+		}
+		s.mutex.Unlock()
+
+		var timer <-chan time.Time
+		if !nextWake.IsZero() {
+			timer = s.clock.After(nextWake.Sub(now))
+		}
+
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return nil
+		case <-timer:
+		case <-s.wakeup:
+		}
+	}
+}
+
+// startJob runs the job in a go routine. Must be called with the mutex held.
+func (s *Scheduler) startJob(j *job) {
+	j.running = true
+	j.done = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		start := s.clock.Now()
+		err := runRecovered(j.fn)
+		if err != nil {
+			log.Errorf("Job %s failed: %s\n", j.name, err)
+		}
+
+		s.mutex.Lock()
+		j.running = false
+		j.lastRun = &start
+		j.lastErr = err
+		close(j.done)
+		s.mutex.Unlock()
+	}()
+}
+
+func (s *Scheduler) wake() {
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func runRecovered(fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sandro-h/sibylgo/clock"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_RunsDueJobs(t *testing.T) {
+	clk := clock.NewFake(tu.Dtt("04.01.2019 12:02"))
+	s := New(clk)
+	ran := make(chan string, 10)
+	s.Add("backup", "0 3 * * *", func() error { ran <- "backup"; return nil })
+	s.Add("reminders", "*/5 * * * *", func() error { ran <- "reminders"; return errors.New("smtp down") })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	clk.WaitForTimers(1)
+	clk.Advance(3 * time.Minute)
+
+	assert.Equal(t, "reminders", <-ran)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, ran)
+
+	jobs := s.Jobs()
+	assert.Equal(t, 2, len(jobs))
+	assert.Equal(t, "backup", jobs[0].Name)
+	assert.Equal(t, "0 3 * * *", jobs[0].Schedule)
+	assert.Nil(t, jobs[0].LastRun)
+	assert.Equal(t, "05.01.2019 03:00:00", tu.Dtts(jobs[0].NextRun))
+	assert.Equal(t, "", jobs[0].LastError)
+	assert.Equal(t, "reminders", jobs[1].Name)
+	assert.Equal(t, "04.01.2019 12:05:00", tu.Dtts(*jobs[1].LastRun))
+	assert.Equal(t, "04.01.2019 12:10:00", tu.Dtts(jobs[1].NextRun))
+	assert.Equal(t, "smtp down", jobs[1].LastError)
+}
+
+func TestScheduler_RunNow(t *testing.T) {
+	clk := clock.NewFake(tu.Dtt("04.01.2019 12:02"))
+	s := New(clk)
+	release := make(chan struct{})
+	ran := make(chan struct{}, 10)
+	s.Add("backup", "0 3 * * *", func() error {
+		ran <- struct{}{}
+		<-release
+		return nil
+	})
+
+	err := s.RunNow("backup")
+	<-ran
+
+	assert.NoError(t, err)
+	assert.True(t, s.Jobs()[0].Running)
+	assert.Equal(t, ErrJobRunning, s.RunNow("backup"))
+	assert.Equal(t, ErrJobNotFound, s.RunNow("unknown"))
+	close(release)
+}
+
+func TestScheduler_RecoversFromPanic(t *testing.T) {
+	s := New(clock.NewFake(tu.Dtt("04.01.2019 12:02")))
+	s.Add("bad", "@every 1m", func() error { panic("boom") })
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.RunNow("bad")
+	cancel()
+	s.Run(ctx)
+
+	assert.Equal(t, "panic: boom", s.Jobs()[0].LastError)
+}
+
+func TestScheduler_InvalidSchedule(t *testing.T) {
+	s := New(clock.Real)
+
+	err := s.Add("bad", "* * *", func() error { return nil })
+
+	assert.EqualError(t, err, "job bad: invalid schedule '* * *': expected 5 fields but got 3")
+	assert.Empty(t, s.Jobs())
+}
+
+type noActivation struct{}
+
+func (noActivation) Next(t time.Time) time.Time {
+	return time.Time{}
+}
+
+func TestScheduler_SkipsJobsWithoutNextActivation(t *testing.T) {
+	clk := clock.NewFake(tu.Dtt("04.01.2019 12:02"))
+	s := New(clk)
+	ran := make(chan string, 10)
+	s.Add("reminders", "*/5 * * * *", func() error { ran <- "reminders"; return nil })
+	s.jobs["never"] = &job{name: "never", schedule: noActivation{}, fn: func() error { ran <- "never"; return nil }}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	clk.WaitForTimers(1)
+	clk.Advance(3 * time.Minute)
+
+	assert.Equal(t, "reminders", <-ran)
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, ran)
+}
+
+func TestScheduler_ImpossibleSchedule(t *testing.T) {
+	s := New(clock.Real)
+
+	err := s.Add("bad", "0 0 30 2 *", func() error { return nil })
+
+	assert.EqualError(t, err, "job bad: invalid schedule '0 0 30 2 *': day of month never occurs in the months")
+	assert.Empty(t, s.Jobs())
+}
+
+func TestScheduler_Remove(t *testing.T) {
+	s := New(clock.Real)
+	s.Add("job", "@daily", func() error { return nil })
+
+	assert.True(t, s.Remove("job"))
+
+	assert.False(t, s.Remove("job"))
+	assert.Empty(t, s.Jobs())
+	assert.Equal(t, ErrJobNotFound, s.RunNow("job"))
+}
+
+func TestScheduler_RemoveWaitsForRun(t *testing.T) {
+	s := New(clock.Real)
+	release := make(chan struct{})
+	ran := make(chan struct{}, 10)
+	s.Add("job", "@daily", func() error {
+		ran <- struct{}{}
+		<-release
+		return nil
+	})
+	s.RunNow("job")
+	<-ran
+	removed := make(chan bool)
+
+	go func() { removed <- s.Remove("job") }()
+
+	select {
+	case <-removed:
+		t.Fatal("removed before the run completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.True(t, <-removed)
+}
+
+func TestScheduler_ReplaceWaitsForRun(t *testing.T) {
+	s := New(clock.Real)
+	release := make(chan struct{})
+	ran := make(chan string, 10)
+	s.Add("job", "@daily", func() error {
+		ran <- "old"
+		<-release
+		return nil
+	})
+	s.RunNow("job")
+	<-ran
+	replaced := make(chan error)
+
+	go func() { replaced <- s.Add("job", "@daily", func() error { ran <- "new"; return nil }) }()
+
+	select {
+	case <-replaced:
+		t.Fatal("replaced before the run completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-replaced)
+	assert.NoError(t, s.RunNow("job"))
+	assert.Equal(t, "new", <-ran)
+}
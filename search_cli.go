@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sandro-h/sibylgo/parse"
+	"github.com/sandro-h/sibylgo/query"
+)
+
+// runSearch prints the moments of the todo file matching the query, one per line,
+// prefixed with file and line number like compiler errors, so editors can jump to them.
+// The query can be given as one or several args.
+func runSearch(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	todoFile := files.TodoFile
+	parsedQuery, err := query.Parse(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	todos, err := parse.File(todoFile)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range query.Search(todos, parsedQuery, time.Now()) {
+		fmt.Fprintf(out, "%s:%d: %s\n", todoFile, r.DocCoords.LineNumber+1, formatResult(r))
+	}
+	return nil
+}
+
+func formatResult(r query.Result) string {
+	parts := []string{r.Path + strings.Repeat("!", r.Priority)}
+	if r.Category != "" {
+		parts = append(parts, "["+r.Category+"]")
+	}
+	if r.Done {
+		parts = append(parts, "(done)")
+	} else if r.Due != nil {
+		parts = append(parts, "(due "+r.Due.Format("2006-01-02")+")")
+	}
+	return strings.Join(parts, " ")
+}
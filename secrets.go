@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sandro-h/sibylgo/backup"
+	"github.com/sandro-h/sibylgo/util"
+)
+
+// resolveSecrets decrypts the optional secrets block of the config and merges it into the config.
+// The block is a YAML document encrypted with the Ansible Vault mechanism (see -encrypt-secrets),
+// so credentials like mailPassword can live in the config file without being readable.
+func resolveSecrets(cfg *util.Config) error {
+	if !cfg.HasKey("secrets") {
+		return nil
+	}
+
+	password := cfg.GetString("secrets_password", "")
+	if password == "" {
+		return fmt.Errorf("secrets are set but secrets_password is not")
+	}
+
+	cryptor := &backup.AnsibleCryptor{Password: password}
+	decrypted, err := cryptor.DecryptString(cfg.GetString("secrets", ""))
+	if err != nil {
+		return fmt.Errorf("could not decrypt secrets: %s", err)
+	}
+
+	secretsCfg, err := util.LoadConfigString(decrypted)
+	if err != nil {
+		return fmt.Errorf("could not parse decrypted secrets: %s", err)
+	}
+
+	cfg.Merge(secretsCfg)
+	return nil
+}
+
+// encryptSecrets encrypts stdin with the secrets_password and writes it to stdout.
+// The output can be used as the secrets block of the config.
+func encryptSecrets(cfg *util.Config) error {
+	password := cfg.GetString("secrets_password", "")
+	if password == "" {
+		return fmt.Errorf("secrets_password must be set")
+	}
+
+	cryptor := &backup.AnsibleCryptor{Password: password}
+	return cryptor.EncryptContent(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,111 @@
+package status
+
+import (
+	"sync"
+	"time"
+)
+
+var getNow = func() time.Time {
+	return time.Now()
+}
+
+// Event records the outcome of the most recent occurrence of some background activity.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// ExternalSourceEvent records the outcome of the most recent fetch of an external source.
+type ExternalSourceEvent struct {
+	Event
+	Moments int `json:"moments"`
+}
+
+// Status is a snapshot of what the backend did most recently.
+type Status struct {
+	LastParse        *Event                          `json:"lastParse"`
+	LastBackup       *Event                          `json:"lastBackup"`
+	LastRemoteSync   *Event                          `json:"lastRemoteSync"`
+	LastReminderMail *Event                          `json:"lastReminderMail"`
+	ExternalSources  map[string]*ExternalSourceEvent `json:"externalSources"`
+}
+
+var mutex sync.Mutex
+var current = Status{ExternalSources: make(map[string]*ExternalSourceEvent)}
+
+// RecordParse records a parse of the todo file.
+func RecordParse(path string, err error) {
+	record(&current.LastParse, path, err)
+}
+
+// RecordBackup records a backup of the todo file.
+func RecordBackup(message string, err error) {
+	record(&current.LastBackup, message, err)
+}
+
+// RecordRemoteSync records a push of the backups to the remote.
+func RecordRemoteSync(remote string, err error) {
+	record(&current.LastRemoteSync, remote, err)
+}
+
+// RecordReminderMail records a sent (or failed) reminder mail.
+func RecordReminderMail(subject string, err error) {
+	record(&current.LastReminderMail, subject, err)
+}
+
+// RecordExternalSource records a fetch from an external source.
+func RecordExternalSource(name string, moments int, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current.ExternalSources[name] = &ExternalSourceEvent{Event: newEvent("", err), Moments: moments}
+}
+
+func record(target **Event, message string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	e := newEvent(message, err)
+	*target = &e
+}
+
+func newEvent(message string, err error) Event {
+	e := Event{Time: getNow(), Message: message}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Get returns a copy of the current status.
+func Get() Status {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	res := Status{
+		LastParse:        copyEvent(current.LastParse),
+		LastBackup:       copyEvent(current.LastBackup),
+		LastRemoteSync:   copyEvent(current.LastRemoteSync),
+		LastReminderMail: copyEvent(current.LastReminderMail),
+		ExternalSources:  make(map[string]*ExternalSourceEvent),
+	}
+	for k, v := range current.ExternalSources {
+		cp := *v
+		res.ExternalSources[k] = &cp
+	}
+	return res
+}
+
+// Reset clears the status, e.g. between tests.
+func Reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current = Status{ExternalSources: make(map[string]*ExternalSourceEvent)}
+}
+
+func copyEvent(e *Event) *Event {
+	if e == nil {
+		return nil
+	}
+	cp := *e
+	return &cp
+}
@@ -0,0 +1,162 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sandro-h/sibylgo/clock"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMinBackoff = 1 * time.Second
+const defaultMaxBackoff = 5 * time.Minute
+
+// Service is a long-running function that runs until the context is cancelled.
+// Returning an error (or panicking) before that causes the Supervisor to restart it.
+type Service func(ctx context.Context) error
+
+// Supervisor runs named background services, restarts them with exponential backoff
+// if they fail and stops them cleanly.
+type Supervisor struct {
+	Clock      clock.Clock
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	mutex      sync.Mutex
+	services   map[string]*runningService
+}
+
+type runningService struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Supervisor using the passed clock for backoff timers.
+func New(clk clock.Clock) *Supervisor {
+	return &Supervisor{
+		Clock:      clk,
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
+		services:   make(map[string]*runningService),
+	}
+}
+
+// Start runs the service in a go routine. If a service with the same name
+// is already running, it is stopped first.
+func (s *Supervisor) Start(name string, svc Service) {
+	s.Stop(name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rs := &runningService{cancel: cancel, done: make(chan struct{})}
+
+	s.mutex.Lock()
+	s.services[name] = rs
+	s.mutex.Unlock()
+
+	go s.run(ctx, name, svc, rs.done)
+}
+
+// Stop cancels the service and waits until it has finished. It returns false if
+// no service with the name was running.
+func (s *Supervisor) Stop(name string) bool {
+	s.mutex.Lock()
+	rs, found := s.services[name]
+	delete(s.services, name)
+	s.mutex.Unlock()
+
+	if !found {
+		return false
+	}
+	rs.cancel()
+	<-rs.done
+	return true
+}
+
+// IsRunning returns true if a service with the name was started and not stopped yet.
+func (s *Supervisor) IsRunning(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, found := s.services[name]
+	return found
+}
+
+// Shutdown cancels all services and waits until they have finished their current work,
+// but at most for the passed timeout.
+func (s *Supervisor) Shutdown(timeout time.Duration) error {
+	s.mutex.Lock()
+	services := s.services
+	s.services = make(map[string]*runningService)
+	s.mutex.Unlock()
+
+	for _, rs := range services {
+		rs.cancel()
+	}
+
+	deadline := time.After(timeout)
+	for name, rs := range services {
+		select {
+		case <-rs.done:
+		case <-deadline:
+			return fmt.Errorf("service %s did not stop within %s", name, timeout)
+		}
+	}
+	return nil
+}
+
+func (s *Supervisor) run(ctx context.Context, name string, svc Service, done chan struct{}) {
+	defer close(done)
+
+	backoff := s.MinBackoff
+	for {
+		started := s.Clock.Now()
+		err := runRecovered(ctx, svc)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			log.Infof("Service %s finished\n", name)
+			return
+		}
+
+		// A service that ran fine for a while before failing starts over with the minimum backoff.
+		if s.Clock.Now().Sub(started) > s.MaxBackoff {
+			backoff = s.MinBackoff
+		}
+		log.Errorf("Service %s failed, restarting in %s: %s\n", name, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.Clock.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+func runRecovered(ctx context.Context, svc Service) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return svc(ctx)
+}
+
+// Every runs fn immediately and then again after each interval, until the context is cancelled.
+// A call to fn that is in progress when the context is cancelled runs to completion, so fn
+// is never interrupted in the middle of writing a file.
+func Every(ctx context.Context, clk clock.Clock, interval time.Duration, fn func()) error {
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clk.After(interval):
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sandro-h/sibylgo/clock"
+	tu "github.com/sandro-h/sibylgo/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvery(t *testing.T) {
+	clk := clock.NewFake(tu.Dt("04.01.2019"))
+	var calls int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- Every(ctx, clk, 5*time.Minute, func() { atomic.AddInt32(&calls, 1) })
+	}()
+
+	clk.WaitForTimers(1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	clk.Advance(4 * time.Minute)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	clk.Advance(1 * time.Minute)
+	clk.WaitForTimers(1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestSupervisor_RestartsFailedServiceWithBackoff(t *testing.T) {
+	clk := clock.NewFake(tu.Dt("04.01.2019"))
+	s := New(clk)
+	var runs int32
+	running := make(chan struct{}, 10)
+
+	s.Start("flaky", func(ctx context.Context) error {
+		n := atomic.AddInt32(&runs, 1)
+		if n == 1 {
+			panic("boom")
+		}
+		if n == 2 {
+			return errors.New("failed")
+		}
+		running <- struct{}{}
+		<-ctx.Done()
+		return nil
+	})
+
+	// First run panicked, waiting for 1s backoff
+	clk.WaitForTimers(1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	clk.Advance(1 * time.Second)
+
+	// Second run failed, waiting for 2s backoff
+	clk.WaitForTimers(1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+	clk.Advance(1 * time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+	clk.Advance(1 * time.Second)
+
+	<-running
+	assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+	assert.True(t, s.IsRunning("flaky"))
+
+	assert.True(t, s.Stop("flaky"))
+	assert.False(t, s.IsRunning("flaky"))
+	assert.False(t, s.Stop("flaky"))
+}
+
+func TestSupervisor_ShutdownWaitsForInFlightWork(t *testing.T) {
+	s := New(clock.Real)
+	started := make(chan struct{})
+	var finished int32
+
+	s.Start("writer", func(ctx context.Context) error {
+		return Every(ctx, clock.Real, time.Hour, func() {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+		})
+	})
+	<-started
+
+	err := s.Shutdown(5 * time.Second)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+}
+
+func TestSupervisor_ShutdownTimeout(t *testing.T) {
+	s := New(clock.Real)
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+
+	s.Start("stuck", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	err := s.Shutdown(10 * time.Millisecond)
+
+	assert.EqualError(t, err, "service stuck did not stop within 10ms")
+}
+
+func TestSupervisor_StartReplacesRunningService(t *testing.T) {
+	s := New(clock.Real)
+	defer s.Shutdown(time.Second)
+	firstStopped := make(chan struct{})
+
+	s.Start("svc", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(firstStopped)
+		return nil
+	})
+	s.Start("svc", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	select {
+	case <-firstStopped:
+	default:
+		assert.Fail(t, "first service should have been stopped before starting the second")
+	}
+	assert.True(t, s.IsRunning("svc"))
+}
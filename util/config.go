@@ -4,11 +4,29 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
+// fileKeySuffix marks a config key whose value is the path of a file containing the actual value.
+// E.g. bb_token_file: ~/.secrets/bb can be used instead of bb_token: abc123.
+const fileKeySuffix = "_file"
+
+// pathKeys are keys ending in _file that are paths of files used as such, not file variants of other keys.
+var pathKeys = map[string]bool{
+	"cert_file":         true,
+	"key_file":          true,
+	"ssh_key_file":      true,
+	"known_hosts_file":  true,
+	"age_identity_file": true,
+}
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
 // Config holds configuration values and has convenience methods to access these.
 type Config struct {
 	cfg map[interface{}]interface{}
@@ -21,9 +39,12 @@ type ConfigPath struct {
 
 // FileConfig stores the where the most important files for sibylgo are located.
 type FileConfig struct {
-	TodoDir   string
-	TodoFile  string
-	TrashFile string
+	TodoDir           string
+	TodoFile          string
+	TrashFile         string
+	ReminderStateFile string
+	OutboxFile        string
+	ActionsFile       string
 }
 
 // GetString returns the string value for key, or defaultVal if the key is not found.
@@ -55,31 +76,57 @@ func (cfg Config) SetString(key string, val string) {
 }
 
 // GetStringList returns the value for key, or defaultVal if the key is not found.
+// A string value, e.g. read from a file, is split at commas.
 func (cfg Config) GetStringList(key string, defaultVal []string) []string {
 	v, found := cfg.cfg[key]
-	if found {
-		il := v.([]interface{})
+	if !found {
+		return defaultVal
+	}
+	if str, ok := v.(string); ok {
 		var sl []string
-		for _, ie := range il {
-			sl = append(sl, ie.(string))
+		for _, e := range strings.Split(str, ",") {
+			sl = append(sl, strings.TrimSpace(e))
 		}
 		return sl
 	}
-	return defaultVal
+	il := v.([]interface{})
+	var sl []string
+	for _, ie := range il {
+		sl = append(sl, ie.(string))
+	}
+	return sl
 }
 
 // GetInt returns the int value for key, or defaultVal if the key is not found.
 func (cfg Config) GetInt(key string, defaultVal int) int {
 	v, found := cfg.cfg[key]
 	if found {
-		return v.(int)
+		return toInt(key, v, defaultVal)
 	}
 	return defaultVal
 }
 
+func toInt(key string, v interface{}, defaultVal int) int {
+	switch vt := v.(type) {
+	case int:
+		return vt
+	case string:
+		// E.g. a value interpolated from an environment variable
+		i, err := strconv.Atoi(vt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid int value for config key %s: %s\n", key, vt)
+			return defaultVal
+		}
+		return i
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown int type for config key %s\n", key)
+		return defaultVal
+	}
+}
+
 // GetIntOrFail returns the int value for key, or exits the program with error code 1 if it doesn't exist.
 func (cfg Config) GetIntOrFail(key string) int {
-	return cfg.getOrFail(key).(int)
+	return toInt(key, cfg.getOrFail(key), 0)
 }
 
 // GetBool returns the bool value for key, or defaultVal if the key is not found.
@@ -92,7 +139,7 @@ func (cfg Config) GetBool(key string, defaultVal bool) bool {
 		case bool:
 			return vt
 		default:
-			fmt.Printf("Unknown bool type for config key %s\n", key)
+			fmt.Fprintf(os.Stderr, "Unknown bool type for config key %s\n", key)
 		}
 	}
 	return defaultVal
@@ -104,6 +151,16 @@ func (cfg Config) HasKey(key string) bool {
 	return found
 }
 
+// Keys returns all keys of the config, sorted alphabetically.
+func (cfg Config) Keys() []string {
+	var keys []string
+	for k := range cfg.cfg {
+		keys = append(keys, fmt.Sprintf("%v", k))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // GetSubConfig returns the part of the config under key as a new Config object.
 // If the key is not found an empty config is returned.
 func (cfg Config) GetSubConfig(key string) *Config {
@@ -178,9 +235,132 @@ func loadConfigBytes(data []byte) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = interpolateEnvVars(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = resolveFileKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &Config{cfg}, nil
 }
 
+// resolveFileKeys sets every key that is not set but has a file variant (key + "_file") to the content of
+// that file. It fails if a file cannot be read.
+func resolveFileKeys(cfg map[interface{}]interface{}) error {
+	resolved := make(map[string]string)
+	for k, v := range cfg {
+		err := resolveFileKeysIn(v)
+		if err != nil {
+			return err
+		}
+		fileKey, ok := k.(string)
+		path, isString := v.(string)
+		if !ok || !isString || !strings.HasSuffix(fileKey, fileKeySuffix) || pathKeys[fileKey] {
+			continue
+		}
+		key := strings.TrimSuffix(fileKey, fileKeySuffix)
+		if _, found := cfg[key]; found {
+			continue
+		}
+		content, err := ReadFile(ExpandHome(path))
+		if err != nil {
+			return fmt.Errorf("config key %s: %s", fileKey, err)
+		}
+		resolved[key] = strings.TrimRight(content, "\r\n")
+	}
+	for k, v := range resolved {
+		cfg[k] = v
+	}
+	return nil
+}
+
+func resolveFileKeysIn(v interface{}) error {
+	switch vt := v.(type) {
+	case []interface{}:
+		for _, e := range vt {
+			err := resolveFileKeysIn(e)
+			if err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		return resolveFileKeys(vt)
+	}
+	return nil
+}
+
+// interpolateEnvVars replaces all ${ENV_VAR} references in string values with the
+// value of the environment variable. It fails if a referenced variable is not set.
+func interpolateEnvVars(cfg map[interface{}]interface{}) error {
+	for k, v := range cfg {
+		newVal, err := interpolateValue(v)
+		if err != nil {
+			return fmt.Errorf("config key %v: %s", k, err)
+		}
+		cfg[k] = newVal
+	}
+	return nil
+}
+
+func interpolateValue(v interface{}) (interface{}, error) {
+	switch vt := v.(type) {
+	case string:
+		return interpolateString(vt)
+	case []interface{}:
+		for i, e := range vt {
+			newElem, err := interpolateValue(e)
+			if err != nil {
+				return nil, err
+			}
+			vt[i] = newElem
+		}
+		return vt, nil
+	case map[interface{}]interface{}:
+		return vt, interpolateEnvVars(vt)
+	default:
+		return v, nil
+	}
+}
+
+func interpolateString(str string) (string, error) {
+	var missing []string
+	res := envVarPattern.ReplaceAllStringFunc(str, func(ref string) string {
+		name := envVarPattern.FindStringSubmatch(ref)[1]
+		val, found := os.LookupEnv(name)
+		if !found {
+			missing = append(missing, name)
+		}
+		return val
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+// Merge copies all values of other into the config, overwriting existing values.
+// Sub-configs present in both are merged recursively.
+func (cfg *Config) Merge(other *Config) {
+	if cfg.cfg == nil {
+		cfg.cfg = make(map[interface{}]interface{})
+	}
+	mergeMaps(cfg.cfg, other.cfg)
+}
+
+func mergeMaps(target map[interface{}]interface{}, src map[interface{}]interface{}) {
+	for k, v := range src {
+		srcSub, srcIsMap := v.(map[interface{}]interface{})
+		targetSub, targetIsMap := target[k].(map[interface{}]interface{})
+		if srcIsMap && targetIsMap {
+			mergeMaps(targetSub, srcSub)
+		} else {
+			target[k] = v
+		}
+	}
+}
+
 // SaveConfig saves the config object to a YAML file.
 func SaveConfig(cfg *Config, cfgFile string) error {
 	data, err := saveConfigBytes(cfg)
@@ -229,6 +409,9 @@ func NewFileConfigFromTodoFile(todoFile string) *FileConfig {
 
 	fileCfg.TodoDir = filepath.Dir(fileCfg.TodoFile)
 	fileCfg.TrashFile = RemoveExtension(fileCfg.TodoFile) + "-trash.txt"
+	fileCfg.ReminderStateFile = RemoveExtension(fileCfg.TodoFile) + "-reminders.json"
+	fileCfg.OutboxFile = RemoveExtension(fileCfg.TodoFile) + "-outbox.json"
+	fileCfg.ActionsFile = RemoveExtension(fileCfg.TodoFile) + "-actions.json"
 
 	return &fileCfg
 }
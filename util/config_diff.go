@@ -0,0 +1,112 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigChange describes a single difference between two configs.
+type ConfigChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+	Added    bool
+	Removed  bool
+}
+
+// String renders the change in a human-readable way, e.g. for logging.
+// Values of sensitive keys (passwords, tokens, secrets, keys) are masked, also inside added sections.
+func (c ConfigChange) String() string {
+	if c.Added {
+		return fmt.Sprintf("+ %s: %s", c.Path, c.maskedValue(c.NewValue))
+	}
+	if c.Removed {
+		return fmt.Sprintf("- %s", c.Path)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.maskedValue(c.OldValue), c.maskedValue(c.NewValue))
+}
+
+func (c ConfigChange) maskedValue(v interface{}) string {
+	return fmt.Sprintf("%v", maskValue(c.Path, v))
+}
+
+// sensitiveKeyParts mark config keys whose values are masked.
+var sensitiveKeyParts = []string{"password", "token", "secret", "key", "hmac"}
+
+// maskValue returns the value with the values of sensitive keys replaced by ***, also in nested sections
+// and lists.
+func maskValue(path string, v interface{}) interface{} {
+	lowerPath := strings.ToLower(path)
+	for _, s := range sensitiveKeyParts {
+		if strings.Contains(lowerPath, s) {
+			return "***"
+		}
+	}
+	switch vt := v.(type) {
+	case map[interface{}]interface{}:
+		masked := make(map[interface{}]interface{}, len(vt))
+		for k, sub := range vt {
+			masked[k] = maskValue(fmt.Sprintf("%v", k), sub)
+		}
+		return masked
+	case []interface{}:
+		masked := make([]interface{}, len(vt))
+		for i, sub := range vt {
+			masked[i] = maskValue("", sub)
+		}
+		return masked
+	}
+	return v
+}
+
+// DiffConfigs returns all differences between the old and new config, sorted by path.
+// Sub-configs are compared recursively, so a changed value deep in a sub-config is reported
+// with its full dot-separated path.
+func DiffConfigs(oldCfg *Config, newCfg *Config) []ConfigChange {
+	var changes []ConfigChange
+	diffMaps("", oldCfg.cfg, newCfg.cfg, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// ChangesTouch returns true if any of the changes is at or below one of the passed
+// top-level keys.
+func ChangesTouch(changes []ConfigChange, keys ...string) bool {
+	for _, c := range changes {
+		for _, k := range keys {
+			if c.Path == k || strings.HasPrefix(c.Path, k+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func diffMaps(prefix string, oldMap map[interface{}]interface{}, newMap map[interface{}]interface{},
+	changes *[]ConfigChange) {
+	for k, oldVal := range oldMap {
+		path := prefix + fmt.Sprintf("%v", k)
+		newVal, found := newMap[k]
+		if !found {
+			*changes = append(*changes, ConfigChange{Path: path, OldValue: oldVal, Removed: true})
+			continue
+		}
+
+		oldSub, oldIsMap := oldVal.(map[interface{}]interface{})
+		newSub, newIsMap := newVal.(map[interface{}]interface{})
+		if oldIsMap && newIsMap {
+			diffMaps(path+".", oldSub, newSub, changes)
+		} else if !reflect.DeepEqual(oldVal, newVal) {
+			*changes = append(*changes, ConfigChange{Path: path, OldValue: oldVal, NewValue: newVal})
+		}
+	}
+
+	for k, newVal := range newMap {
+		if _, found := oldMap[k]; !found {
+			path := prefix + fmt.Sprintf("%v", k)
+			*changes = append(*changes, ConfigChange{Path: path, NewValue: newVal, Added: true})
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	oldCfg, _ := LoadConfigString(`
+todoFile: /tmp/todo.txt
+port: 8082
+mailPassword: old
+backup:
+  remote_url: https://example.com/old
+  remote_user: me
+outlook_events:
+  enabled: true
+`)
+	newCfg, _ := LoadConfigString(`
+todoFile: /tmp/todo.txt
+port: 8083
+mailPassword: new
+backup:
+  remote_url: https://example.com/new
+external_sources:
+  prepend: true
+`)
+
+	changes := DiffConfigs(oldCfg, newCfg)
+
+	var lines []string
+	for _, c := range changes {
+		lines = append(lines, c.String())
+	}
+	assert.Equal(t, []string{
+		"~ backup.remote_url: https://example.com/old -> https://example.com/new",
+		"- backup.remote_user",
+		"+ external_sources: map[prepend:true]",
+		"~ mailPassword: *** -> ***",
+		"- outlook_events",
+		"~ port: 8082 -> 8083",
+	}, lines)
+}
+
+func TestDiffConfigs_MasksSections(t *testing.T) {
+	oldCfg, _ := LoadConfigString(`
+actions:
+  hmac_key: oldsecretkey
+notifiers:
+  phone:
+    type: ntfy
+    token: tk_old
+`)
+	newCfg, _ := LoadConfigString(`
+actions:
+  hmac_key: newsecretkey
+rest:
+  auth_token: SUPERSECRET
+  cors_origins: [null]
+remotes:
+  - url: https://example.com
+    password: pw
+`)
+
+	var lines []string
+	for _, c := range DiffConfigs(oldCfg, newCfg) {
+		lines = append(lines, c.String())
+	}
+	assert.Equal(t, []string{
+		"~ actions.hmac_key: *** -> ***",
+		"- notifiers",
+		"+ remotes: [map[password:*** url:https://example.com]]",
+		"+ rest: map[auth_token:*** cors_origins:[<nil>]]",
+	}, lines)
+}
+
+func TestDiffConfigs_NoChanges(t *testing.T) {
+	cfg := `
+todoFile: /tmp/todo.txt
+parse:
+  date_formats: ["02.01.06"]
+`
+	oldCfg, _ := LoadConfigString(cfg)
+	newCfg, _ := LoadConfigString(cfg)
+
+	assert.Empty(t, DiffConfigs(oldCfg, newCfg))
+}
+
+func TestChangesTouch(t *testing.T) {
+	changes := []ConfigChange{{Path: "backup.remote_url"}, {Path: "mailTo"}}
+
+	assert.True(t, ChangesTouch(changes, "backup"))
+	assert.True(t, ChangesTouch(changes, "mailHost", "mailTo"))
+	assert.False(t, ChangesTouch(changes, "back"))
+	assert.False(t, ChangesTouch(changes, "external_sources"))
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // ReadFile reads a textfile's entire content into a string and returns it.
@@ -23,6 +25,29 @@ func WriteFile(filePath string, str string) error {
 	return os.WriteFile(filePath, []byte(str), 0644)
 }
 
+// ErrWriteConflict is returned if a file was modified by someone else between reading
+// and writing it.
+var ErrWriteConflict = errors.New("file was modified concurrently")
+
+var conditionalWriteMutex sync.Mutex
+
+// WriteFileIfUnchanged writes the passed string content to a textfile, but only if the file
+// still has the expected content, i.e. the content the caller read before modifying it.
+// Otherwise it returns ErrWriteConflict and leaves the file untouched.
+func WriteFileIfUnchanged(filePath string, expected string, str string) error {
+	conditionalWriteMutex.Lock()
+	defer conditionalWriteMutex.Unlock()
+
+	current, err := ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if current != expected {
+		return ErrWriteConflict
+	}
+	return WriteFile(filePath, str)
+}
+
 // AppendFile writes the passed string content at the end of the textfile.
 func AppendFile(filePath string, str string) error {
 	if str[len(str)-1] != '\n' {
@@ -42,6 +67,18 @@ func RemoveExtension(s string) string {
 	return s[:len(s)-len(filepath.Ext(s))]
 }
 
+// ExpandHome replaces a leading ~ in the path with the user's home directory.
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~\\") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
 // Exists returns true if the file exists.
 func Exists(path string) bool {
 	if _, err := os.Stat(path); err == nil {
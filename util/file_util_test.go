@@ -0,0 +1,30 @@
+package util
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileIfUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.txt")
+	WriteFile(path, "[] foo\n")
+
+	err := WriteFileIfUnchanged(path, "[] foo\n", "[] bar\n")
+
+	assert.Nil(t, err)
+	content, _ := ReadFile(path)
+	assert.Equal(t, "[] bar\n", content)
+}
+
+func TestWriteFileIfUnchanged_Conflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.txt")
+	WriteFile(path, "[] modified by someone else\n")
+
+	err := WriteFileIfUnchanged(path, "[] foo\n", "[] bar\n")
+
+	assert.Equal(t, ErrWriteConflict, err)
+	content, _ := ReadFile(path)
+	assert.Equal(t, "[] modified by someone else\n", content)
+}
@@ -29,6 +29,7 @@
 			case 'update':
 				$('#due-today').empty().append(createInstanceList(message.preview.today, 'due-today'));
 				$('#due-week').empty().append(createInstanceList(message.preview.week, 'due-week', true));
+				$('#views').empty().append(createViews(message.preview.views || []));
 				$('#overview').empty().append(createOverviewBoard(message.preview.overview));
 				calEvents = message.preview.calendar;
 				$('#calendar').fullCalendar('refetchEvents');
@@ -46,6 +47,17 @@
 		});
 	}
 
+	function createViews(views) {
+		return views.map(v => {
+			const div = $('<div class="view"/>')
+				.append($('<h3/>').text(v.name).prop('title', v.query));
+			if (v.moments.length === 0) {
+				return div.append($('<div class="view-empty"/>').text('No matching moments'));
+			}
+			return div.append(v.moments.map(m => createMomentCell(m.name, m.docCoords.lineNumber)));
+		});
+	}
+
 	function createOverviewBoard(overview) {
 		return overview.categories.map(createOverviewLane);
 	}
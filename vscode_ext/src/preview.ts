@@ -207,6 +207,8 @@ class SibylPreviewPanel {
 						</td>
 					</tr>
 				</table>
+
+				<div id="views"></div>
 		
 				<div id="overview" />
 				